@@ -0,0 +1,128 @@
+package imap
+
+import (
+	"strings"
+)
+
+// Right describes a set of operations controlled by the IMAP ACL extension.
+//
+// See RFC 4314 section 2.1.
+type Right byte
+
+const (
+	RightLookup         Right = 'l' // mailbox is visible to LIST, SUBSCRIBE mailbox
+	RightRead           Right = 'r' // SELECT the mailbox, perform STATUS
+	RightSeen           Right = 's' // keep seen/unseen information across sessions
+	RightWrite          Right = 'w' // set or clear flags other than \Seen and \Deleted
+	RightInsert         Right = 'i' // perform APPEND, COPY into mailbox
+	RightPost           Right = 'p' // send mail to submission address for mailbox
+	RightCreate         Right = 'k' // CREATE new sub-mailboxes, RENAME into the mailbox
+	RightDeleteMailbox  Right = 'x' // DELETE mailbox, RENAME mailbox
+	RightDeleteMessages Right = 't' // set or clear the \Deleted flag
+	RightExpunge        Right = 'e' // perform EXPUNGE
+	RightAdminister     Right = 'a' // perform SETACL, DELETEACL, GETACL, LISTRIGHTS
+)
+
+// RightSet is a set of rights.
+type RightSet []Right
+
+// AllRights is the set of all rights.
+var AllRights = RightSet("lrswipkxtea")
+
+// String returns the IMAP representation of the right set.
+func (rs RightSet) String() string {
+	return string(rs)
+}
+
+// Has checks whether the set contains a right.
+func (rs RightSet) Has(right Right) bool {
+	for _, r := range rs {
+		if r == right {
+			return true
+		}
+	}
+	return false
+}
+
+// Add returns a new right set containing rights from both sets.
+func (rs RightSet) Add(rights RightSet) RightSet {
+	out := append(RightSet(nil), rs...)
+	for _, r := range rights {
+		if !out.Has(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Remove returns a new right set containing all rights in rs except these
+// in the provided set.
+func (rs RightSet) Remove(rights RightSet) RightSet {
+	var out RightSet
+	for _, r := range rs {
+		if !rights.Has(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Equal returns true if both right sets contain exactly the same rights.
+func (rs RightSet) Equal(other RightSet) bool {
+	for _, r := range rs {
+		if !other.Has(r) {
+			return false
+		}
+	}
+	for _, r := range other {
+		if !rs.Has(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// RightModification indicates how to mutate a right set.
+type RightModification byte
+
+const (
+	RightModificationReplace RightModification = 0
+	RightModificationAdd     RightModification = '+'
+	RightModificationRemove  RightModification = '-'
+)
+
+// RightsIdentifier is an ACL identifier, typically a user name.
+//
+// An identifier prefixed with "-" designates negative rights.
+type RightsIdentifier string
+
+// RightsIdentifierAnyone is the universal identity, matching everyone.
+const RightsIdentifierAnyone RightsIdentifier = "anyone"
+
+// IsNegative returns true if the identifier designates negative rights.
+func (ri RightsIdentifier) IsNegative() bool {
+	return strings.HasPrefix(string(ri), "-")
+}
+
+// GetACLData is the data returned by the GETACL command.
+type GetACLData struct {
+	Mailbox string
+	Rights  map[RightsIdentifier]RightSet
+}
+
+// ListRightsData is the data returned by the LISTRIGHTS command.
+type ListRightsData struct {
+	Mailbox    string
+	Identifier RightsIdentifier
+	// Rights always granted to the identifier
+	Required RightSet
+	// Rights which can be granted to the identifier. Rights in the same
+	// group are tied together.
+	Optional []RightSet
+}
+
+// MyRightsData is the data returned by the MYRIGHTS command.
+type MyRightsData struct {
+	Mailbox string
+	Rights  RightSet
+}
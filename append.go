@@ -8,9 +8,19 @@ import (
 type AppendOptions struct {
 	Flags []Flag
 	Time  time.Time
+	// Binary indicates that the message is sent as a literal8, which allows
+	// 8-bit and binary content (requires BINARY)
+	Binary bool
+	// UTF8 indicates that the message may contain UTF-8 header fields, e.g.
+	// a message/global message (requires UTF8=ACCEPT to be enabled)
+	UTF8 bool
 }
 
 // AppendData is the data returned by an APPEND command.
 type AppendData struct {
-	UID, UIDValidity uint32 // requires UIDPLUS or IMAP4rev2
+	// requires UIDPLUS or IMAP4rev2
+	UID, UIDValidity uint32
+	// UIDs of all appended messages. With MULTIAPPEND, multiple messages
+	// may be appended, in which case UID is left zero.
+	UIDs SeqSet
 }
@@ -0,0 +1,167 @@
+package imap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CatenatePart is a part of a message built with CATENATE.
+//
+// If URL is set, the part is copied from an existing message on the server.
+// Otherwise, Text contains the literal part data.
+type CatenatePart struct {
+	URL  string
+	Text []byte
+}
+
+// MessageURL is an IMAP URL referencing a message or a message part stored on
+// the server, as defined in RFC 5092. It can be used in CatenatePart.URL.
+type MessageURL struct {
+	Mailbox     string
+	UIDValidity uint32 // optional
+	UID         uint32
+
+	// Section, optional. If empty, the whole message is referenced.
+	Part      []int
+	Specifier PartSpecifier
+}
+
+// String formats the URL as a relative IMAP URL.
+func (u *MessageURL) String() string {
+	var sb strings.Builder
+	for _, elem := range strings.Split(u.Mailbox, "/") {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(elem))
+	}
+	if u.UIDValidity != 0 {
+		sb.WriteString(";UIDVALIDITY=")
+		sb.WriteString(strconv.FormatUint(uint64(u.UIDValidity), 10))
+	}
+	sb.WriteString("/;UID=")
+	sb.WriteString(strconv.FormatUint(uint64(u.UID), 10))
+
+	var section []string
+	for _, part := range u.Part {
+		section = append(section, strconv.Itoa(part))
+	}
+	if u.Specifier != PartSpecifierNone {
+		section = append(section, string(u.Specifier))
+	}
+	if len(section) > 0 {
+		sb.WriteString("/;SECTION=")
+		sb.WriteString(strings.Join(section, "."))
+	}
+	return sb.String()
+}
+
+// ParseMessageURL parses an IMAP URL referencing a message or a message part.
+//
+// Both absolute ("imap://host/...") and relative ("/...") URLs are accepted.
+// The authority of absolute URLs is ignored. The PARTIAL and URLAUTH
+// components are not supported.
+func ParseMessageURL(s string) (*MessageURL, error) {
+	path := s
+	if len(path) >= len("imap://") && strings.EqualFold(path[:len("imap://")], "imap://") {
+		path = path[len("imap://"):]
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			return nil, fmt.Errorf("imap: missing path in URL %q", s)
+		}
+		path = path[i:]
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("imap: unsupported relative URL %q", s)
+	}
+
+	i := indexFold(path, "/;UID=")
+	if i < 0 {
+		return nil, fmt.Errorf("imap: missing UID in URL %q", s)
+	}
+
+	var u MessageURL
+	mailbox := path[1:i]
+	if j := indexFold(mailbox, ";UIDVALIDITY="); j >= 0 {
+		uidValidity, err := strconv.ParseUint(mailbox[j+len(";UIDVALIDITY="):], 10, 32)
+		if err != nil || uidValidity == 0 {
+			return nil, fmt.Errorf("imap: invalid UIDVALIDITY in URL %q", s)
+		}
+		u.UIDValidity = uint32(uidValidity)
+		mailbox = mailbox[:j]
+	}
+	var err error
+	u.Mailbox, err = url.PathUnescape(mailbox)
+	if err != nil || u.Mailbox == "" {
+		return nil, fmt.Errorf("imap: invalid mailbox in URL %q", s)
+	}
+
+	rest := path[i+len("/;UID="):]
+	uidStr, section := rest, ""
+	if j := indexFold(rest, "/;SECTION="); j >= 0 {
+		uidStr, section = rest[:j], rest[j+len("/;SECTION="):]
+	}
+	uid, err := strconv.ParseUint(uidStr, 10, 32)
+	if err != nil || uid == 0 {
+		return nil, fmt.Errorf("imap: invalid UID in URL %q", s)
+	}
+	u.UID = uint32(uid)
+
+	if section != "" {
+		section, err = url.PathUnescape(section)
+		if err != nil {
+			return nil, fmt.Errorf("imap: invalid section in URL %q", s)
+		}
+		if err := u.parseSection(section); err != nil {
+			return nil, fmt.Errorf("imap: invalid section in URL %q: %v", s, err)
+		}
+	}
+
+	return &u, nil
+}
+
+// indexFold is like strings.Index, but ASCII case-insensitive.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (u *MessageURL) parseSection(section string) error {
+	elems := strings.Split(section, ".")
+	for len(elems) > 0 {
+		part, err := strconv.Atoi(elems[0])
+		if err != nil {
+			break
+		} else if part <= 0 {
+			return fmt.Errorf("invalid part number %v", part)
+		}
+		u.Part = append(u.Part, part)
+		elems = elems[1:]
+	}
+
+	switch len(elems) {
+	case 0:
+		return nil
+	case 1:
+		// handled below
+	default:
+		return fmt.Errorf("unsupported section specifier %q", strings.Join(elems, "."))
+	}
+
+	switch spec := PartSpecifier(strings.ToUpper(elems[0])); spec {
+	case PartSpecifierHeader, PartSpecifierText:
+		u.Specifier = spec
+	case PartSpecifierMIME:
+		if len(u.Part) == 0 {
+			return fmt.Errorf("MIME specifier requires a part number")
+		}
+		u.Specifier = spec
+	default:
+		return fmt.Errorf("unsupported section specifier %q", elems[0])
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMessageURL(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *MessageURL
+	}{
+		{"/INBOX/;UID=20", &MessageURL{Mailbox: "INBOX", UID: 20}},
+		{"/INBOX;UIDVALIDITY=385759045/;UID=20/;SECTION=1.2", &MessageURL{Mailbox: "INBOX", UIDValidity: 385759045, UID: 20, Part: []int{1, 2}}},
+		{"/Lists/go%20dev/;uid=3/;section=HEADER", &MessageURL{Mailbox: "Lists/go dev", UID: 3, Specifier: PartSpecifierHeader}},
+		{"/Drafts/;UID=7/;SECTION=2.MIME", &MessageURL{Mailbox: "Drafts", UID: 7, Part: []int{2}, Specifier: PartSpecifierMIME}},
+		{"imap://joe@example.com/INBOX/;UID=1/;SECTION=TEXT", &MessageURL{Mailbox: "INBOX", UID: 1, Specifier: PartSpecifierText}},
+		{"INBOX/;UID=1", nil},
+		{"/INBOX", nil},
+		{"/INBOX/;UID=0", nil},
+		{"/INBOX;UIDVALIDITY=abc/;UID=1", nil},
+		{"/INBOX/;UID=1/;SECTION=MIME", nil},
+		{"/INBOX/;UID=1/;SECTION=HEADER.FIELDS", nil},
+	}
+	for _, tc := range tests {
+		u, err := ParseMessageURL(tc.in)
+		if tc.out == nil {
+			if err == nil {
+				t.Errorf("ParseMessageURL(%q) = %v, want error", tc.in, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMessageURL(%q) = %v", tc.in, err)
+		} else if !reflect.DeepEqual(u, tc.out) {
+			t.Errorf("ParseMessageURL(%q) = %#v, want %#v", tc.in, u, tc.out)
+		}
+	}
+}
+
+func TestMessageURL_String(t *testing.T) {
+	u := &MessageURL{
+		Mailbox:     "Lists/go dev;x",
+		UIDValidity: 42,
+		UID:         3,
+		Part:        []int{1, 2},
+		Specifier:   PartSpecifierMIME,
+	}
+	want := "/Lists/go%20dev%3Bx;UIDVALIDITY=42/;UID=3/;SECTION=1.2.MIME"
+	if s := u.String(); s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+	parsed, err := ParseMessageURL(u.String())
+	if err != nil {
+		t.Fatalf("ParseMessageURL() = %v", err)
+	} else if !reflect.DeepEqual(parsed, u) {
+		t.Errorf("ParseMessageURL(String()) = %#v, want %#v", parsed, u)
+	}
+}
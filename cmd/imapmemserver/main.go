@@ -68,12 +68,28 @@ func main() {
 			return memServer.NewSession(), nil
 		},
 		Caps: imap.CapSet{
-			imap.CapIMAP4rev1: {},
-			imap.CapIMAP4rev2: {},
+			imap.CapIMAP4rev1:       {},
+			imap.CapIMAP4rev2:       {},
+			imap.CapCondStore:       {},
+			imap.CapQResync:         {},
+			imap.CapSort:            {},
+			"THREAD=ORDEREDSUBJECT": {},
+			"THREAD=REFERENCES":     {},
+			imap.CapMetadata:        {},
+			imap.CapID:              {},
+			imap.CapCompressDeflate: {},
+			imap.CapACL:             {},
+			imap.CapBinary:          {},
+			imap.CapUTF8Accept:      {},
+			imap.CapNotify:          {},
+			imap.CapMultiAppend:     {},
+			imap.CapCatenate:        {},
 		},
-		TLSConfig:    tlsConfig,
-		InsecureAuth: insecureAuth,
-		DebugWriter:  debugWriter,
+		ID:                 map[string]string{"name": "imapmemserver"},
+		TLSConfig:          tlsConfig,
+		InsecureAuth:       insecureAuth,
+		ConcurrentCommands: true,
+		DebugWriter:        debugWriter,
 	})
 	if err := server.Serve(ln); err != nil {
 		log.Fatalf("Serve() = %v", err)
@@ -35,8 +35,20 @@ var (
 	FetchItemInternalDate  FetchItem = FetchItemKeyword("INTERNALDATE")
 	FetchItemRFC822Size    FetchItem = FetchItemKeyword("RFC822.SIZE")
 	FetchItemUID           FetchItem = FetchItemKeyword("UID")
+	FetchItemModSeq        FetchItem = FetchItemKeyword("MODSEQ") // requires CONDSTORE
 )
 
+// FetchOptions contains options for the FETCH command.
+type FetchOptions struct {
+	// Only return messages whose mod-sequence is greater than this value.
+	// Implies FetchItemModSeq. Requires CONDSTORE.
+	ChangedSince uint64
+	// Return the UIDs of expunged messages whose mod-sequence is greater than
+	// ChangedSince in a VANISHED (EARLIER) response. Only valid for UID FETCH.
+	// Requires QRESYNC.
+	Vanished bool
+}
+
 type PartSpecifier string
 
 const (
@@ -0,0 +1,123 @@
+package imapclient_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestACL(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	myRights, err := client.MyRights("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("MyRights() = %v", err)
+	} else if !myRights.Rights.Equal(imap.AllRights) {
+		t.Errorf("MyRights() = %v, want %v", myRights.Rights, imap.AllRights)
+	}
+
+	if err := client.SetACL("INBOX", "friend", imap.RightModificationReplace, imap.RightSet("lr")).Wait(); err != nil {
+		t.Fatalf("SetACL() = %v", err)
+	}
+	if err := client.SetACL("INBOX", "friend", imap.RightModificationAdd, imap.RightSet("s")).Wait(); err != nil {
+		t.Fatalf("SetACL() = %v", err)
+	}
+
+	acl, err := client.GetACL("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("GetACL() = %v", err)
+	}
+	if rs := acl.Rights["friend"]; !rs.Equal(imap.RightSet("lrs")) {
+		t.Errorf("GetACL() rights for friend = %v, want %v", rs, "lrs")
+	}
+	if rs := acl.Rights[testUsername]; !rs.Equal(imap.AllRights) {
+		t.Errorf("GetACL() rights for %v = %v, want %v", testUsername, rs, imap.AllRights)
+	}
+
+	listRights, err := client.ListRights("INBOX", "friend").Wait()
+	if err != nil {
+		t.Fatalf("ListRights() = %v", err)
+	} else if listRights.Identifier != "friend" || len(listRights.Optional) == 0 {
+		t.Errorf("ListRights() = %#v", listRights)
+	}
+
+	if err := client.DeleteACL("INBOX", "friend").Wait(); err != nil {
+		t.Fatalf("DeleteACL() = %v", err)
+	}
+	acl, err = client.GetACL("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("GetACL() = %v", err)
+	} else if _, ok := acl.Rights["friend"]; ok {
+		t.Errorf("GetACL() still contains friend after DeleteACL()")
+	}
+
+	// Revoke our own insert right: APPEND must be denied
+	if err := client.SetACL("INBOX", testUsername, imap.RightModificationRemove, imap.RightSet("i")).Wait(); err != nil {
+		t.Fatalf("SetACL() = %v", err)
+	}
+	err = appendMessage(client, "INBOX", simpleRawMessage, nil)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeNoPerm {
+		t.Errorf("Append() = %v, want NOPERM", err)
+	}
+}
+
+func TestACL_messageRights(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	if err := client.SetACL("INBOX", testUsername, imap.RightModificationRemove, imap.RightSet("se")).Wait(); err != nil {
+		t.Fatalf("SetACL() = %v", err)
+	}
+
+	// Replacing the flags may remove \Seen
+	err := client.Store(imap.SeqSetNum(1), &imap.StoreFlags{
+		Op:     imap.StoreFlagsSet,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}, nil).Close()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeNoPerm {
+		t.Errorf("Store(FLAGS) = %v, want NOPERM", err)
+	}
+
+	// Fetching the body doesn't set \Seen
+	items := []imap.FetchItem{&imap.FetchItemBodySection{}}
+	if _, err := client.Fetch(imap.SeqSetNum(1), items, nil).Collect(); err != nil {
+		t.Fatalf("Fetch(BODY[]) = %v", err)
+	}
+	msgs, err := client.Fetch(imap.SeqSetNum(1), []imap.FetchItem{imap.FetchItemFlags}, nil).Collect()
+	if err != nil {
+		t.Fatalf("Fetch(FLAGS) = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch(FLAGS) = %v messages, want 1", len(msgs))
+	}
+	for _, flag := range msgs[0].Flags {
+		if flag == imap.FlagSeen {
+			t.Errorf("Fetch(BODY[]) set \\Seen without the 's' right")
+		}
+	}
+
+	// CLOSE doesn't expunge messages
+	err = client.Store(imap.SeqSetNum(1), &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}, nil).Close()
+	if err != nil {
+		t.Fatalf("Store(+FLAGS \\Deleted) = %v", err)
+	}
+	if err := client.UnselectAndExpunge().Wait(); err != nil {
+		t.Fatalf("UnselectAndExpunge() = %v", err)
+	}
+	if n := numMessages(t, client, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %v messages after CLOSE, want 1", n)
+	}
+}
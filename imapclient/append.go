@@ -1,6 +1,8 @@
 package imapclient
 
 import (
+	"context"
+	"fmt"
 	"io"
 
 	"github.com/emersion/go-imap/v2"
@@ -16,16 +18,36 @@ func (c *Client) Append(mailbox string, size int64, options *imap.AppendOptions)
 	cmd := &AppendCommand{}
 	cmd.enc = c.beginCommand("APPEND", cmd)
 	cmd.enc.SP().Mailbox(mailbox).SP()
+	cmd.wc, cmd.utf8 = writeAppendMessage(cmd.enc, size, options)
+	return cmd
+}
+
+// writeAppendOptions writes the flags and the date of a message.
+func writeAppendOptions(enc *commandEncoder, options *imap.AppendOptions) {
 	if options != nil && len(options.Flags) > 0 {
-		cmd.enc.List(len(options.Flags), func(i int) {
-			cmd.enc.Flag(options.Flags[i])
+		enc.List(len(options.Flags), func(i int) {
+			enc.Flag(options.Flags[i])
 		}).SP()
 	}
 	if options != nil && !options.Time.IsZero() {
-		cmd.enc.String(options.Time.Format(internal.DateTimeLayout)).SP()
+		enc.String(options.Time.Format(internal.DateTimeLayout)).SP()
+	}
+}
+
+// writeAppendMessage writes the options of a message and starts its literal.
+// If utf8 is true, the caller must write a closing parenthesis after the
+// literal.
+func writeAppendMessage(enc *commandEncoder, size int64, options *imap.AppendOptions) (wc io.WriteCloser, utf8 bool) {
+	writeAppendOptions(enc, options)
+	if options != nil && options.UTF8 {
+		// RFC 6855 section 4
+		enc.Atom("UTF8").SP().Special('(')
+		return enc.Literal8(size), true
+	} else if options != nil && options.Binary {
+		return enc.Literal8(size), false
+	} else {
+		return enc.Literal(size), false
 	}
-	cmd.wc = cmd.enc.Literal(size)
-	return cmd
 }
 
 // AppendCommand is an APPEND command.
@@ -35,6 +57,7 @@ type AppendCommand struct {
 	cmd
 	enc  *commandEncoder
 	wc   io.WriteCloser
+	utf8 bool
 	data imap.AppendData
 }
 
@@ -45,6 +68,9 @@ func (cmd *AppendCommand) Write(b []byte) (int, error) {
 func (cmd *AppendCommand) Close() error {
 	err := cmd.wc.Close()
 	if cmd.enc != nil {
+		if cmd.utf8 {
+			cmd.enc.Special(')')
+		}
 		cmd.enc.end()
 		cmd.enc = nil
 	}
@@ -54,3 +80,130 @@ func (cmd *AppendCommand) Close() error {
 func (cmd *AppendCommand) Wait() (*imap.AppendData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
+
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *AppendCommand) WaitContext(ctx context.Context) (*imap.AppendData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
+// MultiAppend sends an APPEND command which can contain multiple messages.
+//
+// Messages are added with MultiAppendCommand.CreateMessage and
+// MultiAppendCommand.CatenateMessage. The caller must call
+// MultiAppendCommand.Close once all messages have been added. The server
+// appends either all of the messages or none of them.
+//
+// Appending more than one message requires support for the MULTIAPPEND
+// extension.
+func (c *Client) MultiAppend(mailbox string) *MultiAppendCommand {
+	cmd := &MultiAppendCommand{}
+	cmd.enc = c.beginCommand("APPEND", cmd)
+	cmd.enc.SP().Mailbox(mailbox)
+	return cmd
+}
+
+// MultiAppendCommand is an APPEND command with multiple messages.
+type MultiAppendCommand struct {
+	cmd
+	enc  *commandEncoder
+	n    int
+	data imap.AppendData
+}
+
+// CreateMessage adds a message to the command.
+//
+// The caller must write the message contents and close the returned writer
+// before adding another message.
+func (cmd *MultiAppendCommand) CreateMessage(size int64, options *imap.AppendOptions) io.WriteCloser {
+	cmd.n++
+	cmd.enc.SP()
+	wc, utf8 := writeAppendMessage(cmd.enc, size, options)
+	if utf8 {
+		return &utf8MessageWriter{WriteCloser: wc, enc: cmd.enc}
+	}
+	return wc
+}
+
+// CatenateMessage adds a message built from parts to the command.
+//
+// Parts with a URL are copied by the server from existing messages, see
+// imap.MessageURL. Binary and UTF-8 messages are not supported.
+//
+// This requires support for the CATENATE extension.
+func (cmd *MultiAppendCommand) CatenateMessage(parts []imap.CatenatePart, options *imap.AppendOptions) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("imapclient: CATENATE requires at least one part")
+	} else if options != nil && (options.Binary || options.UTF8) {
+		return fmt.Errorf("imapclient: CATENATE doesn't support binary and UTF-8 messages")
+	}
+
+	cmd.n++
+	enc := cmd.enc
+	enc.SP()
+	writeAppendOptions(enc, options)
+	enc.Atom("CATENATE").SP().Special('(')
+	for i, part := range parts {
+		if i > 0 {
+			enc.SP()
+		}
+		if part.URL != "" {
+			enc.Atom("URL").SP().String(part.URL)
+			continue
+		}
+		enc.Atom("TEXT").SP()
+		wc := enc.Literal(int64(len(part.Text)))
+		_, writeErr := wc.Write(part.Text)
+		closeErr := wc.Close()
+		if writeErr != nil {
+			return writeErr
+		} else if closeErr != nil {
+			return closeErr
+		}
+	}
+	enc.Special(')')
+	return nil
+}
+
+// Close sends the command.
+//
+// At least one message must have been added.
+func (cmd *MultiAppendCommand) Close() error {
+	if cmd.enc == nil {
+		return fmt.Errorf("imapclient: MultiAppendCommand closed twice")
+	}
+	cmd.enc.end()
+	cmd.enc = nil
+	if cmd.n == 0 {
+		return fmt.Errorf("imapclient: APPEND command without any message")
+	}
+	return nil
+}
+
+func (cmd *MultiAppendCommand) Wait() (*imap.AppendData, error) {
+	return &cmd.data, cmd.cmd.Wait()
+}
+
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *MultiAppendCommand) WaitContext(ctx context.Context) (*imap.AppendData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
+// utf8MessageWriter writes the closing parenthesis of a UTF8 message.
+type utf8MessageWriter struct {
+	io.WriteCloser
+	enc *commandEncoder
+}
+
+func (w *utf8MessageWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.enc.Special(')')
+	return err
+}
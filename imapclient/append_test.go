@@ -0,0 +1,147 @@
+package imapclient_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func numMessages(t *testing.T, client *imapclient.Client, mailbox string) uint32 {
+	data, err := client.Status(mailbox, []imap.StatusItem{imap.StatusItemNumMessages}).Wait()
+	if err != nil {
+		t.Fatalf("Status(%q) = %v", mailbox, err)
+	}
+	return *data.NumMessages
+}
+
+func TestMultiAppend(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	cmd := client.MultiAppend("INBOX")
+	for i := 0; i < 2; i++ {
+		w := cmd.CreateMessage(int64(len(simpleRawMessage)), &imap.AppendOptions{
+			Flags: []imap.Flag{imap.FlagSeen},
+		})
+		w.Write([]byte(simpleRawMessage))
+		if err := w.Close(); err != nil {
+			t.Fatalf("CreateMessage().Close() = %v", err)
+		}
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatalf("MultiAppendCommand.Close() = %v", err)
+	}
+	data, err := cmd.Wait()
+	if err != nil {
+		t.Fatalf("MultiAppend() = %v", err)
+	}
+	if data.UIDValidity == 0 || data.UID != 0 || data.UIDs.String() != "2:3" {
+		t.Errorf("MultiAppend() = UIDVALIDITY %v, UID %v, UIDs %v, want UIDs 2:3", data.UIDValidity, data.UID, data.UIDs)
+	}
+	if n := numMessages(t, client, "INBOX"); n != 3 {
+		t.Errorf("INBOX has %v messages, want 3", n)
+	}
+
+	// None of the messages are appended if one of them is rejected
+	cmd = client.MultiAppend("INBOX")
+	w := cmd.CreateMessage(int64(len(simpleRawMessage)), nil)
+	w.Write([]byte(simpleRawMessage))
+	if err := w.Close(); err != nil {
+		t.Fatalf("CreateMessage().Close() = %v", err)
+	}
+	badURL := &imap.MessageURL{Mailbox: "INBOX", UID: 42}
+	if err := cmd.CatenateMessage([]imap.CatenatePart{{URL: badURL.String()}}, nil); err != nil {
+		t.Fatalf("CatenateMessage() = %v", err)
+	}
+	cmd.Close()
+	_, err = cmd.Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadURL {
+		t.Errorf("MultiAppend() = %v, want BADURL", err)
+	}
+	if n := numMessages(t, client, "INBOX"); n != 3 {
+		t.Errorf("INBOX has %v messages after failed APPEND, want 3", n)
+	}
+}
+
+func TestCatenate(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	selectData, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	header := "Subject: Fwd: letter\r\n\r\n"
+	url := &imap.MessageURL{
+		Mailbox:     "INBOX",
+		UIDValidity: selectData.UIDValidity,
+		UID:         1,
+		Specifier:   imap.PartSpecifierText,
+	}
+	cmd := client.MultiAppend("INBOX")
+	parts := []imap.CatenatePart{
+		{Text: []byte(header)},
+		{URL: url.String()},
+	}
+	if err := cmd.CatenateMessage(parts, nil); err != nil {
+		t.Fatalf("CatenateMessage() = %v", err)
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatalf("MultiAppendCommand.Close() = %v", err)
+	}
+	data, err := cmd.Wait()
+	if err != nil {
+		t.Fatalf("Catenate() = %v", err)
+	} else if data.UID != 2 {
+		t.Errorf("Catenate() = UID %v, want 2", data.UID)
+	}
+
+	section := &imap.FetchItemBodySection{Peek: true}
+	msgs, err := client.Fetch(imap.SeqSetNum(2), []imap.FetchItem{section}, nil).Collect()
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	} else if len(msgs) != 1 || len(msgs[0].BodySection) != 1 {
+		t.Fatalf("Fetch() = %v messages, want 1 message with 1 section", len(msgs))
+	}
+	want := header + "This is my letter!"
+	for _, b := range msgs[0].BodySection {
+		if string(b) != want {
+			t.Errorf("Fetch(BODY[]) = %q, want %q", b, want)
+		}
+	}
+}
+
+func TestCatenate_appendLimit(t *testing.T) {
+	client, server := newClientServerPair(t, nil, &testServerOptions{
+		Options: imapserver.Options{AppendLimit: uint32(len(simpleRawMessage) + 10)},
+	})
+	defer client.Close()
+	defer server.Close()
+
+	// Each part is below the limit, but not the whole message
+	url := &imap.MessageURL{Mailbox: "INBOX", UID: 1}
+	cmd := client.MultiAppend("INBOX")
+	parts := []imap.CatenatePart{
+		{URL: url.String()},
+		{URL: url.String()},
+	}
+	if err := cmd.CatenateMessage(parts, nil); err != nil {
+		t.Fatalf("CatenateMessage() = %v", err)
+	}
+	cmd.Close()
+	_, err := cmd.Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTooBig {
+		t.Errorf("Catenate() = %v, want TOOBIG", err)
+	}
+	if n := numMessages(t, client, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %v messages after failed APPEND, want 1", n)
+	}
+}
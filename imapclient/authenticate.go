@@ -7,11 +7,17 @@ import (
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/scram"
 )
 
 // Authenticate sends an AUTHENTICATE command.
 //
 // Unlike other commands, this method blocks until the SASL exchange completes.
+//
+// If the SASL client fails to process a server challenge, the exchange is
+// aborted and the SASL client error is returned. For instance, a
+// *sasl.OAuthBearerError is returned if the server rejects an OAUTHBEARER
+// token.
 func (c *Client) Authenticate(saslClient sasl.Client) error {
 	mech, initialResp, err := saslClient.Start()
 	if err != nil {
@@ -61,6 +67,10 @@ func (c *Client) Authenticate(saslClient sasl.Client) error {
 
 		resp, err := saslClient.Next(challenge)
 		if err != nil {
+			// Abort the exchange, so that the server completes the command
+			if c.writeSASLCancel() == nil {
+				cmd.Wait()
+			}
 			return err
 		}
 
@@ -85,3 +95,65 @@ func (c *Client) writeSASLResp(resp []byte) error {
 	}
 	return nil
 }
+
+func (c *Client) writeSASLCancel() error {
+	if _, err := c.bw.WriteString("*\r\n"); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// Credentials contains credentials for Client.AuthenticateAuto.
+type Credentials struct {
+	Username string
+	// Password is used with the SCRAM-SHA-256 and PLAIN mechanisms, and with
+	// the LOGIN command.
+	Password string
+	// Token is an OAuth 2.0 bearer token, used with the OAUTHBEARER
+	// mechanism.
+	Token string
+}
+
+// AuthenticateAuto authenticates with the strongest method supported by the
+// server.
+//
+// Methods are picked in this order of preference: the SCRAM-SHA-256,
+// OAUTHBEARER and PLAIN SASL mechanisms, then the LOGIN command. Methods
+// requiring credentials which are missing are skipped. The LOGIN command is
+// only used if the server doesn't advertise LOGINDISABLED.
+//
+// If the server rejects an OAuth token, a *sasl.OAuthBearerError is returned.
+func (c *Client) AuthenticateAuto(creds *Credentials) error {
+	caps := c.Caps()
+	hasMech := func(mech string) bool {
+		return caps.Has(imap.Cap("AUTH=" + mech))
+	}
+
+	switch {
+	case creds.Password != "" && hasMech(scram.SHA256.Name):
+		return c.Authenticate(scram.NewClient(scram.SHA256, creds.Username, creds.Password))
+	case creds.Token != "" && hasMech(sasl.OAuthBearer):
+		return c.Authenticate(sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+			Username: creds.Username,
+			Token:    creds.Token,
+		}))
+	case creds.Password != "" && hasMech(sasl.Plain):
+		return c.Authenticate(sasl.NewPlainClient("", creds.Username, creds.Password))
+	case creds.Password != "" && !caps.Has(imap.CapLoginDisabled):
+		return c.Login(creds.Username, creds.Password).Wait()
+	default:
+		return fmt.Errorf("imapclient: no supported authentication method (server supports %v)", caps.AuthMechanisms())
+	}
+}
+
+// NewSCRAMClient creates a SASL client for the SCRAM-SHA-1 or SCRAM-SHA-256
+// mechanism, as defined in RFC 5802 and RFC 7677.
+//
+// Channel binding isn't supported.
+func NewSCRAMClient(mech, username, password string) (sasl.Client, error) {
+	m := scram.Lookup(mech)
+	if m == nil {
+		return nil, fmt.Errorf("imapclient: unsupported SCRAM mechanism %q", mech)
+	}
+	return scram.NewClient(m, username, password), nil
+}
@@ -0,0 +1,99 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+var binaryTestMessage = strings.Join([]string{
+	"Subject: Binary",
+	"Content-Type: multipart/mixed; boundary=frontier",
+	"",
+	"--frontier",
+	"Content-Type: text/plain",
+	"Content-Transfer-Encoding: quoted-printable",
+	"",
+	"caf=C3=A9",
+	"--frontier",
+	"Content-Type: application/octet-stream",
+	"Content-Transfer-Encoding: base64",
+	"",
+	"AAECAw==",
+	"--frontier",
+	"Content-Type: application/octet-stream",
+	"Content-Transfer-Encoding: binary",
+	"",
+	"\x00\xff",
+	"--frontier",
+	"Content-Type: application/octet-stream",
+	"Content-Transfer-Encoding: x-unknown",
+	"",
+	"???",
+	"--frontier--",
+	"",
+}, "\r\n")
+
+func TestBinary(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if !client.Caps().Has(imap.CapBinary) {
+		t.Fatalf("BINARY not advertised")
+	}
+
+	if err := appendMessage(client, "INBOX", binaryTestMessage, &imap.AppendOptions{Binary: true}); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	for _, tc := range []struct {
+		part []int
+		want []byte
+	}{
+		{[]int{1}, []byte("caf\xc3\xa9")},
+		{[]int{2}, []byte{0, 1, 2, 3}},
+		{[]int{3}, []byte{0, 0xff}},
+	} {
+		items := []imap.FetchItem{
+			&imap.FetchItemBinarySection{Part: tc.part, Peek: true},
+			&imap.FetchItemBinarySectionSize{Part: tc.part},
+		}
+		msgs, err := client.Fetch(imap.SeqSetNum(2), items, nil).Collect()
+		if err != nil {
+			t.Fatalf("Fetch(BINARY%v) = %v", tc.part, err)
+		} else if len(msgs) != 1 {
+			t.Fatalf("Fetch(BINARY%v) returned %v messages, want 1", tc.part, len(msgs))
+		}
+		msg := msgs[0]
+
+		if len(msg.BinarySection) != 1 {
+			t.Fatalf("Fetch(BINARY%v) returned %v sections, want 1", tc.part, len(msg.BinarySection))
+		}
+		for _, b := range msg.BinarySection {
+			if !bytes.Equal(b, tc.want) {
+				t.Errorf("Fetch(BINARY%v) = %q, want %q", tc.part, b, tc.want)
+			}
+		}
+
+		if len(msg.BinarySectionSize) != 1 {
+			t.Fatalf("Fetch(BINARY.SIZE%v) returned %v sizes, want 1", tc.part, len(msg.BinarySectionSize))
+		} else if size := msg.BinarySectionSize[0].Size; size != uint32(len(tc.want)) {
+			t.Errorf("Fetch(BINARY.SIZE%v) = %v, want %v", tc.part, size, len(tc.want))
+		}
+	}
+
+	items := []imap.FetchItem{&imap.FetchItemBinarySection{Part: []int{4}, Peek: true}}
+	_, err := client.Fetch(imap.SeqSetNum(2), items, nil).Collect()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeUnknownCTE {
+		t.Errorf("Fetch(BINARY[4]) = %v, want UNKNOWN-CTE error", err)
+	}
+}
@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
@@ -37,6 +38,15 @@ func (cmd *CapabilityCommand) Wait() (imap.CapSet, error) {
 	return cmd.caps, err
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *CapabilityCommand) WaitContext(ctx context.Context) (imap.CapSet, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 func readCapabilities(dec *imapwire.Decoder) (imap.CapSet, error) {
 	caps := make(imap.CapSet)
 	for dec.SP() {
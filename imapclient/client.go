@@ -3,6 +3,7 @@ package imapclient
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -19,12 +20,12 @@ import (
 )
 
 const (
-	idleReadTimeout    = time.Duration(0)
-	respReadTimeout    = 30 * time.Second
-	literalReadTimeout = 5 * time.Minute
+	idleReadTimeout        = time.Duration(0)
+	defaultRespReadTimeout = 30 * time.Second
+	literalReadTimeout     = 5 * time.Minute
 
-	cmdWriteTimeout     = 30 * time.Second
-	literalWriteTimeout = 5 * time.Minute
+	defaultCmdWriteTimeout = 30 * time.Second
+	literalWriteTimeout    = 5 * time.Minute
 )
 
 // SelectedMailbox contains metadata for the currently selected mailbox.
@@ -50,6 +51,12 @@ type Options struct {
 	UnilateralDataHandler *UnilateralDataHandler
 	// Decoder for RFC 2047 words.
 	WordDecoder *mime.WordDecoder
+	// ReadTimeout is the maximum duration to wait for the rest of a response
+	// once the server has started sending it. If zero, 30 seconds is used.
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum duration to wait for a command to be
+	// written. If zero, 30 seconds is used.
+	WriteTimeout time.Duration
 }
 
 func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
@@ -77,6 +84,20 @@ func (options *Options) decodeText(s string) (string, error) {
 	return out, nil
 }
 
+func (options *Options) respReadTimeout() time.Duration {
+	if options.ReadTimeout > 0 {
+		return options.ReadTimeout
+	}
+	return defaultRespReadTimeout
+}
+
+func (options *Options) cmdWriteTimeout() time.Duration {
+	if options.WriteTimeout > 0 {
+		return options.WriteTimeout
+	}
+	return defaultCmdWriteTimeout
+}
+
 func (options *Options) unilateralDataHandler() *UnilateralDataHandler {
 	if options.UnilateralDataHandler == nil {
 		return &UnilateralDataHandler{}
@@ -98,6 +119,7 @@ func (options *Options) unilateralDataHandler() *UnilateralDataHandler {
 // Authenticate, Idle) block the client during their execution.
 type Client struct {
 	conn     net.Conn
+	rwConn   net.Conn // conn, possibly wrapped by STARTTLS or COMPRESS
 	options  Options
 	br       *bufio.Reader
 	bw       *bufio.Writer
@@ -114,10 +136,12 @@ type Client struct {
 	mutex       sync.Mutex
 	state       imap.ConnState
 	caps        imap.CapSet
+	enabled     imap.CapSet
 	mailbox     *SelectedMailbox
 	cmdTag      uint64
 	pendingCmds []command
 	contReqs    []continuationRequest
+	watcher     *Watcher
 	closed      bool
 }
 
@@ -137,6 +161,7 @@ func New(conn net.Conn, options *Options) *Client {
 
 	client := &Client{
 		conn:       conn,
+		rwConn:     conn,
 		options:    *options,
 		br:         br,
 		bw:         bw,
@@ -151,9 +176,19 @@ func New(conn net.Conn, options *Options) *Client {
 
 // DialTLS connects to an IMAP server with implicit TLS.
 func DialTLS(address string, options *Options) (*Client, error) {
-	conn, err := tls.Dial("tcp", address, &tls.Config{
-		NextProtos: []string{"imap"},
-	})
+	return DialTLSContext(context.Background(), address, options)
+}
+
+// DialTLSContext is like DialTLS, but ctx is used to connect to the server.
+//
+// Once the client has been returned, cancelling ctx has no effect.
+func DialTLSContext(ctx context.Context, address string, options *Options) (*Client, error) {
+	dialer := tls.Dialer{
+		Config: &tls.Config{
+			NextProtos: []string{"imap"},
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return nil, err
 	}
@@ -162,18 +197,32 @@ func DialTLS(address string, options *Options) (*Client, error) {
 
 // DialStartTLS connects to an IMAP server with STARTTLS.
 func DialStartTLS(address string, options *Options) (*Client, error) {
+	return DialStartTLSContext(context.Background(), address, options)
+}
+
+// DialStartTLSContext is like DialStartTLS, but ctx is used to connect to
+// the server and to negotiate TLS.
+//
+// Once the client has been returned, cancelling ctx has no effect.
+func DialStartTLSContext(ctx context.Context, address string, options *Options) (*Client, error) {
 	host, _, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.Dial("tcp", address)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
 	client := New(conn, options)
-	if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+	stop := closeOnDone(ctx, conn)
+	err = client.StartTLS(&tls.Config{ServerName: host})
+	if stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
@@ -219,6 +268,23 @@ func (c *Client) setState(state imap.ConnState) {
 	c.mutex.Unlock()
 }
 
+// currentWatcher returns the mailbox watcher, if any.
+func (c *Client) currentWatcher() *Watcher {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.watcher
+}
+
+// unilateralDataHandler returns the handler for unilateral data, including
+// the watcher's if any.
+func (c *Client) unilateralDataHandler() *UnilateralDataHandler {
+	handler := c.options.unilateralDataHandler()
+	if watcher := c.currentWatcher(); watcher != nil {
+		handler = watcher.wrapHandler(handler)
+	}
+	return handler
+}
+
 // Caps returns the capabilities advertised by the server.
 //
 // When the server hasn't sent the capability list, this method will request it
@@ -292,25 +358,29 @@ func (c *Client) beginCommand(name string, cmd command) *commandEncoder {
 	c.mutex.Lock()
 	c.cmdTag++
 	tag := fmt.Sprintf("T%v", c.cmdTag)
+	// Initialize the command before it's visible to the decoder goroutine,
+	// which may complete it at any time if the connection fails
+	baseCmd := cmd.base()
+	*baseCmd = Command{
+		tag:  tag,
+		done: make(chan error, 1),
+	}
 	c.pendingCmds = append(c.pendingCmds, cmd)
-	quotedUTF8 := c.caps.Has(imap.CapIMAP4rev2) || c.caps.Has(imap.CapUTF8Accept)
+	utf8Accept := c.enabled.Has(imap.CapUTF8Accept)
+	quotedUTF8 := c.caps.Has(imap.CapIMAP4rev2) || utf8Accept
 	literalMinus := c.caps.Has(imap.CapLiteralMinus)
 	c.mutex.Unlock()
 
-	c.setWriteTimeout(cmdWriteTimeout)
+	c.setWriteTimeout(c.options.cmdWriteTimeout())
 
 	wireEnc := imapwire.NewEncoder(c.bw, imapwire.ConnSideClient)
 	wireEnc.QuotedUTF8 = quotedUTF8
+	wireEnc.MailboxUTF8 = utf8Accept
 	wireEnc.LiteralMinus = literalMinus
 	wireEnc.NewContinuationRequest = func() *imapwire.ContinuationRequest {
 		return c.registerContReq(cmd)
 	}
 
-	baseCmd := cmd.base()
-	*baseCmd = Command{
-		tag:  tag,
-		done: make(chan error, 1),
-	}
 	enc := &commandEncoder{
 		Encoder: wireEnc,
 		client:  c,
@@ -464,6 +534,11 @@ func (c *Client) read() {
 		for _, cmd := range pendingCmds {
 			c.completeCommand(cmd, cmdErr)
 		}
+
+		if !c.greetingRecv {
+			c.greetingErr = cmdErr
+			close(c.greetingCh)
+		}
 	}()
 
 	c.setReadTimeout(idleReadTimeout)
@@ -482,7 +557,7 @@ func (c *Client) read() {
 }
 
 func (c *Client) readResponse() error {
-	c.setReadTimeout(respReadTimeout)
+	c.setReadTimeout(c.options.respReadTimeout())
 	defer c.setReadTimeout(idleReadTimeout)
 
 	if c.dec.Special('+') {
@@ -504,14 +579,14 @@ func (c *Client) readResponse() error {
 	}
 
 	var (
-		token    string
-		err      error
-		startTLS *startTLSCommand
+		token   string
+		err     error
+		upgrade upgradeCommand
 	)
 	if tag != "" {
 		token = "response-tagged"
-		startTLS, err = c.readResponseTagged(tag, typ)
-	} else if typ == "BYE" {
+		upgrade, err = c.readResponseTagged(tag, typ)
+	} else if typ == "BYE" && c.greetingRecv {
 		token = "resp-cond-bye"
 		var text string
 		if !c.dec.ExpectText(&text) {
@@ -529,9 +604,8 @@ func (c *Client) readResponse() error {
 		return fmt.Errorf("in response: %v", c.dec.Err())
 	}
 
-	if startTLS != nil {
-		c.upgradeStartTLS(startTLS.tlsConfig)
-		close(startTLS.upgradeDone)
+	if upgrade != nil {
+		upgrade.upgrade(c)
 	}
 
 	return nil
@@ -562,7 +636,7 @@ func (c *Client) readContinueReq() error {
 	return nil
 }
 
-func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
+func (c *Client) readResponseTagged(tag, typ string) (upgradeCommand, error) {
 	cmd := c.deletePendingCmdByTag(tag)
 	if cmd == nil {
 		return nil, fmt.Errorf("received tagged response with unknown tag %q", tag)
@@ -585,13 +659,25 @@ func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
 			}
 			c.setCaps(caps)
 		case "APPENDUID":
-			var uidValidity, uid uint32
-			if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) || !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uid) {
+			var uidValidity uint32
+			var uids imap.SeqSet
+			if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) || !c.dec.ExpectSP() || !c.dec.ExpectSeqSet(&uids) {
 				return nil, fmt.Errorf("in resp-code-apnd: %v", c.dec.Err())
 			}
-			if cmd, ok := cmd.(*AppendCommand); ok {
-				cmd.data.UID = uid
-				cmd.data.UIDValidity = uidValidity
+			var data *imap.AppendData
+			switch cmd := cmd.(type) {
+			case *AppendCommand:
+				data = &cmd.data
+			case *MultiAppendCommand:
+				data = &cmd.data
+			}
+			if data != nil {
+				data.UIDValidity = uidValidity
+				data.UIDs = uids
+				// MULTIAPPEND returns a UID set
+				if nums, ok := uids.Nums(); ok && len(nums) == 1 {
+					data.UID = nums[0]
+				}
 			}
 		case "COPYUID":
 			if !c.dec.ExpectSP() {
@@ -606,6 +692,14 @@ func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
 				cmd.data.SourceUIDs = srcUIDs
 				cmd.data.DestUIDs = dstUIDs
 			}
+		case "MODIFIED":
+			var modified imap.SeqSet
+			if !c.dec.ExpectSP() || !c.dec.ExpectSeqSet(&modified) {
+				return nil, fmt.Errorf("in resp-code-modified: %v", c.dec.Err())
+			}
+			if cmd, ok := cmd.(*FetchCommand); ok {
+				cmd.modified = modified
+			}
 		default: // [SP 1*<any TEXT-CHAR except "]">]
 			if c.dec.SP() {
 				c.dec.DiscardUntilByte(']')
@@ -636,9 +730,9 @@ func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
 
 	c.completeCommand(cmd, cmdErr)
 
-	var startTLS *startTLSCommand
-	if cmd, ok := cmd.(*startTLSCommand); ok && cmdErr == nil {
-		startTLS = cmd
+	var upgrade upgradeCommand
+	if cmd, ok := cmd.(upgradeCommand); ok && cmdErr == nil {
+		upgrade = cmd
 	}
 
 	if cmdErr == nil && code != "CAPABILITY" {
@@ -648,7 +742,7 @@ func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
 		}
 	}
 
-	return startTLS, nil
+	return upgrade, nil
 }
 
 func (c *Client) readResponseData(typ string) error {
@@ -703,7 +797,7 @@ func (c *Client) readResponseData(typ string) error {
 
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
 					cmd.data.PermanentFlags = flags
-				} else if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+				} else if handler := c.unilateralDataHandler().Mailbox; handler != nil {
 					handler(&UnilateralDataMailbox{PermanentFlags: flags})
 				}
 			case "UIDNEXT":
@@ -728,6 +822,17 @@ func (c *Client) readResponseData(typ string) error {
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
 					cmd.data.UIDValidity = uidValidity
 				}
+			case "HIGHESTMODSEQ":
+				if !c.dec.ExpectSP() {
+					return c.dec.Err()
+				}
+				var highestModSeq uint64
+				if !c.dec.ExpectModSeq(&highestModSeq) {
+					return c.dec.Err()
+				}
+				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+					cmd.data.HighestModSeq = highestModSeq
+				}
 			case "COPYUID":
 				if !c.dec.ExpectSP() {
 					return c.dec.Err()
@@ -789,6 +894,11 @@ func (c *Client) readResponseData(typ string) error {
 			return c.dec.Err()
 		}
 		return c.handleNamespace()
+	case "ID":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleID()
 	case "FLAGS":
 		if !c.dec.ExpectSP() {
 			return c.dec.Err()
@@ -815,6 +925,11 @@ func (c *Client) readResponseData(typ string) error {
 		return c.handleFetch(num)
 	case "EXPUNGE":
 		return c.handleExpunge(num)
+	case "VANISHED":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleVanished()
 	case "SEARCH":
 		return c.handleSearch()
 	case "ESEARCH":
@@ -838,6 +953,21 @@ func (c *Client) readResponseData(typ string) error {
 			return c.dec.Err()
 		}
 		return c.handleQuotaRoot()
+	case "ACL":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleACL()
+	case "LISTRIGHTS":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleListRights()
+	case "MYRIGHTS":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleMyRights()
 	default:
 		return fmt.Errorf("unsupported response type %q", typ)
 	}
@@ -959,13 +1089,29 @@ func (ce *commandEncoder) flush() {
 
 // Literal encodes a literal.
 func (ce *commandEncoder) Literal(size int64) io.WriteCloser {
+	return ce.literal(size, false)
+}
+
+// Literal8 writes a literal8, which may contain NUL bytes. It requires
+// BINARY.
+func (ce *commandEncoder) Literal8(size int64) io.WriteCloser {
+	return ce.literal(size, true)
+}
+
+func (ce *commandEncoder) literal(size int64, binary bool) io.WriteCloser {
 	var contReq *imapwire.ContinuationRequest
 	if size > 4096 || !ce.client.Caps().Has(imap.CapLiteralMinus) {
 		contReq = ce.client.registerContReq(ce.cmd)
 	}
 	ce.client.setWriteTimeout(literalWriteTimeout)
+	var wc io.WriteCloser
+	if binary {
+		wc = ce.Encoder.Literal8(size, contReq)
+	} else {
+		wc = ce.Encoder.Literal(size, contReq)
+	}
 	return literalWriter{
-		WriteCloser: ce.Encoder.Literal(size, contReq),
+		WriteCloser: wc,
 		client:      ce.client,
 	}
 }
@@ -976,7 +1122,7 @@ type literalWriter struct {
 }
 
 func (lw literalWriter) Close() error {
-	lw.client.setWriteTimeout(cmdWriteTimeout)
+	lw.client.setWriteTimeout(lw.client.options.cmdWriteTimeout())
 	return lw.WriteCloser.Close()
 }
 
@@ -1008,6 +1154,17 @@ type UnilateralDataHandler struct {
 	Expunge func(seqNum uint32)
 	Mailbox func(data *UnilateralDataMailbox)
 	Fetch   func(msg *FetchMessageData)
+
+	// Vanished is called when the server reports expunged messages by UID.
+	// If earlier is true, the messages have been expunged before the current
+	// command (e.g. in response to SELECT with QRESYNC or UID FETCH with
+	// VANISHED). Requires QRESYNC.
+	Vanished func(uids imap.SeqSet, earlier bool)
+
+	// Status and List are called when the server sends mailbox-level
+	// updates for mailboxes other than the selected one. Requires NOTIFY.
+	Status func(data *imap.StatusData)
+	List   func(data *imap.ListData)
 }
 
 // command is an interface for IMAP commands.
@@ -1018,6 +1175,16 @@ type command interface {
 	base() *Command
 }
 
+// upgradeCommand is a command which upgrades the connection once completed
+// successfully, e.g. STARTTLS or COMPRESS.
+//
+// upgrade is called from the decoder goroutine, while the command issuer
+// holds the encoder lock.
+type upgradeCommand interface {
+	command
+	upgrade(c *Client)
+}
+
 // Command is a basic IMAP command.
 type Command struct {
 	tag  string
@@ -1,12 +1,165 @@
 package imapclient_test
 
 import (
+	"crypto/tls"
 	"log"
+	"net"
+	"strings"
+	"testing"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
+const (
+	testUsername = "test-user"
+	testPassword = "test-password"
+)
+
+var simpleRawMessage = strings.Join([]string{
+	"MIME-Version: 1.0",
+	"Message-Id: <191101702316132@example.com>",
+	"Content-Transfer-Encoding: 8bit",
+	"Content-Type: text/plain; charset=utf-8",
+	"",
+	"This is my letter!",
+}, "\r\n")
+
+// testCaps are the capabilities advertised by newTestServer by default.
+var testCaps = imap.CapSet{
+	imap.CapIMAP4rev1:       {},
+	imap.CapIMAP4rev2:       {},
+	imap.CapCondStore:       {},
+	imap.CapQResync:         {},
+	imap.CapSort:            {},
+	"THREAD=ORDEREDSUBJECT": {},
+	"THREAD=REFERENCES":     {},
+	imap.CapMetadata:        {},
+	imap.CapID:              {},
+	imap.CapCompressDeflate: {},
+	imap.CapACL:             {},
+	imap.CapBinary:          {},
+	imap.CapUTF8Accept:      {},
+	imap.CapNotify:          {},
+	imap.CapMultiAppend:     {},
+	imap.CapCatenate:        {},
+}
+
+// testServerOptions contains options for newTestServer.
+type testServerOptions struct {
+	// Server options. NewSession and InsecureAuth are set by newTestServer.
+	// If Caps is nil, testCaps is used.
+	imapserver.Options
+	// If set, WrapSession is called for each new session. Wrappers which
+	// don't expose all imapmemserver features need to restrict Caps.
+	WrapSession func(conn *imapserver.Conn, session imapserver.Session) imapserver.Session
+	// If set, the server expects clients to use implicit TLS.
+	ImplicitTLS *tls.Config
+}
+
+// testServer is an in-memory IMAP server started by newTestServer.
+type testServer struct {
+	*imapserver.Server
+	addr string
+	user *imapmemserver.User
+}
+
+// newTestServer starts an in-memory IMAP server with a single user,
+// testUsername, which has an empty INBOX.
+func newTestServer(t *testing.T, options *testServerOptions) *testServer {
+	if options == nil {
+		options = &testServerOptions{}
+	}
+
+	memServer := imapmemserver.New()
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create(INBOX) = %v", err)
+	}
+	memServer.AddUser(user)
+
+	serverOptions := options.Options
+	serverOptions.NewSession = func(conn *imapserver.Conn) (imapserver.Session, error) {
+		var session imapserver.Session = memServer.NewSession()
+		if options.WrapSession != nil {
+			session = options.WrapSession(conn, session)
+		}
+		return session, nil
+	}
+	if serverOptions.Caps == nil {
+		serverOptions.Caps = testCaps
+	}
+	if serverOptions.ID == nil {
+		serverOptions.ID = map[string]string{"name": "imapmemserver"}
+	}
+	serverOptions.InsecureAuth = true
+	server := imapserver.New(&serverOptions)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	if options.ImplicitTLS != nil {
+		ln = tls.NewListener(ln, options.ImplicitTLS)
+	}
+	go server.Serve(ln)
+
+	return &testServer{Server: server, addr: ln.Addr().String(), user: user}
+}
+
+// dial connects a new client to the server, without logging in.
+func (s *testServer) dial(t *testing.T, options *imapclient.Options) *imapclient.Client {
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	return imapclient.New(conn, options)
+}
+
+// newClientServerPair starts an in-memory IMAP server and returns a client
+// logged in as testUsername. The INBOX contains a single message.
+//
+// If serverOptions is nil, concurrent commands are enabled.
+func newClientServerPair(t *testing.T, options *imapclient.Options, serverOptions *testServerOptions) (*imapclient.Client, *testServer) {
+	if serverOptions == nil {
+		serverOptions = &testServerOptions{
+			Options: imapserver.Options{ConcurrentCommands: true},
+		}
+	}
+	server := newTestServer(t, serverOptions)
+
+	client := server.dial(t, options)
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		client.Close()
+		server.Close()
+		t.Fatalf("Login() = %v", err)
+	}
+
+	if err := appendMessage(client, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	return client, server
+}
+
+// appendMessage appends a message to a mailbox and waits for the command to
+// complete.
+func appendMessage(client *imapclient.Client, mailbox, msg string, options *imap.AppendOptions) error {
+	appendCmd := client.Append(mailbox, int64(len(msg)), options)
+	_, writeErr := appendCmd.Write([]byte(msg))
+	closeErr := appendCmd.Close()
+	// If the server rejects the message, its response is more useful than
+	// the write error
+	if _, err := appendCmd.Wait(); err != nil {
+		return err
+	} else if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
 func ExampleClient() {
 	c, err := imapclient.DialTLS("mail.example.org:993", nil)
 	if err != nil {
@@ -27,7 +180,7 @@ func ExampleClient() {
 		log.Printf(" - %v", mbox.Mailbox)
 	}
 
-	selectedMbox, err := c.Select("INBOX").Wait()
+	selectedMbox, err := c.Select("INBOX", nil).Wait()
 	if err != nil {
 		log.Fatalf("failed to select INBOX: %v", err)
 	}
@@ -36,7 +189,7 @@ func ExampleClient() {
 	if selectedMbox.NumMessages > 0 {
 		seqSet := imap.SeqSetNum(1)
 		fetchItems := []imap.FetchItem{imap.FetchItemEnvelope}
-		messages, err := c.Fetch(seqSet, fetchItems).Collect()
+		messages, err := c.Fetch(seqSet, fetchItems, nil).Collect()
 		if err != nil {
 			log.Fatalf("failed to fetch first message in INBOX: %v", err)
 		}
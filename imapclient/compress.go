@@ -0,0 +1,66 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/emersion/go-imap/v2/internal"
+)
+
+// Compress sends a COMPRESS command to enable DEFLATE compression.
+//
+// Unlike other commands, this method blocks until the command completes.
+//
+// This command requires support for the COMPRESS=DEFLATE extension.
+func (c *Client) Compress() error {
+	upgradeDone := make(chan struct{})
+	cmd := &compressCommand{upgradeDone: upgradeDone}
+	enc := c.beginCommand("COMPRESS", cmd)
+	enc.SP().Atom("DEFLATE")
+	enc.flush()
+	defer enc.end()
+
+	// The client must not send any further commands until the compression
+	// layer is in place
+
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+
+	// The decoder goroutine will invoke Client.upgradeCompress
+	<-upgradeDone
+	return nil
+}
+
+func (c *Client) upgradeCompress() {
+	// Drain buffered data from our bufio.Reader
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(c.br.Buffered())); err != nil {
+		panic(err) // unreachable
+	}
+
+	var r io.Reader = c.rwConn
+	if buf.Len() > 0 {
+		r = io.MultiReader(&buf, c.rwConn)
+	}
+
+	compressConn := internal.NewDeflateConn(c.rwConn, r)
+	c.rwConn = compressConn
+	rw := c.options.wrapReadWriter(compressConn)
+
+	c.br.Reset(rw)
+	// Unfortunately we can't re-use the bufio.Writer here, it races with
+	// Client.Compress
+	c.bw = bufio.NewWriter(rw)
+}
+
+type compressCommand struct {
+	cmd
+	upgradeDone chan<- struct{}
+}
+
+func (cmd *compressCommand) upgrade(c *Client) {
+	c.upgradeCompress()
+	close(cmd.upgradeDone)
+}
@@ -0,0 +1,82 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// lockedBuffer is a bytes.Buffer safe to write to from multiple goroutines.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestCompress(t *testing.T) {
+	var debug lockedBuffer
+	serverConns := make(chan *imapserver.Conn, 1)
+	client, server := newClientServerPair(t, &imapclient.Options{DebugWriter: &debug}, &testServerOptions{
+		Options: imapserver.Options{ConcurrentCommands: true},
+		WrapSession: func(conn *imapserver.Conn, session imapserver.Session) imapserver.Session {
+			serverConns <- conn
+			return session
+		},
+	})
+	defer client.Close()
+	defer server.Close()
+
+	if err := client.Compress(); err != nil {
+		t.Fatalf("Compress() = %v", err)
+	}
+
+	// NetConn returns the underlying connection, not the compressed one
+	serverConn := <-serverConns
+	if _, ok := serverConn.NetConn().(*net.TCPConn); !ok {
+		t.Errorf("Conn.NetConn() = %T, want *net.TCPConn", serverConn.NetConn())
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	items := []imap.FetchItem{&imap.FetchItemBodySection{}}
+	msgs, err := client.Fetch(imap.SeqSetNum(1), items, nil).Collect()
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch() returned %v messages, want 1", len(msgs))
+	}
+	var body []byte
+	for _, b := range msgs[0].BodySection {
+		body = b
+	}
+	if string(body) != simpleRawMessage {
+		t.Errorf("Fetch() body = %q, want %q", body, simpleRawMessage)
+	}
+
+	// The debug writer sees decompressed traffic
+	if !strings.Contains(debug.String(), "This is my letter!") {
+		t.Errorf("debug output doesn't contain the decompressed message body")
+	}
+
+	if err := client.Compress(); err == nil {
+		t.Errorf("Compress() succeeded while compression is already active")
+	}
+}
@@ -0,0 +1,60 @@
+package imapclient_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestConcurrentCommands(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	// Pipeline commands which the server may execute concurrently
+	items := []imap.FetchItem{imap.FetchItemFlags, imap.FetchItemUID}
+	statusCmd := client.Status("INBOX", []imap.StatusItem{imap.StatusItemNumMessages})
+	searchCmd := client.Search(&imap.SearchCriteria{}, nil)
+	fetch1 := client.Fetch(imap.SeqSetNum(1), items, nil)
+	fetch2 := client.UIDFetch(imap.SeqSetNum(1), items, nil)
+	bodyCmd := client.Fetch(imap.SeqSetNum(1), []imap.FetchItem{&imap.FetchItemBodySection{}}, nil)
+	seenCmd := client.Search(&imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}, nil)
+
+	statusData, err := statusCmd.Wait()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if statusData.NumMessages == nil || *statusData.NumMessages != 1 {
+		t.Errorf("Status().NumMessages = %v, want 1", statusData.NumMessages)
+	}
+	if searchData, err := searchCmd.Wait(); err != nil {
+		t.Fatalf("Search() = %v", err)
+	} else if len(searchData.AllNums()) != 1 {
+		t.Errorf("Search() = %v, want 1 message", searchData.AllNums())
+	}
+	// FETCH responses may be interleaved, so consume them concurrently
+	fetchCmds := []*imapclient.FetchCommand{fetch1, fetch2, bodyCmd}
+	errCh := make(chan error, len(fetchCmds))
+	for _, cmd := range fetchCmds {
+		go func(cmd *imapclient.FetchCommand) {
+			errCh <- cmd.Close()
+		}(cmd)
+	}
+	for range fetchCmds {
+		if err := <-errCh; err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+	}
+
+	// The FETCH BODY[] command implicitly sets the \Seen flag: the following
+	// SEARCH command must observe the change
+	if searchData, err := seenCmd.Wait(); err != nil {
+		t.Fatalf("Search() = %v", err)
+	} else if len(searchData.AllNums()) != 1 {
+		t.Errorf("Search(SEEN) = %v, want 1 message", searchData.AllNums())
+	}
+}
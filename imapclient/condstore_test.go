@@ -0,0 +1,135 @@
+package imapclient_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestCondStore(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	// HIGHESTMODSEQ is returned even if CONDSTORE isn't enabled
+	if data, err := client.Examine("INBOX").Wait(); err != nil {
+		t.Fatalf("Examine() = %v", err)
+	} else if data.HighestModSeq == 0 {
+		t.Errorf("SelectData.HighestModSeq = 0 without CONDSTORE")
+	}
+
+	data, err := client.Select("INBOX", &imap.SelectOptions{CondStore: true}).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	} else if data.HighestModSeq == 0 {
+		t.Fatalf("SelectData.HighestModSeq = 0")
+	}
+	highestModSeq := data.HighestModSeq
+
+	seqSet := imap.SeqSetNum(1)
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+	storeCmd := client.Store(seqSet, &storeFlags, &imap.StoreOptions{UnchangedSince: highestModSeq})
+	msgs, err := storeCmd.Collect()
+	if err != nil {
+		t.Fatalf("Store().Collect() = %v", err)
+	} else if len(msgs) != 1 || msgs[0].ModSeq <= highestModSeq {
+		t.Fatalf("Store().Collect() = %v, want a single message with a higher mod-sequence", msgs)
+	} else if len(storeCmd.Modified()) > 0 {
+		t.Errorf("Store().Modified() = %v, want empty", storeCmd.Modified())
+	}
+
+	storeCmd = client.Store(seqSet, &storeFlags, &imap.StoreOptions{UnchangedSince: highestModSeq})
+	if err := storeCmd.Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	} else if modified := storeCmd.Modified(); modified.String() != "1" {
+		t.Errorf("Store().Modified() = %v, want 1", modified)
+	}
+
+	fetchOptions := imap.FetchOptions{ChangedSince: highestModSeq}
+	msgs, err = client.Fetch(imap.SeqSetRange(1, 0), []imap.FetchItem{imap.FetchItemFlags}, &fetchOptions).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 || msgs[0].SeqNum != 1 {
+		t.Fatalf("Fetch().Collect() = %v, want message 1", msgs)
+	}
+}
+
+func TestQResync(t *testing.T) {
+	vanished := make(chan imap.SeqSet, 1)
+	expunged := make(chan imap.SeqSet, 16)
+	options := imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Vanished: func(uids imap.SeqSet, earlier bool) {
+				if earlier {
+					vanished <- uids
+				} else {
+					expunged <- uids
+				}
+			},
+			Expunge: func(seqNum uint32) {
+				t.Errorf("unexpected EXPUNGE %v with QRESYNC enabled", seqNum)
+			},
+		},
+	}
+	client, server := newClientServerPair(t, &options, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if err := appendMessage(client, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	if _, err := client.Enable(imap.CapQResync).Wait(); err != nil {
+		t.Fatalf("Enable() = %v", err)
+	}
+	data, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := client.Store(imap.SeqSetRange(1, 2), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if err := client.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge() = %v", err)
+	}
+
+	// Expunged messages are reported in a single VANISHED response
+	if len(expunged) != 1 {
+		t.Errorf("got %v VANISHED responses, want 1", len(expunged))
+	} else if uids := <-expunged; uids.String() != "1:2" {
+		t.Errorf("VANISHED = %v, want 1:2", uids)
+	}
+	if err := client.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect() = %v", err)
+	}
+
+	_, err = client.Select("INBOX", &imap.SelectOptions{
+		QResync: &imap.QResyncParams{
+			UIDValidity: data.UIDValidity,
+			ModSeq:      data.HighestModSeq,
+		},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	select {
+	case uids := <-vanished:
+		if uids.String() != "1:2" {
+			t.Errorf("VANISHED (EARLIER) = %v, want 1:2", uids)
+		}
+	default:
+		t.Errorf("no VANISHED (EARLIER) response received")
+	}
+}
@@ -0,0 +1,85 @@
+package imapclient
+
+import (
+	"context"
+	"net"
+)
+
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed.
+//
+// Cancelling ctx doesn't abort the command: the server can't be asked to stop
+// processing it. The command stays pending and its tag is still tracked by
+// the client. The server response is processed as usual once it arrives, and
+// Wait or WaitContext can be called again to retrieve it.
+func (cmd *Command) WaitContext(ctx context.Context) error {
+	if err := cmd.waitContext(ctx); err != nil {
+		return err
+	}
+	return cmd.err
+}
+
+// waitContext waits for the command to complete. The command status is stored
+// in cmd.err. ctx.Err() is returned if ctx is done first.
+func (cmd *Command) waitContext(ctx context.Context) error {
+	if cmd.err != nil {
+		return nil
+	}
+
+	// Prefer reporting completion if both channels are ready
+	select {
+	case cmd.err = <-cmd.done:
+		return nil
+	default:
+	}
+
+	select {
+	case cmd.err = <-cmd.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitContextFunc calls f in a separate goroutine and waits for it to return.
+// If ctx is done first, ctx.Err() is returned and the result of f is
+// discarded.
+func waitContextFunc[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		v, err := f()
+		ch <- result{v, err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.v, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// closeOnDone closes conn if ctx is done before the returned function is
+// called. The returned function reports whether conn has been closed.
+func closeOnDone(ctx context.Context, conn net.Conn) (stop func() bool) {
+	done := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			closed <- true
+		case <-done:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		return <-closed
+	}
+}
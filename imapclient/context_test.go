@@ -0,0 +1,181 @@
+package imapclient_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// contextSession blocks STATUS commands on the "Blocked" mailbox until the
+// command context is cancelled or release is closed.
+type contextSession struct {
+	imapserver.Session
+	ctx      context.Context
+	commands chan<- *imapserver.Command
+	blocked  chan<- context.Context
+	release  <-chan struct{}
+}
+
+func (s *contextSession) WithContext(ctx context.Context) imapserver.Session {
+	select {
+	case s.commands <- imapserver.CommandFromContext(ctx):
+	default:
+	}
+	cmdSession := *s
+	cmdSession.ctx = ctx
+	return &cmdSession
+}
+
+func (s *contextSession) Status(mailbox string, items []imap.StatusItem) (*imap.StatusData, error) {
+	if mailbox != "Blocked" {
+		return s.Session.Status(mailbox, items)
+	}
+	s.blocked <- s.ctx
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case <-s.release:
+		numMessages := uint32(42)
+		return &imap.StatusData{Mailbox: mailbox, NumMessages: &numMessages}, nil
+	}
+}
+
+func newContextServer(t *testing.T, session *contextSession, concurrent bool) (*imapclient.Client, <-chan *imapserver.Conn, *testServer) {
+	connCh := make(chan *imapserver.Conn, 1)
+	server := newTestServer(t, &testServerOptions{
+		Options: imapserver.Options{
+			Caps:               imap.CapSet{imap.CapIMAP4rev1: {}},
+			ConcurrentCommands: concurrent,
+		},
+		WrapSession: func(conn *imapserver.Conn, memSession imapserver.Session) imapserver.Session {
+			connCh <- conn
+			session.Session = memSession
+			return session
+		},
+	})
+	return server.dial(t, nil), connCh, server
+}
+
+func TestSessionContext(t *testing.T) {
+	commands := make(chan *imapserver.Command, 16)
+	blocked := make(chan context.Context, 1)
+	client, connCh, server := newContextServer(t, &contextSession{
+		commands: commands,
+		blocked:  blocked,
+	}, true)
+	defer server.Close()
+	defer client.Close()
+
+	loginCmd := client.Login(testUsername, testPassword)
+	if err := loginCmd.Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if cmd := <-commands; cmd == nil || cmd.Name != "LOGIN" || cmd.Tag == "" {
+		t.Errorf("CommandFromContext() = %v, want LOGIN command", cmd)
+	}
+
+	conn := <-connCh
+	if conn.Context().Err() != nil {
+		t.Errorf("Conn.Context() cancelled before connection is closed")
+	}
+
+	client.Status("Blocked", []imap.StatusItem{imap.StatusItemNumMessages})
+	var ctx context.Context
+	select {
+	case ctx = <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("STATUS not received by session")
+	}
+	if cmd := imapserver.CommandFromContext(ctx); cmd == nil || cmd.Name != "STATUS" {
+		t.Errorf("CommandFromContext() = %v, want STATUS command", cmd)
+	}
+	if c := imapserver.ConnFromContext(ctx); c != conn {
+		t.Errorf("ConnFromContext() = %p, want %p", c, conn)
+	}
+
+	// Commands in progress are cancelled when the client disconnects
+	client.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("command context not cancelled after client disconnected")
+	}
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection context not cancelled after client disconnected")
+	}
+}
+
+func TestSessionContext_sequential(t *testing.T) {
+	blocked := make(chan context.Context, 1)
+	client, _, server := newContextServer(t, &contextSession{
+		commands: make(chan *imapserver.Command),
+		blocked:  blocked,
+	}, false)
+	defer server.Close()
+	defer client.Close()
+
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	client.Status("Blocked", []imap.StatusItem{imap.StatusItemNumMessages})
+	var ctx context.Context
+	select {
+	case ctx = <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("STATUS not received by session")
+	}
+
+	// Nothing else is read from the connection while the command is
+	// executed, but the disconnection must still be noticed
+	client.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("command context not cancelled after client disconnected")
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	blocked := make(chan context.Context, 1)
+	release := make(chan struct{})
+	client, _, server := newContextServer(t, &contextSession{
+		commands: make(chan *imapserver.Command),
+		blocked:  blocked,
+		release:  release,
+	}, true)
+	defer server.Close()
+	defer client.Close()
+
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	statusCmd := client.Status("Blocked", []imap.StatusItem{imap.StatusItemNumMessages})
+	<-blocked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := statusCmd.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("StatusCommand.WaitContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The command is still pending and its result can be retrieved later
+	close(release)
+	data, err := statusCmd.Wait()
+	if err != nil {
+		t.Fatalf("StatusCommand.Wait() = %v", err)
+	} else if data.NumMessages == nil || *data.NumMessages != 42 {
+		t.Errorf("StatusCommand.Wait() = %v, want 42 messages", data.NumMessages)
+	}
+
+	if err := client.Noop().WaitContext(context.Background()); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+}
@@ -1,28 +1,30 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) copy(uid bool, seqSet imap.SeqSet, mailbox string) *CopyCommand {
+func (c *Client) copy(uid bool, numSet imap.NumSet, mailbox string) *CopyCommand {
 	cmd := &CopyCommand{}
 	enc := c.beginCommand(uidCmdName("COPY", uid), cmd)
-	enc.SP().SeqSet(seqSet).SP().Mailbox(mailbox)
+	enc.SP().NumSet(numSet).SP().Mailbox(mailbox)
 	enc.end()
 	return cmd
 }
 
 // Copy sends a COPY command.
-func (c *Client) Copy(seqSet imap.SeqSet, mailbox string) *CopyCommand {
-	return c.copy(false, seqSet, mailbox)
+func (c *Client) Copy(numSet imap.NumSet, mailbox string) *CopyCommand {
+	return c.copy(false, numSet, mailbox)
 }
 
 // UIDCopy sends a UID COPY command.
 //
 // See Copy.
-func (c *Client) UIDCopy(seqSet imap.SeqSet, mailbox string) *CopyCommand {
-	return c.copy(true, seqSet, mailbox)
+func (c *Client) UIDCopy(numSet imap.NumSet, mailbox string) *CopyCommand {
+	return c.copy(true, numSet, mailbox)
 }
 
 // CopyCommand is a COPY command.
@@ -35,6 +37,15 @@ func (cmd *CopyCommand) Wait() (*imap.CopyData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *CopyCommand) WaitContext(ctx context.Context) (*imap.CopyData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 func readRespCodeCopy(dec *imapwire.Decoder) (uidValidity uint32, srcUIDs, dstUIDs imap.SeqSet, err error) {
 	if !dec.ExpectNumber(&uidValidity) || !dec.ExpectSP() || !dec.ExpectSeqSet(&srcUIDs) || !dec.ExpectSP() || !dec.ExpectSeqSet(&dstUIDs) {
 		return 0, imap.SeqSet{}, imap.SeqSet{}, dec.Err()
@@ -1,12 +1,17 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 )
 
 // Enable sends an ENABLE command.
 //
 // This command requires support for IMAP4rev2 or the ENABLE extension.
+//
+// Once UTF8=ACCEPT is enabled, mailbox names are sent and received in UTF-8
+// instead of modified UTF-7.
 func (c *Client) Enable(caps ...imap.Cap) *EnableCommand {
 	cmd := &EnableCommand{}
 	enc := c.beginCommand("ENABLE", cmd)
@@ -25,6 +30,19 @@ func (c *Client) handleEnabled() error {
 	if cmd := findPendingCmdByType[*EnableCommand](c); cmd != nil {
 		cmd.data.Caps = caps
 	}
+
+	c.mutex.Lock()
+	if c.enabled == nil {
+		c.enabled = make(imap.CapSet)
+	}
+	for name := range caps {
+		c.enabled[name] = struct{}{}
+	}
+	c.mutex.Unlock()
+
+	if caps.Has(imap.CapUTF8Accept) {
+		c.dec.MailboxUTF8 = true
+	}
 	return nil
 }
 
@@ -38,8 +56,23 @@ func (cmd *EnableCommand) Wait() (*EnableData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *EnableCommand) WaitContext(ctx context.Context) (*EnableData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 // EnableData is the data returned by the ENABLE command.
 type EnableData struct {
 	// Capabilities that were successfully enabled
 	Caps imap.CapSet
 }
+
+func (c *Client) utf8AcceptEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.enabled.Has(imap.CapUTF8Accept)
+}
@@ -1,6 +1,9 @@
 package imapclient
 
 import (
+	"context"
+	"strings"
+
 	"github.com/emersion/go-imap/v2"
 )
 
@@ -14,10 +17,10 @@ func (c *Client) Expunge() *ExpungeCommand {
 // UIDExpunge sends a UID EXPUNGE command.
 //
 // This command requires support for IMAP4rev2 or the UIDPLUS extension.
-func (c *Client) UIDExpunge(uids imap.SeqSet) *ExpungeCommand {
+func (c *Client) UIDExpunge(uids imap.NumSet) *ExpungeCommand {
 	cmd := &ExpungeCommand{seqNums: make(chan uint32, 128)}
 	enc := c.beginCommand("UID EXPUNGE", cmd)
-	enc.SP().SeqSet(uids)
+	enc.SP().NumSet(uids)
 	enc.end()
 	return cmd
 }
@@ -33,13 +36,51 @@ func (c *Client) handleExpunge(seqNum uint32) error {
 	cmd := findPendingCmdByType[*ExpungeCommand](c)
 	if cmd != nil {
 		cmd.seqNums <- seqNum
-	} else if handler := c.options.unilateralDataHandler().Expunge; handler != nil {
+	} else if handler := c.unilateralDataHandler().Expunge; handler != nil {
 		handler(seqNum)
 	}
 
 	return nil
 }
 
+func (c *Client) handleVanished() error {
+	earlier := false
+	if c.dec.Special('(') {
+		var tag string
+		if !c.dec.ExpectAtom(&tag) || !c.dec.ExpectSpecial(')') || !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		earlier = strings.ToUpper(tag) == "EARLIER"
+	}
+
+	var uids imap.SeqSet
+	if !c.dec.ExpectSeqSet(&uids) {
+		return c.dec.Err()
+	}
+
+	if !earlier {
+		// Unlike VANISHED (EARLIER), VANISHED decrements the number of
+		// messages in the mailbox
+		nums, _ := uids.Nums()
+		c.mutex.Lock()
+		if c.state == imap.ConnStateSelected {
+			c.mailbox = c.mailbox.copy()
+			if n := uint32(len(nums)); c.mailbox.NumMessages > n {
+				c.mailbox.NumMessages -= n
+			} else {
+				c.mailbox.NumMessages = 0
+			}
+		}
+		c.mutex.Unlock()
+	}
+
+	if handler := c.unilateralDataHandler().Vanished; handler != nil {
+		handler(uids, earlier)
+	}
+
+	return nil
+}
+
 // ExpungeCommand is an EXPUNGE command.
 //
 // The caller must fully consume the ExpungeCommand. A simple way to do so is
@@ -82,3 +123,11 @@ func (cmd *ExpungeCommand) Collect() ([]uint32, error) {
 	}
 	return l, cmd.Close()
 }
+
+// CollectContext is like Collect, but returns early with ctx.Err() if ctx is
+// done before the command has completed. In that case, the remaining
+// responses are discarded in the background and the command must not be
+// used anymore.
+func (cmd *ExpungeCommand) CollectContext(ctx context.Context) ([]uint32, error) {
+	return waitContextFunc(ctx, cmd.Collect)
+}
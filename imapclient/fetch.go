@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -11,7 +12,7 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) fetch(uid bool, seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
+func (c *Client) fetch(uid bool, numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
 	// Ensure we request UID as the first data item for UID FETCH, to be safer.
 	// We want to get it before any literal.
 	if uid {
@@ -26,13 +27,16 @@ func (c *Client) fetch(uid bool, seqSet imap.SeqSet, items []imap.FetchItem) *Fe
 
 	cmd := &FetchCommand{
 		uid:    uid,
-		seqSet: seqSet,
+		numSet: numSet,
 		msgs:   make(chan *FetchMessageData, 128),
 	}
 	enc := c.beginCommand(uidCmdName("FETCH", uid), cmd)
-	enc.SP().SeqSet(seqSet).SP().List(len(items), func(i int) {
+	enc.SP().NumSet(numSet).SP().List(len(items), func(i int) {
 		writeFetchItem(enc.Encoder, items[i])
 	})
+	if options != nil {
+		writeFetchModifiers(enc.Encoder, options)
+	}
 	enc.end()
 	return cmd
 }
@@ -41,15 +45,37 @@ func (c *Client) fetch(uid bool, seqSet imap.SeqSet, items []imap.FetchItem) *Fe
 //
 // The caller must fully consume the FetchCommand. A simple way to do so is to
 // defer a call to FetchCommand.Close.
-func (c *Client) Fetch(seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
-	return c.fetch(false, seqSet, items)
+//
+// A nil options pointer is equivalent to a zero options value.
+func (c *Client) Fetch(numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
+	return c.fetch(false, numSet, items, options)
 }
 
 // UIDFetch sends a UID FETCH command.
 //
 // See Fetch.
-func (c *Client) UIDFetch(seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
-	return c.fetch(true, seqSet, items)
+func (c *Client) UIDFetch(numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
+	return c.fetch(true, numSet, items, options)
+}
+
+func writeFetchModifiers(enc *imapwire.Encoder, options *imap.FetchOptions) {
+	var modifiers []func()
+	if options.ChangedSince != 0 {
+		modifiers = append(modifiers, func() {
+			enc.Atom("CHANGEDSINCE").SP().ModSeq(options.ChangedSince)
+		})
+	}
+	if options.Vanished {
+		modifiers = append(modifiers, func() {
+			enc.Atom("VANISHED")
+		})
+	}
+	if len(modifiers) == 0 {
+		return
+	}
+	enc.SP().List(len(modifiers), func(i int) {
+		modifiers[i]()
+	})
 }
 
 func writeFetchItem(enc *imapwire.Encoder, item imap.FetchItem) {
@@ -129,8 +155,9 @@ type FetchCommand struct {
 	cmd
 
 	uid        bool
-	seqSet     imap.SeqSet
+	numSet     imap.NumSet
 	recvSeqSet imap.SeqSet
+	modified   imap.SeqSet
 
 	msgs chan *FetchMessageData
 	prev *FetchMessageData
@@ -144,7 +171,8 @@ func (cmd *FetchCommand) Next() *FetchMessageData {
 	if cmd.prev != nil {
 		cmd.prev.discard()
 	}
-	return <-cmd.msgs
+	cmd.prev = <-cmd.msgs
+	return cmd.prev
 }
 
 // Close releases the command.
@@ -158,6 +186,15 @@ func (cmd *FetchCommand) Close() error {
 	return cmd.cmd.Wait()
 }
 
+// Modified returns the messages which haven't been updated by a STORE command
+// because they failed the UNCHANGEDSINCE test, as reported by the server in a
+// MODIFIED response code.
+//
+// Modified must be called after Close or Collect.
+func (cmd *FetchCommand) Modified() imap.SeqSet {
+	return cmd.modified
+}
+
 // Collect accumulates message data into a list.
 //
 // This method will read and store message contents in memory. This is
@@ -185,6 +222,14 @@ func (cmd *FetchCommand) Collect() ([]*FetchMessageBuffer, error) {
 	return l, cmd.Close()
 }
 
+// CollectContext is like Collect, but returns early with ctx.Err() if ctx is
+// done before the command has completed. In that case, the remaining
+// responses are discarded in the background and the command must not be
+// used anymore.
+func (cmd *FetchCommand) CollectContext(ctx context.Context) ([]*FetchMessageBuffer, error) {
+	return waitContextFunc(ctx, cmd.Collect)
+}
+
 // FetchMessageData contains a message's FETCH data.
 type FetchMessageData struct {
 	SeqNum uint32
@@ -250,6 +295,7 @@ var (
 	_ FetchItemData = FetchItemDataRFC822Size{}
 	_ FetchItemData = FetchItemDataUID{}
 	_ FetchItemData = FetchItemDataBodyStructure{}
+	_ FetchItemData = FetchItemDataModSeq{}
 )
 
 type discarder interface {
@@ -329,6 +375,15 @@ type FetchItemDataBodyStructure struct {
 
 func (FetchItemDataBodyStructure) fetchItemData() {}
 
+// FetchItemDataModSeq holds data returned by FETCH MODSEQ.
+//
+// This requires the CONDSTORE extension.
+type FetchItemDataModSeq struct {
+	ModSeq uint64
+}
+
+func (FetchItemDataModSeq) fetchItemData() {}
+
 // FetchItemDataBinarySectionSize holds data returned by FETCH BINARY.SIZE[].
 type FetchItemDataBinarySectionSize struct {
 	Part []int
@@ -351,6 +406,7 @@ type FetchMessageBuffer struct {
 	BodySection       map[*imap.FetchItemBodySection][]byte
 	BinarySection     map[*imap.FetchItemBinarySection][]byte
 	BinarySectionSize []FetchItemDataBinarySectionSize
+	ModSeq            uint64 // requires CONDSTORE
 }
 
 func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
@@ -387,6 +443,8 @@ func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
 		buf.BodyStructure = item.BodyStructure
 	case FetchItemDataBinarySectionSize:
 		buf.BinarySectionSize = append(buf.BinarySectionSize, item)
+	case FetchItemDataModSeq:
+		buf.ModSeq = item.ModSeq
 	default:
 		panic(fmt.Errorf("unsupported fetch item data %T", item))
 	}
@@ -426,7 +484,12 @@ func (c *Client) handleFetch(seqNum uint32) error {
 			} else {
 				num = seqNum
 			}
-			if num == 0 || !cmd.seqSet.Contains(num) || cmd.recvSeqSet.Contains(num) {
+			if num == 0 || cmd.recvSeqSet.Contains(num) {
+				return false
+			}
+			// When the saved search result is referenced, we can't know
+			// which messages have been requested: accept any of them
+			if seqSet, ok := cmd.numSet.(imap.SeqSet); ok && !seqSet.Contains(num) {
 				return false
 			}
 			cmd.recvSeqSet.AddNum(num)
@@ -436,7 +499,11 @@ func (c *Client) handleFetch(seqNum uint32) error {
 		if cmd != nil {
 			cmd := cmd.(*FetchCommand)
 			cmd.msgs <- msg
-		} else if handler := c.options.unilateralDataHandler().Fetch; handler != nil {
+		} else if watcher := c.currentWatcher(); watcher != nil {
+			// Queue the event right away, so that it's delivered in order
+			// with other mailbox events
+			watcher.pushFetch(msg)
+		} else if handler := c.unilateralDataHandler().Fetch; handler != nil {
 			go handler(msg)
 		} else {
 			go msg.discard()
@@ -505,6 +572,13 @@ func (c *Client) handleFetch(seqNum uint32) error {
 			}
 
 			item = FetchItemDataUID{UID: uid}
+		case imap.FetchItemModSeq:
+			var modSeq uint64
+			if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectModSeq(&modSeq) || !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+
+			item = FetchItemDataModSeq{ModSeq: modSeq}
 		case "BODY", "BINARY":
 			if dec.Special('[') {
 				var section imap.FetchItem
@@ -582,6 +656,9 @@ func (c *Client) handleFetch(seqNum uint32) error {
 				IsExtended:    attName == imap.FetchItemBodyStructure,
 			}
 		case "BINARY.SIZE":
+			if !dec.ExpectSpecial('[') {
+				return dec.Err()
+			}
 			part, dot := readSectionPart(dec)
 			if dot {
 				return fmt.Errorf("in section-binary: expected number after dot")
@@ -613,7 +690,7 @@ func (c *Client) handleFetch(seqNum uint32) error {
 		items <- item
 		if done != nil {
 			<-done
-			c.setReadTimeout(respReadTimeout)
+			c.setReadTimeout(c.options.respReadTimeout())
 		}
 		return nil
 	})
@@ -0,0 +1,96 @@
+package imapclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// ID sends an ID command.
+//
+// The client identification fields are sent to the server, a nil map is
+// sent as NIL. Common field names are defined in RFC 2971 section 3.3, e.g.
+// "name" and "version".
+//
+// This command requires support for the ID extension.
+func (c *Client) ID(clientID map[string]string) *IDCommand {
+	cmd := &IDCommand{}
+	enc := c.beginCommand("ID", cmd)
+	enc.SP()
+	if len(clientID) == 0 {
+		enc.NIL()
+	} else {
+		keys := make([]string, 0, len(clientID))
+		for k := range clientID {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		enc.List(len(keys), func(i int) {
+			enc.String(keys[i]).SP().String(clientID[keys[i]])
+		})
+	}
+	enc.end()
+	return cmd
+}
+
+func (c *Client) handleID() error {
+	serverID, err := readIDResponse(c.dec)
+	if err != nil {
+		return fmt.Errorf("in id-response: %v", err)
+	}
+	if cmd := findPendingCmdByType[*IDCommand](c); cmd != nil {
+		cmd.serverID = serverID
+	}
+	return nil
+}
+
+// IDCommand is an ID command.
+type IDCommand struct {
+	cmd
+	serverID map[string]string
+}
+
+// Wait blocks until the command has completed and returns the server
+// identification fields. A nil map is returned if the server didn't send any.
+func (cmd *IDCommand) Wait() (map[string]string, error) {
+	return cmd.serverID, cmd.cmd.Wait()
+}
+
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *IDCommand) WaitContext(ctx context.Context) (map[string]string, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
+func readIDResponse(dec *imapwire.Decoder) (map[string]string, error) {
+	var serverID map[string]string
+	err := dec.ExpectNList(func() error {
+		var key string
+		if !dec.ExpectString(&key) || !dec.ExpectSP() {
+			return dec.Err()
+		}
+		if serverID == nil {
+			serverID = make(map[string]string)
+		}
+
+		var nilAtom string
+		if dec.Atom(&nilAtom) {
+			if !dec.Expect(nilAtom == "NIL", "nstring") {
+				return dec.Err()
+			}
+			return nil
+		}
+		var value string
+		if !dec.ExpectString(&value) {
+			return dec.Err()
+		}
+		serverID[key] = value
+		return nil
+	})
+	return serverID, err
+}
@@ -0,0 +1,28 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	serverID, err := client.ID(map[string]string{
+		"name":    "go-imap",
+		"version": "2.0",
+	}).Wait()
+	if err != nil {
+		t.Fatalf("ID() = %v", err)
+	}
+	want := map[string]string{"name": "imapmemserver"}
+	if !reflect.DeepEqual(serverID, want) {
+		t.Errorf("ID() = %v, want %v", serverID, want)
+	}
+
+	if _, err := client.ID(nil).Wait(); err != nil {
+		t.Fatalf("ID(nil) = %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -49,7 +50,7 @@ func (cmd *IdleCommand) Close() error {
 	if cmd.enc == nil {
 		return fmt.Errorf("imapclient: IDLE command closed twice")
 	}
-	cmd.enc.client.setWriteTimeout(cmdWriteTimeout)
+	cmd.enc.client.setWriteTimeout(cmd.enc.client.options.cmdWriteTimeout())
 	_, err := cmd.enc.client.bw.WriteString("DONE\r\n")
 	if err == nil {
 		err = cmd.enc.client.bw.Flush()
@@ -68,3 +69,12 @@ func (cmd *IdleCommand) Wait() error {
 	}
 	return cmd.cmd.Wait()
 }
+
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *IdleCommand) WaitContext(ctx context.Context) error {
+	if cmd.enc != nil {
+		return fmt.Errorf("imapclient: IdleCommand.Close must be called before WaitContext")
+	}
+	return cmd.cmd.WaitContext(ctx)
+}
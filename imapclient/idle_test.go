@@ -0,0 +1,65 @@
+package imapclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// idleSession reports when Session.Idle returns.
+type idleSession struct {
+	imapserver.Session
+	idleDone chan<- error
+}
+
+func (s *idleSession) Idle(w *imapserver.UpdateWriter, stop <-chan struct{}) error {
+	err := s.Session.Idle(w, stop)
+	s.idleDone <- err
+	return err
+}
+
+func TestIdle_authenticated(t *testing.T) {
+	idleDone := make(chan error, 1)
+	client, server := newClientServerPair(t, nil, &testServerOptions{
+		Options: imapserver.Options{
+			Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+		},
+		WrapSession: func(conn *imapserver.Conn, session imapserver.Session) imapserver.Session {
+			return &idleSession{Session: session, idleDone: idleDone}
+		},
+	})
+	defer client.Close()
+	defer server.Close()
+
+	// No mailbox is selected: IDLE must keep running until DONE is sent
+	idleCmd, err := client.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+	select {
+	case err := <-idleDone:
+		t.Fatalf("Session.Idle() returned before DONE: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		t.Fatalf("IdleCommand.Close() = %v", err)
+	}
+	if err := idleCmd.Wait(); err != nil {
+		t.Fatalf("IdleCommand.Wait() = %v", err)
+	}
+	select {
+	case err := <-idleDone:
+		if err != nil {
+			t.Errorf("Session.Idle() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for Session.Idle() to return")
+	}
+
+	if client.State() != imap.ConnStateAuthenticated {
+		t.Errorf("State() = %v, want authenticated", client.State())
+	}
+}
@@ -0,0 +1,345 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func TestAppendLimit(t *testing.T) {
+	server := newTestServer(t, &testServerOptions{Options: imapserver.Options{AppendLimit: 64}})
+	defer server.Close()
+
+	client := server.dial(t, nil)
+	defer client.Close()
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	if limit, ok := client.Caps().AppendLimit(); !ok || limit == nil || *limit != 64 {
+		t.Errorf("Caps().AppendLimit() = %v, %v, want 64", limit, ok)
+	}
+
+	data, err := client.Status("INBOX", []imap.StatusItem{imap.StatusItemAppendLimit}).Wait()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if data.AppendLimit == nil || *data.AppendLimit != 64 {
+		t.Errorf("Status().AppendLimit = %v, want 64", data.AppendLimit)
+	}
+
+	err = appendMessage(client, "INBOX", strings.Repeat("a", 65), nil)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTooBig {
+		t.Errorf("Append() = %v, want TOOBIG error", err)
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop() after rejected APPEND = %v", err)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	server := newTestServer(t, &testServerOptions{Options: imapserver.Options{MaxConns: 1}})
+	defer server.Close()
+
+	client := server.dial(t, nil)
+	defer client.Close()
+	if err := client.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	other := server.dial(t, nil)
+	defer other.Close()
+	err := other.WaitGreeting()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBye || imapErr.Code != imap.ResponseCodeUnavailable {
+		t.Errorf("WaitGreeting() = %v, want BYE [UNAVAILABLE]", err)
+	}
+}
+
+func TestMaxConnsPerUser(t *testing.T) {
+	server := newTestServer(t, &testServerOptions{Options: imapserver.Options{MaxConnsPerUser: 1}})
+	defer server.Close()
+
+	client := server.dial(t, nil)
+	defer client.Close()
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	other := server.dial(t, nil)
+	defer other.Close()
+	if err := other.Login(testUsername, testPassword).Wait(); err == nil {
+		t.Errorf("Login() succeeded, want failure")
+	}
+}
+
+func TestAppendLimit_default(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if limit, ok := client.Caps().AppendLimit(); !ok || limit == nil || *limit != 100*1024*1024 {
+		t.Errorf("Caps().AppendLimit() = %v, %v, want 100MiB", limit, ok)
+	}
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	server := newTestServer(t, &testServerOptions{Options: imapserver.Options{MaxConnsPerIP: 1}})
+	defer server.Close()
+
+	client := server.dial(t, nil)
+	defer client.Close()
+	if err := client.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	other := server.dial(t, nil)
+	defer other.Close()
+	err := other.WaitGreeting()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBye || imapErr.Code != imap.ResponseCodeUnavailable {
+		t.Errorf("WaitGreeting() = %v, want BYE [UNAVAILABLE]", err)
+	}
+}
+
+func TestMaxLiteralSize(t *testing.T) {
+	client, server := newClientServerPair(t, nil, &testServerOptions{
+		Options: imapserver.Options{MaxLiteralSize: 6000},
+	})
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	// Strings longer than 4096 bytes are sent as synchronizing literals
+	criteria := imap.SearchCriteria{Body: []string{strings.Repeat("a", 5000)}}
+	if _, err := client.Search(&criteria, nil).Wait(); err != nil {
+		t.Errorf("Search() with a 5000 bytes literal = %v", err)
+	}
+
+	criteria.Body[0] = strings.Repeat("a", 7000)
+	_, err := client.Search(&criteria, nil).Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTooBig {
+		t.Errorf("Search() with a 7000 bytes literal = %v, want TOOBIG", err)
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop() after rejected literal = %v", err)
+	}
+}
+
+func TestMaxLiteralSize_nonSync(t *testing.T) {
+	server := newTestServer(t, &testServerOptions{
+		Options: imapserver.Options{
+			ConcurrentCommands: true,
+			MaxLiteralSize:     1000,
+		},
+	})
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.addr)
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+
+	readTagged := func(tag string) string {
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() = %v", err)
+			}
+			if strings.HasPrefix(line, tag+" ") {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+
+	fmt.Fprintf(conn, "a1 LOGIN %v %v\r\n", testUsername, testPassword)
+	readTagged("a1")
+	fmt.Fprintf(conn, "a2 SELECT INBOX\r\n")
+	readTagged("a2")
+
+	// The rejected literal data must not be interpreted as commands
+	lit := strings.Repeat("a4 LOGOUT\r\n", 200)
+	fmt.Fprintf(conn, "a3 SEARCH BODY {%v+}\r\n%v\r\n", len(lit), lit)
+	if line := readTagged("a3"); !strings.HasPrefix(line, "a3 NO [TOOBIG]") {
+		t.Errorf("SEARCH with a %v bytes literal = %q, want NO [TOOBIG]", len(lit), line)
+	}
+	fmt.Fprintf(conn, "a5 NOOP\r\n")
+	if line := readTagged("a5"); !strings.HasPrefix(line, "a5 OK") {
+		t.Errorf("NOOP after rejected literal = %q, want OK", line)
+	}
+}
+
+// waitClosed waits for the server to close the connection.
+func waitClosed(t *testing.T, conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.Copy(io.Discard, conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("connection not closed by server")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("read", func(t *testing.T) {
+		server := newTestServer(t, &testServerOptions{
+			Options: imapserver.Options{ReadTimeout: 50 * time.Millisecond},
+		})
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		defer conn.Close()
+
+		// Unauthenticated clients need to send a command in time
+		waitClosed(t, conn)
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		server := newTestServer(t, &testServerOptions{
+			Options: imapserver.Options{
+				ReadTimeout: time.Minute,
+				IdleTimeout: 50 * time.Millisecond,
+			},
+		})
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		defer conn.Close()
+
+		// Authenticated clients are subject to the idle timeout
+		fmt.Fprintf(conn, "a1 LOGIN %v %v\r\n", testUsername, testPassword)
+		waitClosed(t, conn)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		server := newTestServer(t, &testServerOptions{
+			Options: imapserver.Options{ReadTimeout: 50 * time.Millisecond},
+			ImplicitTLS: &tls.Config{
+				Certificates: []tls.Certificate{newTestCert(t, "localhost")},
+			},
+		})
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		defer conn.Close()
+
+		// Clients need to complete the TLS handshake in time
+		waitClosed(t, conn)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		server := newTestServer(t, &testServerOptions{
+			Options: imapserver.Options{WriteTimeout: 50 * time.Millisecond},
+		})
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		defer conn.Close()
+		conn.(*net.TCPConn).SetReadBuffer(4096)
+
+		// Large responses fill the socket buffers quickly, even if the
+		// server is slow
+		var keywords []string
+		for i := 0; i < 1000; i++ {
+			keywords = append(keywords, fmt.Sprintf("keyword%v%v", i, strings.Repeat("x", 64)))
+		}
+		fmt.Fprintf(conn, "a1 LOGIN %v %v\r\n", testUsername, testPassword)
+		fmt.Fprintf(conn, "a2 APPEND INBOX {6+}\r\nHello!\r\n")
+		fmt.Fprintf(conn, "a3 SELECT INBOX\r\n")
+		fmt.Fprintf(conn, "a4 STORE 1 FLAGS.SILENT (%v)\r\n", strings.Join(keywords, " "))
+
+		// Send commands without reading responses, until the server gives up
+		// writing and closes the connection
+		cmds := []byte(strings.Repeat("a FETCH 1 FLAGS\r\n", 16))
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		for {
+			if _, err := conn.Write(cmds); err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					t.Errorf("connection not closed by server")
+				}
+				break
+			}
+		}
+	})
+}
+
+func TestClientTimeouts(t *testing.T) {
+	waitNoop := func(t *testing.T, client *imapclient.Client) {
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Noop().Wait()
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("Noop() succeeded")
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("timeout waiting for NOOP to fail")
+		}
+	}
+
+	t.Run("read", func(t *testing.T) {
+		clientConn, serverConn := net.Pipe()
+		defer serverConn.Close()
+		go func() {
+			// Start a response but never finish it
+			io.WriteString(serverConn, "* OK ready\r\n* 1 EXI")
+			io.Copy(io.Discard, serverConn)
+		}()
+
+		client := imapclient.New(clientConn, &imapclient.Options{ReadTimeout: 50 * time.Millisecond})
+		defer client.Close()
+		if err := client.WaitGreeting(); err != nil {
+			t.Fatalf("WaitGreeting() = %v", err)
+		}
+		waitNoop(t, client)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		clientConn, serverConn := net.Pipe()
+		defer serverConn.Close()
+		go func() {
+			// Never read commands
+			io.WriteString(serverConn, "* OK ready\r\n")
+		}()
+
+		client := imapclient.New(clientConn, &imapclient.Options{WriteTimeout: 50 * time.Millisecond})
+		defer client.Close()
+		if err := client.WaitGreeting(); err != nil {
+			t.Fatalf("WaitGreeting() = %v", err)
+		}
+		waitNoop(t, client)
+	})
+}
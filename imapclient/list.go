@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"unicode/utf8"
@@ -57,6 +58,8 @@ func getReturnOpts(options *imap.ListOptions) []string {
 // extension.
 func (c *Client) List(ref, pattern string, options *imap.ListOptions) *ListCommand {
 	cmd := &ListCommand{
+		ref:          ref,
+		pattern:      pattern,
 		mailboxes:    make(chan *imap.ListData, 64),
 		returnStatus: options != nil && len(options.ReturnStatus) > 0,
 	}
@@ -66,7 +69,7 @@ func (c *Client) List(ref, pattern string, options *imap.ListOptions) *ListComma
 			enc.Atom(selectOpts[i])
 		})
 	}
-	enc.SP().Mailbox(ref).SP().String(pattern)
+	enc.SP().Mailbox(ref).SP().MailboxPattern(pattern)
 	if returnOpts := getReturnOpts(options); len(returnOpts) > 0 {
 		enc.SP().Atom("RETURN").SP().List(len(returnOpts), func(i int) {
 			opt := returnOpts[i]
@@ -91,7 +94,8 @@ func (c *Client) handleList() error {
 	cmd := c.findPendingCmdFunc(func(cmd command) bool {
 		switch cmd := cmd.(type) {
 		case *ListCommand:
-			return true // TODO: match pattern, check if already handled
+			// Unsolicited LIST responses may be sent, e.g. for NOTIFY
+			return cmd.match(data)
 		case *SelectCommand:
 			return cmd.mailbox == data.Mailbox && cmd.data.List == nil
 		default:
@@ -110,6 +114,10 @@ func (c *Client) handleList() error {
 		}
 	case *SelectCommand:
 		cmd.data.List = data
+	default:
+		if handler := c.unilateralDataHandler().List; handler != nil {
+			handler(data)
+		}
 	}
 
 	return nil
@@ -118,7 +126,8 @@ func (c *Client) handleList() error {
 // ListCommand is a LIST command.
 type ListCommand struct {
 	cmd
-	mailboxes chan *imap.ListData
+	ref, pattern string
+	mailboxes    chan *imap.ListData
 
 	returnStatus bool
 	pendingData  *imap.ListData
@@ -158,6 +167,14 @@ func (cmd *ListCommand) Collect() ([]*imap.ListData, error) {
 	return l, cmd.Close()
 }
 
+// CollectContext is like Collect, but returns early with ctx.Err() if ctx is
+// done before the command has completed. In that case, the remaining
+// responses are discarded in the background and the command must not be
+// used anymore.
+func (cmd *ListCommand) CollectContext(ctx context.Context) ([]*imap.ListData, error) {
+	return waitContextFunc(ctx, cmd.Collect)
+}
+
 func readList(dec *imapwire.Decoder) (*imap.ListData, error) {
 	var data imap.ListData
 
@@ -256,3 +273,13 @@ func readDelim(dec *imapwire.Decoder) (rune, error) {
 		return 0, nil
 	}
 }
+
+// match checks whether a LIST response matches the command's reference and
+// pattern.
+func (cmd *ListCommand) match(data *imap.ListData) bool {
+	if internal.MatchList(data.Mailbox, data.Delim, cmd.ref, cmd.pattern) {
+		return true
+	}
+	// INBOX is case-insensitive
+	return strings.EqualFold(data.Mailbox, "INBOX") && internal.MatchList("INBOX", data.Delim, cmd.ref, strings.ToUpper(cmd.pattern))
+}
@@ -1,39 +1,26 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-type GetMetadataDepth int
+// GetMetadataDepth is an alias for imap.GetMetadataDepth.
+type GetMetadataDepth = imap.GetMetadataDepth
 
 const (
-	GetMetadataDepthZero     GetMetadataDepth = 0
-	GetMetadataDepthOne      GetMetadataDepth = 1
-	GetMetadataDepthInfinity GetMetadataDepth = -1
+	GetMetadataDepthZero     = imap.GetMetadataDepthZero
+	GetMetadataDepthOne      = imap.GetMetadataDepthOne
+	GetMetadataDepthInfinity = imap.GetMetadataDepthInfinity
 )
 
-func (depth GetMetadataDepth) String() string {
-	switch depth {
-	case GetMetadataDepthZero:
-		return "0"
-	case GetMetadataDepthOne:
-		return "1"
-	case GetMetadataDepthInfinity:
-		return "infinity"
-	default:
-		panic(fmt.Errorf("imapclient: unknown GETMETADATA depth %d", depth))
-	}
-}
-
-// GetMetadataOptions contains options for the GETMETADATA command.
-type GetMetadataOptions struct {
-	MaxSize *uint32
-	Depth   GetMetadataDepth
-}
+// GetMetadataOptions is an alias for imap.GetMetadataOptions.
+type GetMetadataOptions = imap.GetMetadataOptions
 
-func (options *GetMetadataOptions) names() []string {
+func getMetadataOptionNames(options *GetMetadataOptions) []string {
 	if options == nil {
 		return nil
 	}
@@ -54,7 +41,7 @@ func (c *Client) GetMetadata(mailbox string, entries []string, options *GetMetad
 	cmd := &GetMetadataCommand{mailbox: mailbox}
 	enc := c.beginCommand("GETMETADATA", cmd)
 	enc.SP().Mailbox(mailbox)
-	if opts := options.names(); len(opts) > 0 {
+	if opts := getMetadataOptionNames(options); len(opts) > 0 {
 		enc.SP().List(len(opts), func(i int) {
 			opt := opts[i]
 			enc.Atom(opt).SP()
@@ -131,13 +118,18 @@ func (cmd *GetMetadataCommand) Wait() (*GetMetadataData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
-// GetMetadataData is the data returned by the GETMETADATA command.
-type GetMetadataData struct {
-	Mailbox     string
-	EntryList   []string
-	EntryValues map[string]*[]byte
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *GetMetadataCommand) WaitContext(ctx context.Context) (*GetMetadataData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
 }
 
+// GetMetadataData is an alias for imap.GetMetadataData.
+type GetMetadataData = imap.GetMetadataData
+
 func readMetadataResp(dec *imapwire.Decoder) (*GetMetadataData, error) {
 	var data GetMetadataData
 
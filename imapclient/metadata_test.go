@@ -0,0 +1,68 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestMetadata(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	comment := []byte("My INBOX")
+	vendor := []byte("dark")
+	if err := client.SetMetadata("INBOX", map[string]*[]byte{
+		"/private/comment":            &comment,
+		"/private/vendor/example/ui":  &vendor,
+		"/shared/vendor/example/long": &[]byte{'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x'},
+	}).Wait(); err != nil {
+		t.Fatalf("SetMetadata() = %v", err)
+	}
+
+	data, err := client.GetMetadata("INBOX", []string{"/private/comment", "/shared/comment"}, nil).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata() = %v", err)
+	}
+	want := map[string]*[]byte{"/private/comment": &comment}
+	if !reflect.DeepEqual(data.EntryValues, want) {
+		t.Errorf("GetMetadata() = %v, want %v", data.EntryValues, want)
+	}
+
+	maxSize := uint32(5)
+	data, err = client.GetMetadata("INBOX", []string{"/private/vendor", "/shared/vendor"}, &imapclient.GetMetadataOptions{
+		MaxSize: &maxSize,
+		Depth:   imapclient.GetMetadataDepthInfinity,
+	}).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata() = %v", err)
+	}
+	want = map[string]*[]byte{"/private/vendor/example/ui": &vendor}
+	if !reflect.DeepEqual(data.EntryValues, want) {
+		t.Errorf("GetMetadata() = %v, want %v", data.EntryValues, want)
+	}
+
+	if err := client.SetMetadata("INBOX", map[string]*[]byte{"/private/comment": nil}).Wait(); err != nil {
+		t.Fatalf("SetMetadata() = %v", err)
+	}
+	data, err = client.GetMetadata("INBOX", []string{"/private/comment"}, nil).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata() = %v", err)
+	} else if len(data.EntryValues) != 0 {
+		t.Errorf("GetMetadata() = %v, want no entries", data.EntryValues)
+	}
+
+	if err := client.SetMetadata("", map[string]*[]byte{"/private/comment": &comment}).Wait(); err != nil {
+		t.Fatalf("SetMetadata() = %v", err)
+	}
+	data, err = client.GetMetadata("", []string{"/private/comment"}, nil).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata() = %v", err)
+	}
+	want = map[string]*[]byte{"/private/comment": &comment}
+	if !reflect.DeepEqual(data.EntryValues, want) {
+		t.Errorf("GetMetadata() = %v, want %v", data.EntryValues, want)
+	}
+}
@@ -1,10 +1,12 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 )
 
-func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand {
+func (c *Client) move(uid bool, numSet imap.NumSet, mailbox string) *MoveCommand {
 	// If the server doesn't support MOVE, fallback to [UID] COPY,
 	// [UID] STORE +FLAGS.SILENT \Deleted and [UID] EXPUNGE
 	cmdName := "MOVE"
@@ -14,17 +16,17 @@ func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand
 
 	cmd := &MoveCommand{}
 	enc := c.beginCommand(uidCmdName(cmdName, uid), cmd)
-	enc.SP().SeqSet(seqSet).SP().Mailbox(mailbox)
+	enc.SP().NumSet(numSet).SP().Mailbox(mailbox)
 	enc.end()
 
 	if cmdName == "COPY" {
-		cmd.store = c.store(uid, seqSet, &imap.StoreFlags{
+		cmd.store = c.store(uid, numSet, &imap.StoreFlags{
 			Op:     imap.StoreFlagsAdd,
 			Silent: true,
 			Flags:  []imap.Flag{imap.FlagDeleted},
-		})
+		}, nil)
 		if uid && c.Caps().Has(imap.CapUIDPlus) {
-			cmd.expunge = c.UIDExpunge(seqSet)
+			cmd.expunge = c.UIDExpunge(numSet)
 		} else {
 			cmd.expunge = c.Expunge()
 		}
@@ -37,15 +39,15 @@ func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand
 //
 // If the server doesn't support IMAP4rev2 nor the MOVE extension, a fallback
 // with COPY + STORE + EXPUNGE commands is used.
-func (c *Client) Move(seqSet imap.SeqSet, mailbox string) *MoveCommand {
-	return c.move(false, seqSet, mailbox)
+func (c *Client) Move(numSet imap.NumSet, mailbox string) *MoveCommand {
+	return c.move(false, numSet, mailbox)
 }
 
 // UIDMove sends a UID MOVE command.
 //
 // See Move.
-func (c *Client) UIDMove(seqSet imap.SeqSet, mailbox string) *MoveCommand {
-	return c.move(true, seqSet, mailbox)
+func (c *Client) UIDMove(numSet imap.NumSet, mailbox string) *MoveCommand {
+	return c.move(true, numSet, mailbox)
 }
 
 // MoveCommand is a MOVE command.
@@ -75,6 +77,13 @@ func (cmd *MoveCommand) Wait() (*MoveData, error) {
 	return &cmd.data, nil
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. In that case, the command must not be
+// used anymore.
+func (cmd *MoveCommand) WaitContext(ctx context.Context) (*MoveData, error) {
+	return waitContextFunc(ctx, cmd.Wait)
+}
+
 // MoveData contains the data returned by a MOVE command.
 type MoveData struct {
 	// requires UIDPLUS or IMAP4rev2
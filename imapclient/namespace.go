@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
@@ -37,6 +38,15 @@ func (cmd *NamespaceCommand) Wait() (*imap.NamespaceData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *NamespaceCommand) WaitContext(ctx context.Context) (*imap.NamespaceData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 func readNamespaceResponse(dec *imapwire.Decoder) (*imap.NamespaceData, error) {
 	var (
 		data imap.NamespaceData
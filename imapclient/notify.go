@@ -0,0 +1,53 @@
+package imapclient
+
+import (
+	"github.com/emersion/go-imap/v2"
+)
+
+// Notify sends a NOTIFY command.
+//
+// This command requires support for the NOTIFY extension. If options is nil,
+// notifications are disabled ("NOTIFY NONE").
+//
+// Notifications for mailboxes other than the selected one are delivered as
+// STATUS and LIST responses via UnilateralDataHandler.Status and
+// UnilateralDataHandler.List.
+func (c *Client) Notify(options *imap.NotifyOptions) *Command {
+	cmd := &Command{}
+	enc := c.beginCommand("NOTIFY", cmd)
+	if options == nil {
+		enc.SP().Atom("NONE")
+		enc.end()
+		return cmd
+	}
+
+	enc.SP().Atom("SET")
+	if options.Status {
+		enc.SP().Atom("STATUS")
+	}
+	for _, group := range options.EventGroups {
+		enc.SP().Special('(').Atom(string(group.Filter))
+		switch group.Filter {
+		case imap.NotifyFilterSubtree, imap.NotifyFilterMailboxes:
+			enc.SP()
+			if len(group.Mailboxes) == 1 {
+				enc.Mailbox(group.Mailboxes[0])
+			} else {
+				enc.List(len(group.Mailboxes), func(i int) {
+					enc.Mailbox(group.Mailboxes[i])
+				})
+			}
+		}
+		enc.SP()
+		if len(group.Events) == 0 {
+			enc.Atom("NONE")
+		} else {
+			enc.List(len(group.Events), func(i int) {
+				enc.Atom(string(group.Events[i]))
+			})
+		}
+		enc.Special(')')
+	}
+	enc.end()
+	return cmd
+}
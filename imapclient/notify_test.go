@@ -0,0 +1,294 @@
+package imapclient_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestNotify(t *testing.T) {
+	statusCh := make(chan *imap.StatusData, 64)
+	listCh := make(chan *imap.ListData, 64)
+	client, server := newClientServerPair(t, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Status: func(data *imap.StatusData) {
+				statusCh <- data
+			},
+			List: func(data *imap.ListData) {
+				listCh <- data
+			},
+		},
+	}, nil)
+	defer client.Close()
+	defer server.Close()
+
+	for _, name := range []string{"Lists", "Lists/go", "Other", "Sent"} {
+		if err := client.Create(name).Wait(); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	if _, err := client.Select("Sent", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	messageEvents := []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge}
+	err := client.Notify(&imap.NotifyOptions{
+		Status: true,
+		EventGroups: []imap.NotifyEventGroup{
+			{Filter: imap.NotifyFilterSelected, Events: messageEvents},
+			{Filter: imap.NotifyFilterInboxes, Events: messageEvents},
+			{Filter: imap.NotifyFilterSubtree, Mailboxes: []string{"Lists"}, Events: messageEvents},
+			{Filter: imap.NotifyFilterMailboxes, Mailboxes: []string{"Sent"}, Events: messageEvents},
+			{Filter: imap.NotifyFilterPersonal, Events: []imap.NotifyEvent{imap.NotifyEventMailboxName, imap.NotifyEventSubscriptionChange}},
+		},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	// The initial STATUS responses are sent before the command completes
+	initial := make(map[string]uint32)
+	for len(statusCh) > 0 {
+		data := <-statusCh
+		initial[data.Mailbox] = *data.NumMessages
+	}
+	want := map[string]uint32{"INBOX": 1, "Lists": 0, "Lists/go": 0}
+	if len(initial) != len(want) {
+		t.Errorf("initial STATUS responses = %v, want %v", initial, want)
+	}
+	for name, n := range want {
+		if got, ok := initial[name]; !ok || got != n {
+			t.Errorf("initial STATUS for %q = %v, want %v", name, got, n)
+		}
+	}
+
+	nextStatus := func() *imap.StatusData {
+		select {
+		case data := <-statusCh:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for STATUS")
+			return nil
+		}
+	}
+	nextList := func() *imap.ListData {
+		select {
+		case data := <-listCh:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for LIST")
+			return nil
+		}
+	}
+
+	// Updates for the selected mailbox and for mailboxes without message
+	// events are not reported via STATUS
+	if err := appendMessage(client, "Other", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "Sent", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "Lists/go", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if data := nextStatus(); data.Mailbox != "Lists/go" || data.NumMessages == nil || *data.NumMessages != 1 || data.UIDNext != 2 {
+		t.Errorf("STATUS = %v (%v messages, UIDNEXT %v), want Lists/go (1 message, UIDNEXT 2)", data.Mailbox, data.NumMessages, data.UIDNext)
+	}
+
+	if err := client.Subscribe("Other").Wait(); err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Other" || len(data.Attrs) != 1 || data.Attrs[0] != imap.MailboxAttrSubscribed {
+		t.Errorf("LIST = %v %v, want Other [\\Subscribed]", data.Mailbox, data.Attrs)
+	}
+
+	if err := client.Rename("Other", "Archive").Wait(); err != nil {
+		t.Fatalf("Rename() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Archive" || data.OldName != "Other" {
+		t.Errorf("LIST = %v (old name %q), want Archive (old name Other)", data.Mailbox, data.OldName)
+	}
+
+	if err := client.Notify(nil).Wait(); err != nil {
+		t.Fatalf("Notify(nil) = %v", err)
+	}
+	if err := appendMessage(client, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	select {
+	case data := <-statusCh:
+		t.Errorf("unexpected STATUS for %v after NOTIFY NONE", data.Mailbox)
+	default:
+	}
+
+	err = client.Notify(&imap.NotifyOptions{
+		EventGroups: []imap.NotifyEventGroup{
+			{Filter: imap.NotifyFilterPersonal, Events: []imap.NotifyEvent{"AnnotationChange"}},
+		},
+	}).Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadEvent {
+		t.Errorf("Notify(AnnotationChange) = %v, want BADEVENT", err)
+	}
+}
+
+func TestNotify_selectedNone(t *testing.T) {
+	existsCh := make(chan uint32, 64)
+	client, server := newClientServerPair(t, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages != nil {
+					existsCh <- *data.NumMessages
+				}
+			},
+		},
+	}, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	err := client.Notify(&imap.NotifyOptions{
+		EventGroups: []imap.NotifyEventGroup{{Filter: imap.NotifyFilterSelected}},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	idleCmd, err := client.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+
+	other := server.dial(t, nil)
+	defer other.Close()
+	if err := other.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if err := appendMessage(other, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	select {
+	case n := <-existsCh:
+		t.Errorf("unexpected EXISTS %v while idling with (selected NONE)", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		t.Fatalf("IdleCommand.Close() = %v", err)
+	}
+	if err := idleCmd.Wait(); err != nil {
+		t.Fatalf("IdleCommand.Wait() = %v", err)
+	}
+
+	// Pending updates are still sent in command responses
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	select {
+	case n := <-existsCh:
+		if n != 2 {
+			t.Errorf("EXISTS = %v, want 2", n)
+		}
+	default:
+		t.Errorf("no EXISTS after NOOP")
+	}
+}
+
+func TestNotify_selectedMessageNew(t *testing.T) {
+	existsCh := make(chan uint32, 64)
+	fetchCh := make(chan uint32, 64)
+	client, server := newClientServerPair(t, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages != nil {
+					existsCh <- *data.NumMessages
+				}
+			},
+			Fetch: func(msg *imapclient.FetchMessageData) {
+				msg.Collect()
+				fetchCh <- msg.SeqNum
+			},
+		},
+	}, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	err := client.Notify(&imap.NotifyOptions{
+		EventGroups: []imap.NotifyEventGroup{{
+			Filter: imap.NotifyFilterSelected,
+			Events: []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge},
+		}},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	idleCmd, err := client.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+
+	other := server.dial(t, nil)
+	defer other.Close()
+	if err := other.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if _, err := other.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagFlagged}}
+	if err := other.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if err := appendMessage(other, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	// The flag change isn't wanted, but mustn't hold back the new message
+	select {
+	case n := <-existsCh:
+		if n != 2 {
+			t.Errorf("EXISTS = %v, want 2", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("no EXISTS while idling with (selected MessageNew)")
+	}
+	select {
+	case seqNum := <-fetchCh:
+		t.Errorf("unexpected FETCH %v while idling with (selected MessageNew)", seqNum)
+	default:
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		t.Fatalf("IdleCommand.Close() = %v", err)
+	}
+	if err := idleCmd.Wait(); err != nil {
+		t.Fatalf("IdleCommand.Wait() = %v", err)
+	}
+
+	// The flag change is sent in the next command response
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	select {
+	case seqNum := <-fetchCh:
+		if seqNum != 1 {
+			t.Errorf("FETCH %v, want 1", seqNum)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("no FETCH after NOOP")
+	}
+}
@@ -0,0 +1,362 @@
+package imapclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultPoolMaxConns         = 4
+	defaultPoolHealthCheckDelay = 5 * time.Minute
+	poolHealthCheckTimeout      = 30 * time.Second
+)
+
+var errPoolClosed = errors.New("imapclient: pool closed")
+
+// PoolOptions contains options for Pool.
+type PoolOptions struct {
+	// Dial connects to the server. It's responsible for setting up TLS, e.g.
+	// with DialTLSContext or DialStartTLSContext. Dial is mandatory.
+	Dial func(ctx context.Context) (*Client, error)
+	// Authenticate authenticates a freshly connected client, e.g. with
+	// Client.Login or Client.Authenticate. If nil, the client is expected to
+	// be authenticated after Dial (e.g. via PREAUTH).
+	Authenticate func(ctx context.Context, c *Client) error
+
+	// Maximum number of connections opened to the server, including idle
+	// connections. Zero selects a default of 4.
+	MaxConns int
+	// Idle connections which haven't been used for this duration are checked
+	// with a NOOP command, and closed if the check fails. Zero selects a
+	// default of five minutes.
+	HealthCheckDelay time.Duration
+}
+
+func (options *PoolOptions) maxConns() int {
+	if options.MaxConns > 0 {
+		return options.MaxConns
+	}
+	return defaultPoolMaxConns
+}
+
+func (options *PoolOptions) healthCheckDelay() time.Duration {
+	if options.HealthCheckDelay > 0 {
+		return options.HealthCheckDelay
+	}
+	return defaultPoolHealthCheckDelay
+}
+
+// Pool is a pool of authenticated connections to the same account.
+//
+// IMAP connections can only have a single mailbox selected at a time. A pool
+// can be used to operate on multiple mailboxes concurrently.
+type Pool struct {
+	options PoolOptions
+	done    chan struct{}
+
+	mutex    sync.Mutex
+	idle     []*poolConn
+	numConns int           // including idle and borrowed connections
+	released chan struct{} // closed when a connection is released
+	closed   bool
+}
+
+type poolConn struct {
+	client   *Client
+	mailbox  string // empty if unknown or none
+	readOnly bool
+	lastUsed time.Time
+}
+
+// NewPool creates a new connection pool.
+//
+// Connections are established on demand.
+func NewPool(options *PoolOptions) *Pool {
+	if options.Dial == nil {
+		panic("imapclient: PoolOptions.Dial is nil")
+	}
+
+	p := &Pool{
+		options:  *options,
+		done:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	go p.healthCheck()
+	return p
+}
+
+// Get borrows a connection from the pool.
+//
+// If mailbox is non-empty, the connection has this mailbox selected. A nil
+// options pointer is equivalent to a zero options value. If mailbox is empty,
+// the connection may have any mailbox selected.
+//
+// If the maximum number of connections has been reached, Get blocks until a
+// connection is released or ctx is done.
+//
+// PooledClient.Release must be called once the connection is no longer used.
+func (p *Pool) Get(ctx context.Context, mailbox string, options *imap.SelectOptions) (*PooledClient, error) {
+	if options == nil {
+		options = &imap.SelectOptions{}
+	}
+
+	for {
+		pc, released, err := p.acquire(ctx, mailbox, options.ReadOnly)
+		if err != nil {
+			return nil, err
+		} else if pc == nil {
+			select {
+			case <-released:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if mailbox == "" || (pc.mailbox == mailbox && pc.readOnly == options.ReadOnly) {
+			return &PooledClient{Client: pc.client, pool: p, conn: pc}, nil
+		}
+
+		_, err = pc.client.Select(mailbox, options).WaitContext(ctx)
+		var imapErr *imap.Error
+		if err == nil {
+			pc.mailbox = mailbox
+			pc.readOnly = options.ReadOnly
+			return &PooledClient{Client: pc.client, pool: p, conn: pc}, nil
+		} else if errors.As(err, &imapErr) {
+			// The connection is still usable, in the authenticated state
+			pc.mailbox = ""
+			p.release(pc)
+			return nil, err
+		} else if ctx.Err() != nil {
+			// The SELECT command may still be in progress
+			p.discard(pc)
+			return nil, err
+		}
+
+		// The connection is broken, try another one
+		p.discard(pc)
+	}
+}
+
+// acquire picks an idle connection or opens a new one. If the maximum number
+// of connections has been reached, it returns a nil connection and a channel
+// closed once a connection is released.
+func (p *Pool) acquire(ctx context.Context, mailbox string, readOnly bool) (*poolConn, <-chan struct{}, error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, nil, errPoolClosed
+	}
+
+	// Drop broken connections
+	idle := p.idle[:0]
+	for _, pc := range p.idle {
+		if pc.client.State() == imap.ConnStateLogout {
+			pc.client.Close()
+			p.numConns--
+		} else {
+			idle = append(idle, pc)
+		}
+	}
+	p.idle = idle
+
+	// Prefer a connection which already has the mailbox selected
+	if i := p.findIdle(mailbox, readOnly); i >= 0 {
+		pc := p.idle[i]
+		p.idle = append(p.idle[:i], p.idle[i+1:]...)
+		p.mutex.Unlock()
+		return pc, nil, nil
+	}
+
+	if p.numConns >= p.options.maxConns() {
+		released := p.released
+		p.mutex.Unlock()
+		return nil, released, nil
+	}
+	p.numConns++
+	p.mutex.Unlock()
+
+	client, err := p.connect(ctx)
+	if err != nil {
+		p.mutex.Lock()
+		p.numConns--
+		p.notifyReleased()
+		p.mutex.Unlock()
+		return nil, nil, err
+	}
+	return &poolConn{client: client}, nil, nil
+}
+
+func (p *Pool) findIdle(mailbox string, readOnly bool) int {
+	if len(p.idle) == 0 {
+		return -1
+	}
+	for i, pc := range p.idle {
+		if pc.mailbox == mailbox && pc.readOnly == readOnly {
+			return i
+		}
+	}
+	// Pick the least recently used connection
+	return 0
+}
+
+func (p *Pool) connect(ctx context.Context) (*Client, error) {
+	client, err := p.options.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := closeOnDone(ctx, client.conn)
+	err = p.setup(ctx, client)
+	if stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (p *Pool) setup(ctx context.Context, client *Client) error {
+	if err := client.WaitGreeting(); err != nil {
+		return err
+	}
+
+	if p.options.Authenticate != nil {
+		if err := p.options.Authenticate(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	if state := client.State(); state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
+		return fmt.Errorf("imapclient: pool connection not authenticated")
+	}
+	return nil
+}
+
+// release puts a connection back into the pool.
+func (p *Pool) release(pc *poolConn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed || pc.client.State() == imap.ConnStateLogout {
+		pc.client.Close()
+		p.numConns--
+	} else {
+		pc.lastUsed = time.Now()
+		p.idle = append(p.idle, pc)
+	}
+	p.notifyReleased()
+}
+
+// discard closes a connection borrowed from the pool.
+func (p *Pool) discard(pc *poolConn) {
+	pc.client.Close()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.numConns--
+	p.notifyReleased()
+}
+
+func (p *Pool) notifyReleased() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// healthCheck periodically checks idle connections.
+func (p *Pool) healthCheck() {
+	delay := p.options.healthCheckDelay()
+	ticker := time.NewTicker(delay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+
+		p.mutex.Lock()
+		var stale []*poolConn
+		idle := p.idle[:0]
+		for _, pc := range p.idle {
+			if time.Since(pc.lastUsed) >= delay {
+				stale = append(stale, pc)
+			} else {
+				idle = append(idle, pc)
+			}
+		}
+		p.idle = idle
+		p.mutex.Unlock()
+
+		for _, pc := range stale {
+			ctx, cancel := context.WithTimeout(context.Background(), poolHealthCheckTimeout)
+			err := pc.client.Noop().WaitContext(ctx)
+			cancel()
+			if err != nil {
+				p.discard(pc)
+			} else {
+				p.release(pc)
+			}
+		}
+	}
+}
+
+// Close closes all idle connections. Borrowed connections are closed when
+// they are released.
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return errPoolClosed
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.numConns -= len(idle)
+	p.notifyReleased()
+	p.mutex.Unlock()
+
+	close(p.done)
+
+	var err error
+	for _, pc := range idle {
+		if closeErr := pc.client.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// PooledClient is a connection borrowed from a Pool.
+type PooledClient struct {
+	*Client
+	pool *Pool
+	conn *poolConn
+}
+
+// Release returns the connection to the pool.
+//
+// The client must not be used after Release has been called. If the
+// connection has been closed or lost, it's removed from the pool.
+func (pc *PooledClient) Release() {
+	if pc.conn == nil {
+		panic("imapclient: PooledClient.Release called twice")
+	}
+
+	// The selected mailbox may have been changed
+	if mbox := pc.Client.Mailbox(); mbox == nil || mbox.Name != pc.conn.mailbox {
+		pc.conn.mailbox = ""
+	}
+
+	pc.pool.release(pc.conn)
+	pc.conn = nil
+}
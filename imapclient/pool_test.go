@@ -0,0 +1,90 @@
+package imapclient_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestPool(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	numDials := 0
+	pool := imapclient.NewPool(&imapclient.PoolOptions{
+		Dial: func(ctx context.Context) (*imapclient.Client, error) {
+			numDials++
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", server.addr)
+			if err != nil {
+				return nil, err
+			}
+			return imapclient.New(conn, nil), nil
+		},
+		Authenticate: func(ctx context.Context, c *imapclient.Client) error {
+			return c.Login(testUsername, testPassword).WaitContext(ctx)
+		},
+		MaxConns: 2,
+	})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inbox, err := pool.Get(ctx, "INBOX", nil)
+	if err != nil {
+		t.Fatalf("Get(INBOX) = %v", err)
+	}
+	if err := inbox.Create("Test").Wait(); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	test, err := pool.Get(ctx, "Test", nil)
+	if err != nil {
+		t.Fatalf("Get(Test) = %v", err)
+	}
+	for name, pc := range map[string]*imapclient.PooledClient{"INBOX": inbox, "Test": test} {
+		if mbox := pc.Mailbox(); mbox == nil || mbox.Name != name {
+			t.Errorf("Mailbox() = %v, want %v", mbox, name)
+		}
+	}
+
+	// The connection limit has been reached
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	if _, err := pool.Get(shortCtx, "INBOX", nil); err != context.DeadlineExceeded {
+		t.Errorf("Get() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Idle connections with the requested mailbox selected are preferred
+	inboxClient := inbox.Client
+	test.Release()
+	inbox.Release()
+	inbox, err = pool.Get(ctx, "INBOX", nil)
+	if err != nil {
+		t.Fatalf("Get(INBOX) = %v", err)
+	} else if inbox.Client != inboxClient {
+		t.Errorf("Get(INBOX) didn't reuse the connection with INBOX selected")
+	}
+
+	// Closed connections are removed from the pool
+	inbox.Close()
+	inbox.Release()
+	test, err = pool.Get(ctx, "INBOX", nil)
+	if err != nil {
+		t.Fatalf("Get(INBOX) = %v", err)
+	}
+	if mbox := test.Mailbox(); mbox == nil || mbox.Name != "INBOX" {
+		t.Errorf("Mailbox() = %v, want INBOX", mbox)
+	}
+	if err := test.Noop().Wait(); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+	test.Release()
+
+	if numDials != 2 {
+		t.Errorf("got %v connections, want 2", numDials)
+	}
+}
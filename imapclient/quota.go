@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
@@ -114,6 +115,15 @@ func (cmd *GetQuotaCommand) Wait() (*QuotaData, error) {
 	return cmd.data, nil
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *GetQuotaCommand) WaitContext(ctx context.Context) (*QuotaData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 // GetQuotaRootCommand is a GETQUOTAROOT command.
 type GetQuotaRootCommand struct {
 	cmd
@@ -129,17 +139,20 @@ func (cmd *GetQuotaRootCommand) Wait() ([]QuotaData, error) {
 	return cmd.data, nil
 }
 
-// QuotaData is the data returned by a QUOTA response.
-type QuotaData struct {
-	Root      string
-	Resources map[imap.QuotaResourceType]QuotaResourceData
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *GetQuotaRootCommand) WaitContext(ctx context.Context) ([]QuotaData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
 }
 
-// QuotaResourceData contains the usage and limit for a quota resource.
-type QuotaResourceData struct {
-	Usage int64
-	Limit int64
-}
+// QuotaData is an alias for imap.QuotaData.
+type QuotaData = imap.QuotaData
+
+// QuotaResourceData is an alias for imap.QuotaResourceData.
+type QuotaResourceData = imap.QuotaResourceData
 
 func readQuotaResponse(dec *imapwire.Decoder) (*QuotaData, error) {
 	var data QuotaData
@@ -0,0 +1,92 @@
+package imapclient_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestQuota(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if !client.Caps().Has(imap.CapQuota) || !client.Caps().Has("QUOTA=RES-STORAGE") {
+		t.Fatalf("Caps() = %v, want QUOTA and QUOTA=RES-STORAGE", client.Caps())
+	}
+
+	if client.Caps().Has(imap.CapQuotaSet) {
+		t.Errorf("Caps() = %v, want no QUOTASET", client.Caps())
+	}
+
+	server.user.SetQuota(map[imap.QuotaResourceType]int64{
+		imap.QuotaResourceMessage: 1,
+	})
+
+	data, err := client.GetQuota("").Wait()
+	if err != nil {
+		t.Fatalf("GetQuota() = %v", err)
+	}
+	want := map[imap.QuotaResourceType]imap.QuotaResourceData{
+		imap.QuotaResourceMessage: {Usage: 1, Limit: 1},
+	}
+	if !reflect.DeepEqual(data.Resources, want) {
+		t.Errorf("GetQuota() = %v, want %v", data.Resources, want)
+	}
+
+	roots, err := client.GetQuotaRoot("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("GetQuotaRoot() = %v", err)
+	} else if len(roots) != 1 || roots[0].Root != "" {
+		t.Errorf("GetQuotaRoot() = %v, want a single empty root", roots)
+	}
+
+	err = appendMessage(client, "INBOX", simpleRawMessage, nil)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeOverQuota {
+		t.Errorf("Append() = %v, want OVERQUOTA", err)
+	}
+}
+
+func TestQuota_sharedMailbox(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	shared := imapmemserver.NewMailbox("Shared", 1)
+	shared.SetRights(imap.RightsIdentifier(testUsername), imap.AllRights)
+	if err := server.user.AddMailbox("Shared", shared); err != nil {
+		t.Fatalf("AddMailbox() = %v", err)
+	}
+
+	server.user.SetQuota(map[imap.QuotaResourceType]int64{
+		imap.QuotaResourceMessage: 2,
+		imap.QuotaResourceMailbox: 1,
+	})
+
+	// Messages in shared mailboxes don't count towards the quota
+	if err := appendMessage(client, "Shared", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "Shared", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "INBOX", simpleRawMessage, nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	data, err := client.GetQuota("").Wait()
+	if err != nil {
+		t.Fatalf("GetQuota() = %v", err)
+	}
+	want := map[imap.QuotaResourceType]imap.QuotaResourceData{
+		imap.QuotaResourceMessage: {Usage: 2, Limit: 2},
+		imap.QuotaResourceMailbox: {Usage: 1, Limit: 1},
+	}
+	if !reflect.DeepEqual(data.Resources, want) {
+		t.Errorf("GetQuota() = %v, want %v", data.Resources, want)
+	}
+}
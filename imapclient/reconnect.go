@@ -0,0 +1,363 @@
+package imapclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultMinReconnectBackoff = time.Second
+	defaultMaxReconnectBackoff = 5 * time.Minute
+)
+
+var errReconnectClientClosed = errors.New("imapclient: reconnecting client closed")
+
+// ReconnectOptions contains options for ReconnectClient.
+type ReconnectOptions struct {
+	// Dial connects to the server. It's responsible for setting up TLS, e.g.
+	// with DialTLSContext or DialStartTLSContext. Dial is mandatory.
+	Dial func(ctx context.Context) (*Client, error)
+	// Authenticate authenticates a freshly connected client, e.g. with
+	// Client.Login or Client.Authenticate. If nil, the client is expected to
+	// be authenticated after Dial (e.g. via PREAUTH).
+	Authenticate func(ctx context.Context, c *Client) error
+	// Capabilities to enable with ENABLE after authentication.
+	Enable []imap.Cap
+
+	// Minimum and maximum delay between connection attempts. The delay is
+	// doubled after each failed attempt. Zero values select defaults of one
+	// second and five minutes.
+	MinBackoff, MaxBackoff time.Duration
+
+	// OnReconnect is called once the connection has been re-established.
+	OnReconnect func(event *ReconnectEvent)
+	// OnError is called when a connection attempt fails.
+	OnError func(err error)
+}
+
+func (options *ReconnectOptions) minBackoff() time.Duration {
+	if options.MinBackoff > 0 {
+		return options.MinBackoff
+	}
+	return defaultMinReconnectBackoff
+}
+
+func (options *ReconnectOptions) maxBackoff() time.Duration {
+	if options.MaxBackoff > 0 {
+		return options.MaxBackoff
+	}
+	return defaultMaxReconnectBackoff
+}
+
+// ReconnectEvent describes a connection which has been re-established.
+type ReconnectEvent struct {
+	// Err is the error which caused the previous connection to be lost.
+	Err error
+	// Attempts is the number of connection attempts it took to reconnect.
+	Attempts int
+	// Mailbox is the name of the mailbox which was selected when the previous
+	// connection was lost, if any.
+	Mailbox string
+	// SelectErr is set if Mailbox couldn't be selected again. In this case,
+	// the new connection is left in the authenticated state.
+	SelectErr error
+	// UIDValidityChanged is set if Mailbox has been selected again, but its
+	// UIDVALIDITY has changed. UIDs cached for this mailbox must be discarded.
+	UIDValidityChanged bool
+}
+
+// ReconnectClient is an IMAP client which automatically re-establishes its
+// connection when it's lost.
+//
+// After reconnecting, the client is authenticated again, capabilities listed
+// in ReconnectOptions.Enable are enabled again and the mailbox selected with
+// ReconnectClient.Select is selected again.
+//
+// Commands in progress when the connection is lost fail and are not retried.
+type ReconnectClient struct {
+	options ReconnectOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mutex         sync.Mutex
+	client        *Client       // nil while disconnected
+	ready         chan struct{} // closed once client is set
+	lost          chan struct{} // closed once client is unset
+	mailbox       string
+	selectOptions imap.SelectOptions
+	uidValidity   uint32
+}
+
+// NewReconnectClient creates a new reconnecting client.
+//
+// The connection is established in the background.
+func NewReconnectClient(options *ReconnectOptions) *ReconnectClient {
+	if options.Dial == nil {
+		panic("imapclient: ReconnectOptions.Dial is nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc := &ReconnectClient{
+		options: *options,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		ready:   make(chan struct{}),
+	}
+	go rc.run()
+	return rc
+}
+
+// Client returns the current connection, waiting for it to be established if
+// necessary.
+//
+// The returned client must not be closed. It may be lost at any time, in
+// which case its commands fail and a subsequent call to Client returns the
+// new connection.
+func (rc *ReconnectClient) Client(ctx context.Context) (*Client, error) {
+	for {
+		rc.mutex.Lock()
+		client, ready, lost := rc.client, rc.ready, rc.lost
+		rc.mutex.Unlock()
+
+		wait := ready
+		if client != nil {
+			if client.State() != imap.ConnStateLogout {
+				return client, nil
+			}
+			// The connection has been lost, wait for the next one
+			wait = lost
+		}
+
+		select {
+		case <-wait:
+		case <-rc.done:
+			return nil, errReconnectClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Select selects a mailbox. The mailbox is selected again after a reconnect.
+//
+// A nil options pointer is equivalent to a zero options value. QRESYNC
+// parameters are only used for the initial SELECT command.
+func (rc *ReconnectClient) Select(ctx context.Context, mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	client, err := rc.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.Select(mailbox, options).WaitContext(ctx)
+
+	var imapErr *imap.Error
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if err == nil {
+		rc.mailbox = mailbox
+		rc.selectOptions = imap.SelectOptions{}
+		if options != nil {
+			rc.selectOptions.ReadOnly = options.ReadOnly
+			rc.selectOptions.CondStore = options.CondStore
+		}
+		rc.uidValidity = data.UIDValidity
+	} else if errors.As(err, &imapErr) {
+		// A failed SELECT command leaves the connection in the authenticated
+		// state
+		rc.mailbox = ""
+	}
+	return data, err
+}
+
+// Unselect unselects the current mailbox.
+func (rc *ReconnectClient) Unselect(ctx context.Context) error {
+	client, err := rc.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Unselect().WaitContext(ctx); err != nil {
+		return err
+	}
+
+	rc.mutex.Lock()
+	rc.mailbox = ""
+	rc.mutex.Unlock()
+	return nil
+}
+
+// Close closes the connection and stops reconnecting.
+func (rc *ReconnectClient) Close() error {
+	rc.cancel()
+	<-rc.done
+
+	rc.mutex.Lock()
+	client := rc.client
+	rc.client = nil
+	rc.mutex.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+func (rc *ReconnectClient) run() {
+	defer close(rc.done)
+
+	var event *ReconnectEvent // nil for the initial connection
+	for {
+		client, attempts := rc.connectWithBackoff()
+		if client == nil {
+			return
+		}
+
+		if event != nil {
+			event.Attempts = attempts
+			rc.restoreMailbox(client, event)
+		}
+
+		rc.mutex.Lock()
+		rc.client = client
+		rc.lost = make(chan struct{})
+		close(rc.ready)
+		rc.mutex.Unlock()
+
+		if event != nil && rc.options.OnReconnect != nil {
+			rc.options.OnReconnect(event)
+		}
+
+		select {
+		case <-client.decCh:
+		case <-rc.ctx.Done():
+			return
+		}
+
+		err := client.decErr
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+
+		rc.mutex.Lock()
+		rc.client = nil
+		rc.ready = make(chan struct{})
+		close(rc.lost)
+		event = &ReconnectEvent{Err: err, Mailbox: rc.mailbox}
+		rc.mutex.Unlock()
+	}
+}
+
+// connectWithBackoff tries to connect until it succeeds or the client is
+// closed. It returns nil if the client has been closed.
+func (rc *ReconnectClient) connectWithBackoff() (client *Client, attempts int) {
+	backoff := rc.options.minBackoff()
+	for {
+		attempts++
+		client, err := rc.connect()
+		if err == nil {
+			return client, attempts
+		} else if rc.ctx.Err() != nil {
+			return nil, attempts
+		}
+
+		if rc.options.OnError != nil {
+			rc.options.OnError(err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-rc.ctx.Done():
+			timer.Stop()
+			return nil, attempts
+		}
+
+		backoff *= 2
+		if max := rc.options.maxBackoff(); backoff > max {
+			backoff = max
+		}
+	}
+}
+
+func (rc *ReconnectClient) connect() (*Client, error) {
+	client, err := rc.options.Dial(rc.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the connection setup if the reconnecting client is closed
+	stop := closeOnDone(rc.ctx, client.conn)
+	err = rc.setup(client)
+	if stop() && err == nil {
+		err = rc.ctx.Err()
+	}
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (rc *ReconnectClient) setup(client *Client) error {
+	if err := client.WaitGreeting(); err != nil {
+		return err
+	}
+
+	if rc.options.Authenticate != nil {
+		if err := rc.options.Authenticate(rc.ctx, client); err != nil {
+			return err
+		}
+	}
+
+	if state := client.State(); state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
+		return fmt.Errorf("imapclient: connection not authenticated after reconnect")
+	}
+
+	if len(rc.options.Enable) > 0 {
+		if _, err := client.Enable(rc.options.Enable...).WaitContext(rc.ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreMailbox selects the mailbox which was selected before the previous
+// connection was lost.
+func (rc *ReconnectClient) restoreMailbox(client *Client, event *ReconnectEvent) {
+	rc.mutex.Lock()
+	mailbox, options, uidValidity := rc.mailbox, rc.selectOptions, rc.uidValidity
+	rc.mutex.Unlock()
+
+	if mailbox == "" {
+		return
+	}
+
+	data, err := client.Select(mailbox, &options).WaitContext(rc.ctx)
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.mailbox != mailbox {
+		return // the mailbox has been changed concurrently
+	}
+	if err != nil {
+		event.SelectErr = err
+		var imapErr *imap.Error
+		if errors.As(err, &imapErr) {
+			rc.mailbox = ""
+		}
+		return
+	}
+	if data.UIDValidity != uidValidity {
+		event.UIDValidityChanged = true
+		rc.uidValidity = data.UIDValidity
+	}
+}
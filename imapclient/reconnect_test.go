@@ -0,0 +1,120 @@
+package imapclient_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestReconnectClient(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	var (
+		mutex   sync.Mutex
+		netConn net.Conn
+	)
+	events := make(chan *imapclient.ReconnectEvent, 1)
+	rc := imapclient.NewReconnectClient(&imapclient.ReconnectOptions{
+		Dial: func(ctx context.Context) (*imapclient.Client, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", server.addr)
+			if err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			netConn = conn
+			mutex.Unlock()
+			return imapclient.New(conn, nil), nil
+		},
+		Authenticate: func(ctx context.Context, c *imapclient.Client) error {
+			return c.Login(testUsername, testPassword).WaitContext(ctx)
+		},
+		MinBackoff: 10 * time.Millisecond,
+		OnReconnect: func(event *imapclient.ReconnectEvent) {
+			events <- event
+		},
+	})
+	defer rc.Close()
+
+	disconnect := func() *imapclient.ReconnectEvent {
+		mutex.Lock()
+		netConn.Close()
+		mutex.Unlock()
+
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("client didn't reconnect")
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := rc.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	}
+	if err := client.Create("Test").Wait(); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := rc.Select(ctx, "Test", nil); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	event := disconnect()
+	if event.Err == nil || event.Mailbox != "Test" || event.SelectErr != nil || event.UIDValidityChanged {
+		t.Errorf("OnReconnect() called with %+v", event)
+	}
+
+	newClient, err := rc.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	} else if newClient == client {
+		t.Fatalf("Client() returned the old connection")
+	}
+	if mbox := newClient.Mailbox(); mbox == nil || mbox.Name != "Test" {
+		t.Errorf("Mailbox() = %v, want Test", mbox)
+	}
+
+	// Re-create the mailbox from another connection to change its UIDVALIDITY
+	other := server.dial(t, nil)
+	defer other.Close()
+	if err := other.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if err := other.Delete("Test").Wait(); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if err := other.Create("Test").Wait(); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	event = disconnect()
+	if !event.UIDValidityChanged {
+		t.Errorf("OnReconnect() called with %+v, want UIDValidityChanged", event)
+	}
+
+	if err := rc.Unselect(ctx); err != nil {
+		t.Fatalf("Unselect() = %v", err)
+	}
+	event = disconnect()
+	if event.Mailbox != "" {
+		t.Errorf("OnReconnect() called with %+v, want no mailbox", event)
+	}
+	client, err = rc.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	}
+	if state := client.State(); state != imap.ConnStateAuthenticated {
+		t.Errorf("State() = %v, want %v", state, imap.ConnStateAuthenticated)
+	}
+}
@@ -0,0 +1,307 @@
+package imapclient_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+const testToken = "test-token"
+
+// saslSession adds OAuth and EXTERNAL support to an imapmemserver session.
+type saslSession struct {
+	imapserver.Session
+}
+
+func (s *saslSession) LoginOAuth(username, token string) (string, error) {
+	if token != testToken {
+		return "", imapserver.ErrAuthFailed
+	}
+	if username == "" {
+		username = testUsername
+	}
+	return username, s.Session.Login(username, testPassword)
+}
+
+func (s *saslSession) LoginExternal(identity string, cert *x509.Certificate) (string, error) {
+	username := cert.Subject.CommonName
+	if identity != "" && identity != username {
+		return "", imapserver.ErrAuthFailed
+	}
+	return username, s.Session.Login(username, testPassword)
+}
+
+// xoauth2Client implements the client side of the XOAUTH2 mechanism.
+type xoauth2Client struct {
+	username, token string
+}
+
+func (c *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	return "XOAUTH2", []byte("user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01"), nil
+}
+
+func (c *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return nil, fmt.Errorf("XOAUTH2 error: %s", challenge)
+}
+
+// loginSession is an imapmemserver session which doesn't support any SASL
+// mechanism.
+type loginSession struct {
+	imapserver.Session
+}
+
+func (s *loginSession) AuthenticateMechanisms() []string {
+	return nil
+}
+
+func (s *loginSession) Authenticate(mech string) (sasl.Server, error) {
+	return nil, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Text: "SASL mechanism not supported",
+	}
+}
+
+// saslCaps are the capabilities advertised by servers using saslSession or
+// loginSession, which only expose the base imapserver.Session methods.
+var saslCaps = imap.CapSet{imap.CapIMAP4rev1: {}}
+
+func newSASLServer(t *testing.T, tlsConfig *tls.Config) *testServer {
+	return newTestServer(t, &testServerOptions{
+		Options: imapserver.Options{Caps: saslCaps},
+		WrapSession: func(conn *imapserver.Conn, session imapserver.Session) imapserver.Session {
+			return &saslSession{session}
+		},
+		ImplicitTLS: tlsConfig,
+	})
+}
+
+// newTestCert generates a self-signed certificate.
+func newTestCert(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() = %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestAuthenticate_scram(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	for _, mech := range []string{"SCRAM-SHA-256", "SCRAM-SHA-1"} {
+		mech := mech
+		t.Run(mech, func(t *testing.T) {
+			client := server.dial(t, nil)
+			defer client.Close()
+
+			if !client.Caps().Has(imap.Cap("AUTH=" + mech)) {
+				t.Fatalf("%v not advertised", mech)
+			}
+
+			saslClient, err := imapclient.NewSCRAMClient(mech, testUsername, "wrong-password")
+			if err != nil {
+				t.Fatalf("NewSCRAMClient() = %v", err)
+			}
+			err = client.Authenticate(saslClient)
+			var imapErr *imap.Error
+			if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeAuthenticationFailed {
+				t.Errorf("Authenticate(wrong password) = %v, want AUTHENTICATIONFAILED", err)
+			}
+
+			saslClient, err = imapclient.NewSCRAMClient(mech, testUsername, testPassword)
+			if err != nil {
+				t.Fatalf("NewSCRAMClient() = %v", err)
+			}
+			if err := client.Authenticate(saslClient); err != nil {
+				t.Fatalf("Authenticate() = %v", err)
+			}
+			if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+				t.Errorf("Select() = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_oauth(t *testing.T) {
+	server := newSASLServer(t, nil)
+	defer server.Close()
+
+	saslClients := map[string]sasl.Client{
+		"OAUTHBEARER": sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+			Username: testUsername,
+			Token:    testToken,
+		}),
+		"XOAUTH2": &xoauth2Client{username: testUsername, token: testToken},
+	}
+	for mech, saslClient := range saslClients {
+		saslClient := saslClient
+		t.Run(mech, func(t *testing.T) {
+			client := server.dial(t, nil)
+			defer client.Close()
+
+			if !client.Caps().Has(imap.Cap("AUTH=" + mech)) {
+				t.Fatalf("%v not advertised", mech)
+			}
+			if client.Caps().Has(imap.Cap("AUTH=EXTERNAL")) {
+				t.Errorf("EXTERNAL advertised without a client certificate")
+			}
+
+			if err := client.Authenticate(saslClient); err != nil {
+				t.Fatalf("Authenticate() = %v", err)
+			}
+			if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+				t.Errorf("Select() = %v", err)
+			}
+		})
+	}
+
+	t.Run("invalid token", func(t *testing.T) {
+		client := server.dial(t, nil)
+		defer client.Close()
+
+		err := client.Authenticate(&xoauth2Client{username: testUsername, token: "invalid"})
+		if err == nil {
+			t.Errorf("Authenticate() succeeded with an invalid token")
+		}
+	})
+}
+
+func TestAuthenticate_external(t *testing.T) {
+	serverCert := newTestCert(t, "localhost")
+	clientCert := newTestCert(t, testUsername)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+	server := newSASLServer(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	})
+	defer server.Close()
+
+	conn, err := tls.Dial("tcp", server.addr, &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{clientCert},
+	})
+	if err != nil {
+		t.Fatalf("tls.Dial() = %v", err)
+	}
+	client := imapclient.New(conn, nil)
+	defer client.Close()
+
+	if !client.Caps().Has(imap.Cap("AUTH=EXTERNAL")) {
+		t.Fatalf("EXTERNAL not advertised")
+	}
+	if err := client.Authenticate(sasl.NewExternalClient("")); err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Errorf("Select() = %v", err)
+	}
+}
+
+func TestAuthenticateAuto(t *testing.T) {
+	scramServer := newTestServer(t, nil)
+	defer scramServer.Close()
+	oauthServer := newSASLServer(t, nil)
+	defer oauthServer.Close()
+	loginServer := newTestServer(t, &testServerOptions{
+		Options: imapserver.Options{Caps: saslCaps},
+		WrapSession: func(conn *imapserver.Conn, session imapserver.Session) imapserver.Session {
+			return &loginSession{session}
+		},
+	})
+	defer loginServer.Close()
+
+	tests := []struct {
+		name   string
+		server *testServer
+		creds  imapclient.Credentials
+		ok     bool
+	}{
+		{"scram", scramServer, imapclient.Credentials{Username: testUsername, Password: testPassword}, true},
+		{"scram wrong password", scramServer, imapclient.Credentials{Username: testUsername, Password: "wrong"}, false},
+		{"oauthbearer", oauthServer, imapclient.Credentials{Username: testUsername, Token: testToken}, true},
+		{"plain", oauthServer, imapclient.Credentials{Username: testUsername, Password: testPassword}, true},
+		{"login", loginServer, imapclient.Credentials{Username: testUsername, Password: testPassword}, true},
+		{"no method", loginServer, imapclient.Credentials{Username: testUsername, Token: testToken}, false},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client := tc.server.dial(t, nil)
+			defer client.Close()
+
+			err := client.AuthenticateAuto(&tc.creds)
+			if tc.ok && err != nil {
+				t.Fatalf("AuthenticateAuto() = %v", err)
+			} else if !tc.ok && err == nil {
+				t.Fatalf("AuthenticateAuto() succeeded, want error")
+			}
+
+			wantState := imap.ConnStateAuthenticated
+			if !tc.ok {
+				wantState = imap.ConnStateNotAuthenticated
+			}
+			if state := client.State(); state != wantState {
+				t.Errorf("State() = %v, want %v", state, wantState)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAuto_oauthError(t *testing.T) {
+	server := newSASLServer(t, nil)
+	defer server.Close()
+
+	client := server.dial(t, nil)
+	defer client.Close()
+
+	err := client.AuthenticateAuto(&imapclient.Credentials{Username: testUsername, Token: "invalid"})
+	var bearerErr *sasl.OAuthBearerError
+	if !errors.As(err, &bearerErr) {
+		t.Fatalf("AuthenticateAuto() = %v, want *sasl.OAuthBearerError", err)
+	} else if bearerErr.Status != "invalid_token" {
+		t.Errorf("OAuthBearerError.Status = %q, want %q", bearerErr.Status, "invalid_token")
+	}
+
+	// The exchange has been aborted and the connection is still usable
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+	if err := client.AuthenticateAuto(&imapclient.Credentials{Username: testUsername, Token: testToken}); err != nil {
+		t.Errorf("AuthenticateAuto() = %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -12,8 +13,6 @@ import (
 )
 
 func (c *Client) search(uid bool, criteria *imap.SearchCriteria, options *imap.SearchOptions) *SearchCommand {
-	// TODO: add support for SEARCHRES
-
 	// The IMAP4rev2 SEARCH charset defaults to UTF-8. For IMAP4rev1 the
 	// default is undefined and only US-ASCII support is required. What's more,
 	// some servers completely reject the CHARSET keyword. So, let's check if
@@ -22,8 +21,10 @@ func (c *Client) search(uid bool, criteria *imap.SearchCriteria, options *imap.S
 	// servers even if we only send ASCII characters: the server then must
 	// decode encoded headers and Content-Transfer-Encoding before matching the
 	// criteria.
+	// Once UTF8=ACCEPT is enabled, CHARSET must not be specified (RFC 6855
+	// section 3).
 	var charset string
-	if !c.Caps().Has(imap.CapIMAP4rev2) && !searchCriteriaIsASCII(criteria) {
+	if !c.Caps().Has(imap.CapIMAP4rev2) && !c.utf8AcceptEnabled() && !searchCriteriaIsASCII(criteria) {
 		charset = "UTF-8"
 	}
 
@@ -56,6 +57,18 @@ func (c *Client) UIDSearch(criteria *imap.SearchCriteria, options *imap.SearchOp
 func (c *Client) handleSearch() error {
 	cmd := findPendingCmdByType[*SearchCommand](c)
 	for c.dec.SP() {
+		if c.dec.Special('(') {
+			var name string
+			var modSeq uint64
+			if !c.dec.ExpectAtom(&name) || !c.dec.Expect(strings.ToUpper(name) == "MODSEQ", "MODSEQ") || !c.dec.ExpectSP() || !c.dec.ExpectModSeq(&modSeq) || !c.dec.ExpectSpecial(')') {
+				return c.dec.Err()
+			}
+			if cmd != nil {
+				cmd.data.ModSeq = modSeq
+			}
+			break
+		}
+
 		var num uint32
 		if !c.dec.ExpectNumber(&num) {
 			return c.dec.Err()
@@ -103,6 +116,15 @@ func (cmd *SearchCommand) Wait() (*imap.SearchData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *SearchCommand) WaitContext(ctx context.Context) (*imap.SearchData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 	enc.Special('(')
 
@@ -121,6 +143,9 @@ func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 	if len(criteria.UID) > 0 {
 		encodeItem("UID").SP().SeqSet(criteria.UID)
 	}
+	if criteria.SearchRes {
+		encodeItem("$")
+	}
 
 	if !criteria.Since.IsZero() && !criteria.Before.IsZero() && criteria.Before.Sub(criteria.Since) == 24*time.Hour {
 		encodeItem("ON").SP().String(criteria.Since.Format(internal.DateLayout))
@@ -182,6 +207,14 @@ func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 		encodeItem("SMALLER").SP().Number64(criteria.Smaller)
 	}
 
+	if modSeq := criteria.ModSeq; modSeq != nil {
+		encodeItem("MODSEQ")
+		if modSeq.MetadataName != "" && modSeq.MetadataType != "" {
+			enc.SP().Quoted(modSeq.MetadataName).SP().Atom(string(modSeq.MetadataType))
+		}
+		enc.SP().ModSeq(modSeq.ModSeq)
+	}
+
 	for _, not := range criteria.Not {
 		encodeItem("NOT").SP()
 		writeSearchKey(enc, &not)
@@ -256,6 +289,10 @@ func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchDa
 				return "", nil, dec.Err()
 			}
 			data.Count = num
+		case "MODSEQ":
+			if !dec.ExpectModSeq(&data.ModSeq) {
+				return "", nil, dec.Err()
+			}
 		default:
 			if !dec.DiscardValue() {
 				return "", nil, dec.Err()
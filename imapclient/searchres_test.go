@@ -0,0 +1,132 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func TestSearchRes(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	for _, subject := range []string{"apple", "banana", "apple pie"} {
+		if err := appendMessage(client, "INBOX", "Subject: "+subject+"\r\n\r\nHello!", nil); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+
+	if !client.Caps().Has(imap.CapSearchRes) {
+		t.Fatalf("SEARCHRES not advertised")
+	}
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	criteria := imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "apple"}},
+	}
+	options := imap.SearchOptions{
+		Return: []imap.SearchReturnOption{imap.SearchReturnSave},
+	}
+	if _, err := client.Search(&criteria, &options).Wait(); err != nil {
+		t.Fatalf("Search() = %v", err)
+	}
+
+	msgs, err := client.Fetch(imap.SearchRes{}, []imap.FetchItem{imap.FetchItemEnvelope}, nil).Collect()
+	if err != nil {
+		t.Fatalf("Fetch($) = %v", err)
+	}
+	var subjects []string
+	for _, msg := range msgs {
+		subjects = append(subjects, msg.Envelope.Subject)
+	}
+	if want := []string{"apple", "apple pie"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("Fetch($) subjects = %v, want %v", subjects, want)
+	}
+
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+	if err := client.Store(imap.SearchRes{}, &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store($) = %v", err)
+	}
+
+	data, err := client.Search(&imap.SearchCriteria{Flag: []imap.Flag{imap.FlagFlagged}}, nil).Wait()
+	if err != nil {
+		t.Fatalf("Search() = %v", err)
+	}
+	if want := imap.SeqSetNum(2, 4); !reflect.DeepEqual(data.All, want) {
+		t.Errorf("Search(FLAGGED) = %v, want %v", data.All, want)
+	}
+
+	data, err = client.Search(&imap.SearchCriteria{
+		SearchRes: true,
+		Not:       []imap.SearchCriteria{{SeqNum: imap.SeqSetNum(2)}},
+	}, nil).Wait()
+	if err != nil {
+		t.Fatalf("Search($) = %v", err)
+	}
+	if want := imap.SeqSetNum(4); !reflect.DeepEqual(data.All, want) {
+		t.Errorf("Search($ NOT 2) = %v, want %v", data.All, want)
+	}
+}
+
+func TestSearchRes_storeModified(t *testing.T) {
+	client, server := newClientServerPair(t, nil, &testServerOptions{
+		Options: imapserver.Options{
+			Caps: imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapCondStore: {}},
+		},
+	})
+	defer client.Close()
+	defer server.Close()
+
+	for _, subject := range []string{"apple", "banana", "apple pie"} {
+		if err := appendMessage(client, "INBOX", "Subject: "+subject+"\r\n\r\nHello!", nil); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+
+	if !client.Caps().Has(imap.CapSearchRes) {
+		t.Fatalf("SEARCHRES not advertised without ESEARCH")
+	}
+	if _, err := client.Select("INBOX", &imap.SelectOptions{CondStore: true}).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	// Expunge the first message so that sequence numbers and UIDs differ
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := client.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if err := client.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge() = %v", err)
+	}
+
+	criteria := imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "apple"}},
+	}
+	options := imap.SearchOptions{
+		Return: []imap.SearchReturnOption{imap.SearchReturnSave},
+	}
+	if _, err := client.Search(&criteria, &options).Wait(); err != nil {
+		t.Fatalf("Search() = %v", err)
+	}
+
+	storeFlags.Flags = []imap.Flag{imap.FlagFlagged}
+	storeCmd := client.Store(imap.SearchRes{}, &storeFlags, &imap.StoreOptions{UnchangedSince: 1})
+	if err := storeCmd.Close(); err != nil {
+		t.Fatalf("Store($) = %v", err)
+	} else if modified := storeCmd.Modified(); modified.String() != "1,3" {
+		t.Errorf("Store($).Modified() = %v, want 1,3", modified)
+	}
+}
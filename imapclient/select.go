@@ -1,15 +1,30 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-// Select sends a SELECT command.
-func (c *Client) Select(mailbox string) *SelectCommand {
+// Select sends a SELECT or EXAMINE command.
+//
+// A nil options pointer is equivalent to a zero options value.
+func (c *Client) Select(mailbox string, options *imap.SelectOptions) *SelectCommand {
+	if options == nil {
+		options = &imap.SelectOptions{}
+	}
+
+	cmdName := "SELECT"
+	if options.ReadOnly {
+		cmdName = "EXAMINE"
+	}
+
 	cmd := &SelectCommand{mailbox: mailbox}
-	enc := c.beginCommand("SELECT", cmd)
+	enc := c.beginCommand(cmdName, cmd)
 	enc.SP().Mailbox(mailbox)
+	writeSelectParams(enc.Encoder, options)
 	enc.end()
 	return cmd
 }
@@ -18,11 +33,35 @@ func (c *Client) Select(mailbox string) *SelectCommand {
 //
 // See Select.
 func (c *Client) Examine(mailbox string) *SelectCommand {
-	cmd := &SelectCommand{mailbox: mailbox}
-	enc := c.beginCommand("EXAMINE", cmd)
-	enc.SP().Mailbox(mailbox)
-	enc.end()
-	return cmd
+	return c.Select(mailbox, &imap.SelectOptions{ReadOnly: true})
+}
+
+func writeSelectParams(enc *imapwire.Encoder, options *imap.SelectOptions) {
+	var params []func()
+	if options.CondStore {
+		params = append(params, func() {
+			enc.Atom("CONDSTORE")
+		})
+	}
+	if qresync := options.QResync; qresync != nil {
+		params = append(params, func() {
+			enc.Atom("QRESYNC").SP().Special('(')
+			enc.Number(qresync.UIDValidity).SP().ModSeq(qresync.ModSeq)
+			if len(qresync.KnownUIDs) > 0 {
+				enc.SP().SeqSet(qresync.KnownUIDs)
+			}
+			if seqMatch := qresync.SeqMatch; seqMatch != nil {
+				enc.SP().Special('(').SeqSet(seqMatch.SeqNums).SP().SeqSet(seqMatch.UIDs).Special(')')
+			}
+			enc.Special(')')
+		})
+	}
+	if len(params) == 0 {
+		return
+	}
+	enc.SP().List(len(params), func(i int) {
+		params[i]()
+	})
 }
 
 // Unselect sends an UNSELECT command.
@@ -59,7 +98,7 @@ func (c *Client) handleFlags() error {
 	cmd := findPendingCmdByType[*SelectCommand](c)
 	if cmd != nil {
 		cmd.data.Flags = flags
-	} else if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+	} else if handler := c.unilateralDataHandler().Mailbox; handler != nil {
 		handler(&UnilateralDataMailbox{Flags: flags})
 	}
 
@@ -78,7 +117,7 @@ func (c *Client) handleExists(num uint32) error {
 		}
 		c.mutex.Unlock()
 
-		if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+		if handler := c.unilateralDataHandler().Mailbox; handler != nil {
 			handler(&UnilateralDataMailbox{NumMessages: &num})
 		}
 	}
@@ -96,6 +135,15 @@ func (cmd *SelectCommand) Wait() (*imap.SelectData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *SelectCommand) WaitContext(ctx context.Context) (*imap.SelectData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 type unselectCommand struct {
 	cmd
 }
@@ -0,0 +1,81 @@
+package imapclient_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestShutdown(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	var debugs [3]lockedBuffer
+	var clients [3]*imapclient.Client
+	for i := range clients {
+		conn, err := net.Dial("tcp", server.addr)
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		clients[i] = imapclient.New(conn, &imapclient.Options{DebugWriter: &debugs[i]})
+		defer clients[i].Close()
+		if err := clients[i].Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+	}
+	waitingClient, idleClient, appendClient := clients[0], clients[1], clients[2]
+
+	if _, err := idleClient.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	idleCmd, err := idleClient.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+	defer idleCmd.Close()
+
+	// A synchronizing literal is used for large messages, so the server is
+	// in the middle of the APPEND command once Append returns
+	msg := "Subject: Hi\r\n\r\n" + strings.Repeat("a", 8192)
+	appendCmd := appendClient.Append("INBOX", int64(len(msg)), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := appendCmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Errorf("Append() = %v", err)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+
+	if err := idleCmd.Wait(); err == nil {
+		t.Errorf("IdleCommand.Wait() succeeded after shutdown")
+	}
+	for _, c := range []*imapclient.Client{waitingClient, appendClient} {
+		if err := c.Noop().Wait(); err == nil {
+			t.Errorf("Noop() succeeded after shutdown")
+		}
+	}
+	for i := range debugs {
+		if s := debugs[i].String(); !strings.Contains(s, "* BYE [UNAVAILABLE]") {
+			t.Errorf("client %v: BYE not received", i)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestSort(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if err := appendMessage(client, "INBOX", strings.Join([]string{
+		"From: Zoe <zoe@example.org>",
+		"Subject: Re: [list] Banana",
+		"Date: Tue, 3 Jan 2023 10:00:00 +0000",
+		"",
+		"Hello!",
+	}, "\r\n"), nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "INBOX", strings.Join([]string{
+		"From: alice@example.org",
+		"Subject: apple",
+		"Date: Mon, 2 Jan 2023 10:00:00 +0000",
+		"",
+		"Hello!",
+	}, "\r\n"), nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	for _, tc := range []struct {
+		criteria []imapclient.SortCriterion
+		want     []uint32
+	}{
+		{[]imapclient.SortCriterion{{Key: imapclient.SortKeyArrival}}, []uint32{1, 2, 3}},
+		{[]imapclient.SortCriterion{{Key: imapclient.SortKeyArrival, Reverse: true}}, []uint32{3, 2, 1}},
+		{[]imapclient.SortCriterion{{Key: imapclient.SortKeySubject}}, []uint32{1, 3, 2}},
+		{[]imapclient.SortCriterion{{Key: imapclient.SortKeyFrom}}, []uint32{1, 3, 2}},
+		{[]imapclient.SortCriterion{{Key: imapclient.SortKeyDate}}, []uint32{3, 2, 1}},
+	} {
+		nums, err := client.Sort(&imapclient.SortOptions{
+			SearchCriteria: &imap.SearchCriteria{},
+			SortCriteria:   tc.criteria,
+		}).Wait()
+		if err != nil {
+			t.Fatalf("Sort(%v) = %v", tc.criteria, err)
+		} else if !reflect.DeepEqual(nums, tc.want) {
+			t.Errorf("Sort(%v) = %v, want %v", tc.criteria, nums, tc.want)
+		}
+	}
+}
+
+func TestThread(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if err := appendMessage(client, "INBOX", strings.Join([]string{
+		"Message-Id: <a@example.org>",
+		"Subject: Lunch",
+		"Date: Mon, 2 Jan 2023 10:00:00 +0000",
+		"",
+		"Hello!",
+	}, "\r\n"), nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "INBOX", strings.Join([]string{
+		"Message-Id: <b@example.org>",
+		"In-Reply-To: <a@example.org>",
+		"Subject: Re: Lunch",
+		"Date: Mon, 2 Jan 2023 11:00:00 +0000",
+		"",
+		"Hello!",
+	}, "\r\n"), nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := appendMessage(client, "INBOX", strings.Join([]string{
+		"Message-Id: <c@example.org>",
+		"References: <a@example.org>",
+		"Subject: Re: Lunch",
+		"Date: Mon, 2 Jan 2023 12:00:00 +0000",
+		"",
+		"Hello!",
+	}, "\r\n"), nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	for _, tc := range []struct {
+		algorithm imap.ThreadAlgorithm
+		want      []imapclient.ThreadData
+	}{
+		{imap.ThreadOrderedSubject, []imapclient.ThreadData{
+			{Chain: []uint32{2}, SubThreads: []imapclient.ThreadData{
+				{Chain: []uint32{3}},
+				{Chain: []uint32{4}},
+			}},
+			{Chain: []uint32{1}},
+		}},
+		{imap.ThreadReferences, []imapclient.ThreadData{
+			{Chain: []uint32{2}, SubThreads: []imapclient.ThreadData{
+				{Chain: []uint32{3}},
+				{Chain: []uint32{4}},
+			}},
+			{Chain: []uint32{1}},
+		}},
+	} {
+		data, err := client.Thread(&imapclient.ThreadOptions{
+			Algorithm:      tc.algorithm,
+			SearchCriteria: &imap.SearchCriteria{},
+		}).Wait()
+		if err != nil {
+			t.Fatalf("Thread(%v) = %v", tc.algorithm, err)
+		} else if !reflect.DeepEqual(data, tc.want) {
+			t.Errorf("Thread(%v) = %+v, want %+v", tc.algorithm, data, tc.want)
+		}
+	}
+}
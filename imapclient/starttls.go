@@ -43,13 +43,14 @@ func (c *Client) upgradeStartTLS(tlsConfig *tls.Config) {
 
 	var cleartextConn net.Conn
 	if buf.Len() > 0 {
-		r := io.MultiReader(&buf, c.conn)
-		cleartextConn = startTLSConn{c.conn, r}
+		r := io.MultiReader(&buf, c.rwConn)
+		cleartextConn = startTLSConn{c.rwConn, r}
 	} else {
-		cleartextConn = c.conn
+		cleartextConn = c.rwConn
 	}
 
 	tlsConn := tls.Client(cleartextConn, tlsConfig)
+	c.rwConn = tlsConn
 	rw := c.options.wrapReadWriter(tlsConn)
 
 	c.br.Reset(rw)
@@ -64,6 +65,11 @@ type startTLSCommand struct {
 	upgradeDone chan<- struct{}
 }
 
+func (cmd *startTLSCommand) upgrade(c *Client) {
+	c.upgradeStartTLS(cmd.tlsConfig)
+	close(cmd.upgradeDone)
+}
+
 type startTLSConn struct {
 	net.Conn
 	r io.Reader
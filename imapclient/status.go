@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -43,6 +44,10 @@ func (c *Client) handleStatus() error {
 		cmd.pendingData.Status = data
 		cmd.mailboxes <- cmd.pendingData
 		cmd.pendingData = nil
+	default:
+		if handler := c.unilateralDataHandler().Status; handler != nil {
+			handler(data)
+		}
 	}
 
 	return nil
@@ -59,6 +64,15 @@ func (cmd *StatusCommand) Wait() (*imap.StatusData, error) {
 	return &cmd.data, cmd.cmd.Wait()
 }
 
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *StatusCommand) WaitContext(ctx context.Context) (*imap.StatusData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
+}
+
 func readStatus(dec *imapwire.Decoder) (*imap.StatusData, error) {
 	var data imap.StatusData
 
@@ -116,6 +130,8 @@ func readStatusAttVal(dec *imapwire.Decoder, data *imap.StatusData) error {
 		var storage int64
 		ok = dec.ExpectNumber64(&storage)
 		data.DeletedStorage = &storage
+	case imap.StatusItemHighestModSeq:
+		ok = dec.ExpectModSeq(&data.HighestModSeq)
 	default:
 		if !dec.DiscardValue() {
 			return dec.Err()
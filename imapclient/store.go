@@ -6,10 +6,17 @@ import (
 	"github.com/emersion/go-imap/v2"
 )
 
-func (c *Client) store(uid bool, seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	cmd := &FetchCommand{msgs: make(chan *FetchMessageData, 128)}
+func (c *Client) store(uid bool, numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	cmd := &FetchCommand{
+		uid:    uid,
+		numSet: numSet,
+		msgs:   make(chan *FetchMessageData, 128),
+	}
 	enc := c.beginCommand(uidCmdName("STORE", uid), cmd)
-	enc.SP().SeqSet(seqSet).SP()
+	enc.SP().NumSet(numSet).SP()
+	if options != nil && options.UnchangedSince != 0 {
+		enc.Special('(').Atom("UNCHANGEDSINCE").SP().ModSeq(options.UnchangedSince).Special(')').SP()
+	}
 	switch store.Op {
 	case imap.StoreFlagsSet:
 		// nothing to do
@@ -34,13 +41,18 @@ func (c *Client) store(uid bool, seqSet imap.SeqSet, store *imap.StoreFlags) *Fe
 // Store sends a STORE command.
 //
 // Unless StoreFlags.Silent is set, the server will return the updated values.
-func (c *Client) Store(seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	return c.store(false, seqSet, store)
+//
+// If StoreOptions.UnchangedSince is set, the messages which failed the
+// UNCHANGEDSINCE test can be retrieved with FetchCommand.Modified.
+//
+// A nil options pointer is equivalent to a zero options value.
+func (c *Client) Store(numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	return c.store(false, numSet, store, options)
 }
 
 // UIDStore sends a UID STORE command.
 //
 // See Store.
-func (c *Client) UIDStore(seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	return c.store(true, seqSet, store)
+func (c *Client) UIDStore(numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	return c.store(true, numSet, store, options)
 }
@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
@@ -38,7 +39,11 @@ func (c *Client) UIDThread(options *ThreadOptions) *ThreadCommand {
 
 func (c *Client) handleThread() error {
 	cmd := findPendingCmdByType[*ThreadCommand](c)
-	for c.dec.SP() {
+	if !c.dec.SP() {
+		return nil
+	}
+	// Thread lists may or may not be separated by spaces
+	for c.dec.Special('(') {
 		data, err := readThreadList(c.dec)
 		if err != nil {
 			return fmt.Errorf("in thread-list: %v", err)
@@ -46,6 +51,7 @@ func (c *Client) handleThread() error {
 		if cmd != nil {
 			cmd.data = append(cmd.data, *data)
 		}
+		c.dec.SP()
 	}
 	return nil
 }
@@ -61,25 +67,39 @@ func (cmd *ThreadCommand) Wait() ([]ThreadData, error) {
 	return cmd.data, err
 }
 
-type ThreadData struct {
-	Chain      []uint32
-	SubThreads []ThreadData
+// WaitContext is like Wait, but returns early with ctx.Err() if ctx is done
+// before the command has completed. See Command.WaitContext.
+func (cmd *ThreadCommand) WaitContext(ctx context.Context) ([]ThreadData, error) {
+	if err := cmd.waitContext(ctx); err != nil {
+		return nil, err
+	}
+	return cmd.Wait()
 }
 
+// ThreadData is an alias for imap.ThreadData.
+type ThreadData = imap.ThreadData
+
+// readThreadList reads a thread-list. The opening parenthesis must have
+// already been consumed.
 func readThreadList(dec *imapwire.Decoder) (*ThreadData, error) {
 	var data ThreadData
-	err := dec.ExpectList(func() error {
+	for {
 		var num uint32
-		if len(data.SubThreads) == 0 && dec.Number(&num) {
+		switch {
+		case dec.Special(')'):
+			return &data, nil
+		case len(data.SubThreads) == 0 && dec.Number(&num):
 			data.Chain = append(data.Chain, num)
-		} else {
+			dec.SP()
+		case dec.Special('('):
 			sub, err := readThreadList(dec)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			data.SubThreads = append(data.SubThreads, *sub)
+		default:
+			dec.Expect(false, "thread-list member")
+			return nil, dec.Err()
 		}
-		return nil
-	})
-	return &data, err
+	}
 }
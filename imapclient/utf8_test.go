@@ -0,0 +1,76 @@
+package imapclient_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func listMailboxNames(t *testing.T, client *imapclient.Client, pattern string) []string {
+	mailboxes, err := client.List("", pattern, nil).Collect()
+	if err != nil {
+		t.Fatalf("List(%q) = %v", pattern, err)
+	}
+	var names []string
+	for _, mbox := range mailboxes {
+		names = append(names, mbox.Mailbox)
+	}
+	return names
+}
+
+func TestUTF8Accept(t *testing.T) {
+	var debug lockedBuffer
+	client, server := newClientServerPair(t, &imapclient.Options{DebugWriter: &debug}, nil)
+	defer client.Close()
+	defer server.Close()
+
+	const (
+		utf7Name = "日本語"
+		utf8Name = "中文 & Ελληνικά"
+	)
+
+	// Before UTF8=ACCEPT is enabled, mailbox names are sent in modified UTF-7
+	if err := client.Create(utf7Name).Wait(); err != nil {
+		t.Fatalf("Create(%q) = %v", utf7Name, err)
+	}
+	if !strings.Contains(debug.String(), `CREATE "&ZeVnLIqe-"`) {
+		t.Errorf("mailbox name not encoded in modified UTF-7")
+	}
+	if names := listMailboxNames(t, client, "日本*"); len(names) != 1 || names[0] != utf7Name {
+		t.Errorf("List() = %q, want [%q]", names, utf7Name)
+	}
+
+	data, err := client.Enable(imap.CapUTF8Accept).Wait()
+	if err != nil {
+		t.Fatalf("Enable() = %v", err)
+	} else if !data.Caps.Has(imap.CapUTF8Accept) {
+		t.Fatalf("UTF8=ACCEPT not enabled")
+	}
+
+	if err := client.Create(utf8Name).Wait(); err != nil {
+		t.Fatalf("Create(%q) = %v", utf8Name, err)
+	}
+	if !strings.Contains(debug.String(), `CREATE "`+utf8Name+`"`) {
+		t.Errorf("mailbox name not sent in UTF-8")
+	}
+	if names := listMailboxNames(t, client, "中文*"); len(names) != 1 || names[0] != utf8Name {
+		t.Errorf("List() = %q, want [%q]", names, utf8Name)
+	}
+	if names := listMailboxNames(t, client, "日本*"); len(names) != 1 || names[0] != utf7Name {
+		t.Errorf("List() = %q, want [%q]", names, utf7Name)
+	}
+
+	msg := "From: =?utf-8?q?x?= <x@example.org>\r\nSubject: 件名\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n本文\r\n"
+	if err := appendMessage(client, utf8Name, msg, &imap.AppendOptions{UTF8: true}); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	statusData, err := client.Status(utf8Name, []imap.StatusItem{imap.StatusItemNumMessages}).Wait()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if statusData.Mailbox != utf8Name || statusData.NumMessages == nil || *statusData.NumMessages != 1 {
+		t.Errorf("Status() = %q with %v messages, want %q with 1 message", statusData.Mailbox, statusData.NumMessages, utf8Name)
+	}
+}
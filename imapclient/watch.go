@@ -0,0 +1,343 @@
+package imapclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	// RFC 2177 section 3 says servers may log out clients after 30 minutes
+	defaultWatchRestartInterval = 29 * time.Minute
+	defaultWatchPollInterval    = time.Minute
+)
+
+// WatchOptions contains options for Client.Watch.
+type WatchOptions struct {
+	// Interval after which the IDLE command is restarted. Zero selects a
+	// default of 29 minutes.
+	RestartInterval time.Duration
+	// Interval between NOOP commands when the server doesn't support IDLE.
+	// Zero selects a default of one minute.
+	PollInterval time.Duration
+}
+
+func (options *WatchOptions) restartInterval() time.Duration {
+	if options.RestartInterval > 0 {
+		return options.RestartInterval
+	}
+	return defaultWatchRestartInterval
+}
+
+func (options *WatchOptions) pollInterval() time.Duration {
+	if options.PollInterval > 0 {
+		return options.PollInterval
+	}
+	return defaultWatchPollInterval
+}
+
+// MailboxEvent is an update of the selected mailbox delivered by a Watcher.
+//
+// It's one of *ExistsEvent, *ExpungeEvent, *VanishedEvent or *FetchEvent.
+type MailboxEvent interface {
+	isMailboxEvent()
+}
+
+// ExistsEvent is sent when the number of messages in the mailbox changes.
+type ExistsEvent struct {
+	NumMessages uint32
+}
+
+// ExpungeEvent is sent when a message is expunged.
+type ExpungeEvent struct {
+	SeqNum uint32
+}
+
+// VanishedEvent is sent when messages are expunged and QRESYNC is enabled.
+type VanishedEvent struct {
+	UIDs imap.SeqSet
+}
+
+// FetchEvent is sent when a message is updated, e.g. its flags are changed.
+type FetchEvent struct {
+	Message *FetchMessageBuffer
+
+	collected chan struct{} // closed once Message is set
+}
+
+func (*ExistsEvent) isMailboxEvent()   {}
+func (*ExpungeEvent) isMailboxEvent()  {}
+func (*VanishedEvent) isMailboxEvent() {}
+func (*FetchEvent) isMailboxEvent()    {}
+
+// Watch starts watching the currently selected mailbox for updates.
+//
+// IDLE is used if supported by the server, and is periodically restarted.
+// Otherwise, the server is polled with NOOP commands.
+//
+// The client cannot send any other command while the mailbox is watched. The
+// caller must invoke Watcher.Close to stop watching and unblock the client.
+//
+// While the mailbox is watched, unilateral FETCH responses are delivered to
+// the watcher instead of UnilateralDataHandler.Fetch. Other
+// UnilateralDataHandler functions are still called.
+func (c *Client) Watch(options *WatchOptions) (*Watcher, error) {
+	if options == nil {
+		options = &WatchOptions{}
+	}
+
+	if c.State() != imap.ConnStateSelected {
+		return nil, fmt.Errorf("imapclient: cannot watch mailbox: no mailbox selected")
+	}
+
+	w := &Watcher{
+		client:  c,
+		options: *options,
+		events:  make(chan MailboxEvent),
+		queued:  make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	c.mutex.Lock()
+	if c.watcher != nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("imapclient: mailbox already watched")
+	}
+	c.watcher = w
+	c.mutex.Unlock()
+
+	var idleCmd *IdleCommand
+	if c.Caps().Has(imap.CapIdle) {
+		var err error
+		idleCmd, err = c.Idle()
+		if err != nil {
+			w.unregister()
+			return nil, err
+		}
+	}
+
+	go w.run(idleCmd)
+	go w.forward()
+	return w, nil
+}
+
+// Watcher watches a mailbox for updates.
+type Watcher struct {
+	client  *Client
+	options WatchOptions
+	events  chan MailboxEvent
+
+	mutex  sync.Mutex
+	queue  []MailboxEvent
+	queued chan struct{} // signalled when queue is non-empty
+
+	closeOnce sync.Once
+	closeCh   chan struct{} // closed by Close
+	done      chan struct{} // closed when run returns
+	err       error
+}
+
+// Events returns a channel receiving mailbox updates.
+//
+// The channel is closed once the watcher has stopped and all updates have
+// been received, or once Close has been called.
+func (w *Watcher) Events() <-chan MailboxEvent {
+	return w.events
+}
+
+// Close stops watching the mailbox.
+//
+// An error is returned if the watcher has stopped because of a failure, e.g.
+// if the connection has been lost.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.closeCh)
+	})
+	<-w.done
+	return w.err
+}
+
+func (w *Watcher) run(idleCmd *IdleCommand) {
+	defer close(w.done)
+	defer w.unregister()
+
+	if idleCmd != nil {
+		for idleCmd != nil {
+			var err error
+			idleCmd, err = w.idle(idleCmd)
+			if err != nil {
+				w.err = err
+				return
+			}
+		}
+		return
+	}
+
+	for !w.closed() {
+		if err := w.poll(); err != nil {
+			w.err = err
+			return
+		}
+	}
+}
+
+// idle waits for the current IDLE command to be restarted or stopped. If it's
+// restarted, the new IDLE command is returned. Once the watcher is closed,
+// IDLE is stopped and nil is returned.
+func (w *Watcher) idle(idleCmd *IdleCommand) (*IdleCommand, error) {
+	timer := time.NewTimer(w.options.restartInterval())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-w.closeCh:
+	case <-w.client.decCh:
+		// The connection has been lost
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		return nil, err
+	}
+	if err := idleCmd.Wait(); err != nil {
+		return nil, err
+	}
+
+	if w.closed() {
+		return nil, nil
+	}
+	return w.client.Idle()
+}
+
+func (w *Watcher) poll() error {
+	timer := time.NewTimer(w.options.pollInterval())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return w.client.Noop().Wait()
+	case <-w.closeCh:
+		return nil
+	case <-w.client.decCh:
+		return w.client.Noop().Wait()
+	}
+}
+
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.closeCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Watcher) unregister() {
+	w.client.mutex.Lock()
+	if w.client.watcher == w {
+		w.client.watcher = nil
+	}
+	w.client.mutex.Unlock()
+}
+
+// push queues an event. It never blocks, so that the client decoder
+// goroutine isn't blocked by a slow consumer.
+func (w *Watcher) push(event MailboxEvent) {
+	w.mutex.Lock()
+	w.queue = append(w.queue, event)
+	w.mutex.Unlock()
+
+	select {
+	case w.queued <- struct{}{}:
+	default:
+	}
+}
+
+// pushFetch queues a FETCH event. The event is queued immediately to preserve
+// the order of events, but the message data is streamed by the client
+// decoder, so it's collected in a separate goroutine.
+func (w *Watcher) pushFetch(msg *FetchMessageData) {
+	event := &FetchEvent{collected: make(chan struct{})}
+	w.push(event)
+
+	go func() {
+		defer close(event.collected)
+		event.Message, _ = msg.Collect()
+	}()
+}
+
+// forward delivers queued events to the events channel.
+func (w *Watcher) forward() {
+	defer close(w.events)
+
+	for {
+		w.mutex.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mutex.Unlock()
+
+		for _, event := range queue {
+			if event, ok := event.(*FetchEvent); ok {
+				select {
+				case <-event.collected:
+				case <-w.closeCh:
+					return
+				}
+				if event.Message == nil {
+					continue // failed to read the FETCH response
+				}
+			}
+
+			select {
+			case w.events <- event:
+			case <-w.closeCh:
+				return
+			}
+		}
+
+		select {
+		case <-w.queued:
+		case <-w.done:
+			w.mutex.Lock()
+			empty := len(w.queue) == 0
+			w.mutex.Unlock()
+			if empty {
+				return
+			}
+		}
+	}
+}
+
+// wrapHandler returns a handler which delivers updates to the watcher, in
+// addition to handler.
+func (w *Watcher) wrapHandler(handler *UnilateralDataHandler) *UnilateralDataHandler {
+	return &UnilateralDataHandler{
+		Expunge: func(seqNum uint32) {
+			w.push(&ExpungeEvent{SeqNum: seqNum})
+			if handler.Expunge != nil {
+				handler.Expunge(seqNum)
+			}
+		},
+		Mailbox: func(data *UnilateralDataMailbox) {
+			if data.NumMessages != nil {
+				w.push(&ExistsEvent{NumMessages: *data.NumMessages})
+			}
+			if handler.Mailbox != nil {
+				handler.Mailbox(data)
+			}
+		},
+		// FETCH responses are handled by pushFetch
+		Vanished: func(uids imap.SeqSet, earlier bool) {
+			if !earlier {
+				w.push(&VanishedEvent{UIDs: uids})
+			}
+			if handler.Vanished != nil {
+				handler.Vanished(uids, earlier)
+			}
+		},
+		Status: handler.Status,
+		List:   handler.List,
+	}
+}
@@ -0,0 +1,174 @@
+package imapclient_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestWatch(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	var clients [2]*imapclient.Client
+	for i := range clients {
+		clients[i] = server.dial(t, nil)
+		defer clients[i].Close()
+		if err := clients[i].Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		if _, err := clients[i].Select("INBOX", nil).Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+	}
+	watchClient, client := clients[0], clients[1]
+
+	// Use a short restart interval to exercise IDLE restarts
+	watcher, err := watchClient.Watch(&imapclient.WatchOptions{RestartInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Watch() = %v", err)
+	}
+
+	nextEvent := func() imapclient.MailboxEvent {
+		select {
+		case event := <-watcher.Events():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for event")
+			return nil
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := appendMessage(client, "INBOX", "Subject: Hi\r\n\r\nHello!", nil); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if event, ok := nextEvent().(*imapclient.ExistsEvent); !ok || event.NumMessages != 1 {
+		t.Errorf("got event %#v, want EXISTS 1", event)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	storeFlags := imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagSeen}}
+	if err := client.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if event, ok := nextEvent().(*imapclient.FetchEvent); !ok {
+		t.Errorf("got event %#v, want FETCH", event)
+	} else if flags := event.Message.Flags; len(flags) != 1 || !strings.EqualFold(string(flags[0]), string(imap.FlagSeen)) {
+		t.Errorf("got FETCH event with flags %v, want \\Seen", flags)
+	}
+
+	if err := watcher.Close(); err != nil {
+		t.Fatalf("Watcher.Close() = %v", err)
+	}
+	if _, ok := <-watcher.Events(); ok {
+		t.Errorf("events channel not closed after Watcher.Close()")
+	}
+
+	// The client can be used again
+	if err := watchClient.Noop().Wait(); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+}
+
+func TestWatch_order(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.Close()
+
+	var clients [2]*imapclient.Client
+	for i := range clients {
+		clients[i] = server.dial(t, nil)
+		defer clients[i].Close()
+		if err := clients[i].Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+	}
+	watchClient, client := clients[0], clients[1]
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := appendMessage(client, "INBOX", "Subject: Hi\r\n\r\nHello!", nil); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	for _, c := range clients {
+		if _, err := c.Select("INBOX", nil).Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+	}
+
+	watcher, err := watchClient.Watch(nil)
+	if err != nil {
+		t.Fatalf("Watch() = %v", err)
+	}
+	defer watcher.Close()
+
+	// Each FETCH response is immediately followed by an EXPUNGE response
+	storeFlags := imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagDeleted}}
+	for i := 0; i < n; i++ {
+		if err := client.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+			t.Fatalf("Store() = %v", err)
+		}
+		if err := client.Expunge().Close(); err != nil {
+			t.Fatalf("Expunge() = %v", err)
+		}
+	}
+
+	for i := 0; i < 2*n; i++ {
+		var event imapclient.MailboxEvent
+		select {
+		case event = <-watcher.Events():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for event")
+		}
+		var ok bool
+		if i%2 == 0 {
+			_, ok = event.(*imapclient.FetchEvent)
+		} else {
+			_, ok = event.(*imapclient.ExpungeEvent)
+		}
+		if !ok {
+			t.Fatalf("event #%v: got %T, want alternating FETCH and EXPUNGE", i, event)
+		}
+	}
+}
+
+func TestWatch_closeDuringRestart(t *testing.T) {
+	client, server := newClientServerPair(t, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	// Closing the watcher while IDLE is being restarted must not leave a
+	// new IDLE command running
+	for i := 0; i < 100; i++ {
+		watcher, err := client.Watch(&imapclient.WatchOptions{RestartInterval: time.Millisecond})
+		if err != nil {
+			t.Fatalf("Watch() = %v", err)
+		}
+		time.Sleep(time.Duration(i%5) * time.Millisecond)
+		if err := watcher.Close(); err != nil {
+			t.Fatalf("Watcher.Close() = %v", err)
+		}
+
+		// Sending a command blocks while IDLE is running
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Noop().Wait()
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Noop() after Watcher.Close() = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for NOOP after Watcher.Close()")
+		}
+	}
+}
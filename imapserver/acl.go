@@ -0,0 +1,154 @@
+package imapserver
+
+import (
+	"context"
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleSetACL(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox, ri, modRights string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectSP() || !dec.ExpectAString(&modRights) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	rm := imap.RightModificationReplace
+	if len(modRights) > 0 {
+		switch modRights[0] {
+		case byte(imap.RightModificationAdd), byte(imap.RightModificationRemove):
+			rm = imap.RightModification(modRights[0])
+			modRights = modRights[1:]
+		}
+	}
+	rs, err := parseRightSet(modRights)
+	if err != nil {
+		return err
+	}
+
+	session, err := c.aclSession(ctx)
+	if err != nil {
+		return err
+	}
+	return session.SetACL(mailbox, imap.RightsIdentifier(ri), rm, rs)
+}
+
+func (c *Conn) handleDeleteACL(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox, ri string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession(ctx)
+	if err != nil {
+		return err
+	}
+	return session.DeleteACL(mailbox, imap.RightsIdentifier(ri))
+}
+
+func (c *Conn) handleGetACL(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := session.GetACL(mailbox)
+	if err != nil {
+		return err
+	}
+
+	identifiers := make([]string, 0, len(data.Rights))
+	for ri := range data.Rights {
+		identifiers = append(identifiers, string(ri))
+	}
+	sort.Strings(identifiers)
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("ACL").SP().Mailbox(mailbox)
+	for _, ri := range identifiers {
+		rs := data.Rights[imap.RightsIdentifier(ri)]
+		enc.SP().String(ri).SP().String(rs.String())
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) handleListRights(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox, ri string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := session.ListRights(mailbox, imap.RightsIdentifier(ri))
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("LISTRIGHTS").SP().Mailbox(mailbox).SP().String(ri).SP().String(data.Required.String())
+	for _, rs := range data.Optional {
+		enc.SP().String(rs.String())
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) handleMyRights(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := session.MyRights(mailbox)
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("MYRIGHTS").SP().Mailbox(mailbox).SP().String(data.Rights.String())
+	return enc.CRLF()
+}
+
+func (c *Conn) aclSession(ctx context.Context) (SessionACL, error) {
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return nil, err
+	}
+	session, ok := c.commandSession(ctx).(SessionACL)
+	if !ok {
+		return nil, newClientBugError("ACL is not supported")
+	}
+	return session, nil
+}
+
+// parseRightSet parses a list of rights. The obsolete "c" and "d" rights
+// are converted as described in RFC 4314 section 2.1.1.
+func parseRightSet(s string) (imap.RightSet, error) {
+	var rs imap.RightSet
+	for i := 0; i < len(s); i++ {
+		switch r := imap.Right(s[i]); {
+		case imap.AllRights.Has(r):
+			rs = rs.Add(imap.RightSet{r})
+		case r == 'c':
+			rs = rs.Add(imap.RightSet{imap.RightCreate})
+		case r == 'd':
+			rs = rs.Add(imap.RightSet{imap.RightDeleteMailbox, imap.RightDeleteMessages, imap.RightExpunge})
+		default:
+			return nil, newClientBugError("Unknown right: " + string(s[i]))
+		}
+	}
+	return rs, nil
+}
@@ -1,57 +1,44 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-// appendLimit is the maximum size of an APPEND payload.
-//
-// TODO: make configurable
-const appendLimit = 100 * 1024 * 1024 // 100MiB
-
-func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
-	var (
-		mailbox string
-		options imap.AppendOptions
-	)
+func (c *Conn) handleAppend(ctx context.Context, tag string, dec *imapwire.Decoder) error {
+	var mailbox string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
 		return dec.Err()
 	}
 
-	hasFlagList, err := dec.List(func() error {
-		flag, err := internal.ReadFlag(dec)
-		if err != nil {
-			return err
-		}
-		options.Flags = append(options.Flags, imap.Flag(flag))
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-	if hasFlagList && !dec.ExpectSP() {
-		return dec.Err()
+	if session, ok := c.commandSession(ctx).(SessionAppend); ok {
+		return c.handleAppendTransaction(ctx, tag, dec, session, mailbox)
 	}
 
-	t, err := internal.DecodeDateTime(dec)
+	var options imap.AppendOptions
+	catenate, err := c.readAppendMessage(dec, &options)
 	if err != nil {
 		return err
+	} else if catenate {
+		return newClientBugError("CATENATE is not supported")
 	}
-	if !t.IsZero() && !dec.ExpectSP() {
-		return dec.Err()
-	}
-	options.Time = t
 
 	lit, nonSync, err := dec.ExpectLiteralReader()
 	if err != nil {
 		return err
 	}
-	if lit.Size() > appendLimit {
+	if appendLimit := c.server.options.appendLimit(); lit.Size() > appendLimit {
+		if nonSync && lit.Size() <= 4096 {
+			// The client has already started sending the literal data
+			io.Copy(io.Discard, lit)
+			dec.CRLF()
+		}
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeTooBig,
@@ -63,7 +50,7 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 	}
 
 	c.setReadTimeout(literalReadTimeout)
-	defer c.setReadTimeout(cmdReadTimeout)
+	defer c.setReadTimeout(c.server.options.readTimeout())
 
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		io.Copy(io.Discard, lit)
@@ -71,22 +58,273 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 		return err
 	}
 
-	data, appendErr := c.session.Append(mailbox, lit, &options)
+	data, appendErr := c.commandSession(ctx).Append(mailbox, lit, &options)
 	if _, discardErr := io.Copy(io.Discard, lit); discardErr != nil {
 		return err
 	}
+	if options.UTF8 && !dec.ExpectSpecial(')') {
+		return dec.Err()
+	}
 	if !dec.ExpectCRLF() {
 		return err
 	}
 	if appendErr != nil {
 		return appendErr
 	}
-	if err := c.poll("APPEND"); err != nil {
+	if err := c.poll(ctx, "APPEND"); err != nil {
+		return err
+	}
+	return c.writeAppendOK(tag, data)
+}
+
+// handleAppendTransaction handles an APPEND command with a session which
+// supports MULTIAPPEND and CATENATE.
+func (c *Conn) handleAppendTransaction(ctx context.Context, tag string, dec *imapwire.Decoder, session SessionAppend, mailbox string) error {
+	var (
+		tx        AppendTransaction
+		committed bool
+		// once set, the remaining messages are discarded
+		cmdErr error
+	)
+	defer func() {
+		if tx != nil && !committed {
+			if err := tx.Rollback(); err != nil {
+				c.server.logger().Printf("failed to roll back APPEND: %v", err)
+			}
+		}
+	}()
+
+	c.setReadTimeout(literalReadTimeout)
+	defer c.setReadTimeout(c.server.options.readTimeout())
+
+	var (
+		appendLimit = c.server.options.appendLimit()
+		txLimit     = c.server.options.appendTransactionLimit()
+		// sizes of the current message and of all messages, in bytes
+		msgSize, txSize int64
+	)
+	checkSize := func() error {
+		if msgSize > appendLimit {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeTooBig,
+				Text: fmt.Sprintf("Messages are limited to %v bytes", appendLimit),
+			}
+		}
+		if txSize > txLimit {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeTooBig,
+				Text: fmt.Sprintf("APPEND commands are limited to %v bytes", txLimit),
+			}
+		}
+		return nil
+	}
+	readLiteral := func() (*imapwire.LiteralReader, error) {
+		lit, nonSync, err := dec.ExpectLiteralReader()
+		if err != nil {
+			return nil, err
+		}
+		if cmdErr == nil {
+			msgSize += lit.Size()
+			txSize += lit.Size()
+			cmdErr = checkSize()
+		}
+		if cmdErr != nil {
+			if !nonSync || lit.Size() > 4096 {
+				// The client won't send the literal data
+				return nil, cmdErr
+			}
+			// The client has already started sending the literal data
+			_, err := io.Copy(io.Discard, lit)
+			return nil, err
+		}
+		if err := c.acceptLiteral(lit.Size(), nonSync); err != nil {
+			return nil, err
+		}
+		return lit, nil
+	}
+
+	for n := 0; ; n++ {
+		if n > 0 && !c.server.options.caps().Has(imap.CapMultiAppend) {
+			return newClientBugError("MULTIAPPEND is not supported")
+		}
+		if cmdErr == nil && n >= maxAppendMessages {
+			cmdErr = &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeLimit,
+				Text: fmt.Sprintf("APPEND commands are limited to %v messages", maxAppendMessages),
+			}
+		}
+
+		var options imap.AppendOptions
+		catenate, err := c.readAppendMessage(dec, &options)
+		if err != nil {
+			return err
+		}
+
+		if cmdErr == nil && tx == nil {
+			if cmdErr = c.checkState(imap.ConnStateAuthenticated); cmdErr == nil {
+				tx, cmdErr = session.BeginAppend(mailbox)
+			}
+		}
+
+		msgSize = 0
+		if catenate {
+			var parts []imap.CatenatePart
+			err := dec.ExpectList(func() error {
+				part, err := readCatenatePart(dec, readLiteral)
+				if err != nil {
+					return err
+				} else if part != nil {
+					parts = append(parts, *part)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if cmdErr == nil {
+				// URL parts are only accounted for once resolved
+				var size int64
+				size, cmdErr = tx.Catenate(parts, &options)
+				txSize += size - msgSize
+				msgSize = size
+			}
+			if cmdErr == nil {
+				cmdErr = checkSize()
+			}
+		} else {
+			lit, err := readLiteral()
+			if err != nil {
+				return err
+			} else if lit != nil {
+				cmdErr = tx.Append(lit, &options)
+				if _, err := io.Copy(io.Discard, lit); err != nil {
+					return err
+				}
+			}
+		}
+
+		if options.UTF8 && !dec.ExpectSpecial(')') {
+			return dec.Err()
+		}
+		if !dec.SP() {
+			break
+		}
+	}
+
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+	if cmdErr != nil {
+		return cmdErr
+	}
+
+	committed = true
+	data, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if err := c.poll(ctx, "APPEND"); err != nil {
 		return err
 	}
 	return c.writeAppendOK(tag, data)
 }
 
+// readCatenatePart reads a CATENATE part. If the TEXT literal is discarded
+// by readLiteral, nil is returned.
+func readCatenatePart(dec *imapwire.Decoder, readLiteral func() (*imapwire.LiteralReader, error)) (*imap.CatenatePart, error) {
+	var typ string
+	if !dec.ExpectAtom(&typ) || !dec.ExpectSP() {
+		return nil, dec.Err()
+	}
+	switch strings.ToUpper(typ) {
+	case "URL":
+		var url string
+		if !dec.ExpectAString(&url) {
+			return nil, dec.Err()
+		}
+		return &imap.CatenatePart{URL: url}, nil
+	case "TEXT":
+		lit, err := readLiteral()
+		if err != nil || lit == nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(lit)
+		if err != nil {
+			return nil, err
+		}
+		return &imap.CatenatePart{Text: b}, nil
+	default:
+		return nil, newClientBugError("Unknown CATENATE part type")
+	}
+}
+
+// readAppendMessage reads the options of a message of an APPEND command, up to
+// the message data. If catenate is true, the message data is a list of
+// CATENATE parts. Otherwise, it's a literal.
+func (c *Conn) readAppendMessage(dec *imapwire.Decoder, options *imap.AppendOptions) (catenate bool, err error) {
+	hasFlagList, err := dec.List(func() error {
+		flag, err := internal.ReadFlag(dec)
+		if err != nil {
+			return err
+		}
+		options.Flags = append(options.Flags, imap.Flag(flag))
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if hasFlagList && !dec.ExpectSP() {
+		return false, dec.Err()
+	}
+
+	t, err := internal.DecodeDateTime(dec)
+	if err != nil {
+		return false, err
+	}
+	if !t.IsZero() && !dec.ExpectSP() {
+		return false, dec.Err()
+	}
+	options.Time = t
+
+	var atom string
+	if dec.Special('~') {
+		// literal8
+		if !c.server.options.caps().Has(imap.CapBinary) {
+			return false, newClientBugError("BINARY is not supported")
+		}
+		options.Binary = true
+	} else if dec.Atom(&atom) {
+		switch strings.ToUpper(atom) {
+		case "UTF8":
+			// "UTF8" SP "(" literal8 ")", as defined in RFC 6855
+			if !c.utf8AcceptEnabled() {
+				return false, newClientBugError("UTF8=ACCEPT is not enabled")
+			}
+			if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectSpecial('~') {
+				return false, dec.Err()
+			}
+			options.UTF8 = true
+		case "CATENATE":
+			// "CATENATE" SP "(" cat-part *(SP cat-part) ")", as defined in
+			// RFC 4469
+			if !c.server.options.caps().Has(imap.CapCatenate) {
+				return false, newClientBugError("CATENATE is not supported")
+			}
+			if !dec.ExpectSP() {
+				return false, dec.Err()
+			}
+			return true, nil
+		default:
+			return false, newClientBugError("Expected UTF8, CATENATE or message literal")
+		}
+	}
+
+	return false, nil
+}
+
 func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -94,7 +332,12 @@ func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
 	enc.Atom(tag).SP().Atom("OK").SP()
 	if data != nil {
 		enc.Special('[')
-		enc.Atom("APPENDUID").SP().Number(data.UIDValidity).SP().Number(data.UID)
+		enc.Atom("APPENDUID").SP().Number(data.UIDValidity).SP()
+		if len(data.UIDs) > 0 {
+			enc.SeqSet(data.UIDs)
+		} else {
+			enc.Number(data.UID)
+		}
 		enc.Special(']').SP()
 	}
 	enc.Text("APPEND completed")
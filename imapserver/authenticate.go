@@ -1,17 +1,16 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	"github.com/emersion/go-sasl"
-
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
+func (c *Conn) handleAuthenticate(ctx context.Context, tag string, dec *imapwire.Decoder) error {
 	var mech string
 	if !dec.ExpectSP() || !dec.ExpectAtom(&mech) {
 		return dec.Err()
@@ -46,30 +45,10 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 		}
 	}
 
-	var saslServer sasl.Server
-	if authSess, ok := c.session.(SessionSASL); ok {
-		var err error
-		saslServer, err = authSess.Authenticate(mech)
-		if err != nil {
-			return err
-		}
-	} else {
-		if mech != "PLAIN" {
-			return &imap.Error{
-				Type: imap.StatusResponseTypeNo,
-				Text: "SASL mechanism not supported",
-			}
-		}
-		saslServer = sasl.NewPlainServer(func(identity, username, password string) error {
-			if identity != "" && identity != username {
-				return &imap.Error{
-					Type: imap.StatusResponseTypeNo,
-					Code: imap.ResponseCodeAuthorizationFailed,
-					Text: "SASL identity not supported",
-				}
-			}
-			return c.session.Login(username, password)
-		})
+	var authUser string // set by built-in mechanisms
+	saslServer, err := c.newSASLServer(ctx, mech, &authUser)
+	if err != nil {
+		return err
 	}
 
 	enc := newResponseEncoder(c)
@@ -110,6 +89,11 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 		}
 	}
 
+	if authUser != "" && !c.server.trackUser(c, authUser) {
+		c.state = imap.ConnStateLogout
+		return writeStatusResp(enc.Encoder, "", tooManyUserConnsResp)
+	}
+
 	c.state = imap.ConnStateAuthenticated
 	text := fmt.Sprintf("%v authentication successful", mech)
 	return writeCapabilityOK(enc.Encoder, tag, c.availableCaps(), text)
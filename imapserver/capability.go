@@ -1,6 +1,9 @@
 package imapserver
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
@@ -43,15 +46,12 @@ func (c *Conn) availableCaps() []imap.Cap {
 			imap.CapLiteralMinus,
 		}...)
 	}
+	addAvailableCaps(&caps, available, []imap.Cap{imap.CapID})
 	if c.canStartTLS() {
 		caps = append(caps, imap.CapStartTLS)
 	}
 	if c.canAuth() {
-		mechs := []string{"PLAIN"}
-		if authSess, ok := c.session.(SessionSASL); ok {
-			mechs = authSess.AuthenticateMechanisms()
-		}
-		for _, mech := range mechs {
+		for _, mech := range c.authMechanisms() {
 			caps = append(caps, imap.Cap("AUTH="+mech))
 		}
 	} else if c.state == imap.ConnStateNotAuthenticated {
@@ -63,8 +63,10 @@ func (c *Conn) availableCaps() []imap.Cap {
 				imap.CapUnselect,
 				imap.CapEnable,
 				imap.CapIdle,
+				// SEARCHRES is implemented on top of the regular SEARCH
+				// backend method
+				imap.CapSearchRes,
 			}...)
-			// TODO: implement imap.CapSearchRes
 			addAvailableCaps(&caps, available, []imap.Cap{
 				imap.CapNamespace,
 				imap.CapUIDPlus,
@@ -73,7 +75,42 @@ func (c *Conn) availableCaps() []imap.Cap {
 				imap.CapListStatus,
 				imap.CapMove,
 				imap.CapStatusSize,
+				imap.CapCondStore,
+				imap.CapQResync,
+				imap.CapSort,
+				imap.CapMetadata,
+				imap.CapMetadataServer,
+				imap.CapACL,
+				imap.CapBinary,
+				imap.CapUTF8Accept,
+				imap.CapNotify,
+				imap.CapMultiAppend,
+				imap.CapCatenate,
+			})
+			caps = append(caps, imap.Cap(fmt.Sprintf("APPENDLIMIT=%v", c.server.options.appendLimit())))
+			if available.Has(imap.CapCompressDeflate) && !c.isCompressed() {
+				caps = append(caps, imap.CapCompressDeflate)
+			}
+			if available.Has(imap.CapACL) {
+				// All rights defined in RFC 4314 are supported
+				caps = append(caps, imap.Cap("RIGHTS=texk"))
+			}
+			algs := available.ThreadAlgorithms()
+			sort.Slice(algs, func(i, j int) bool {
+				return algs[i] < algs[j]
 			})
+			for _, alg := range algs {
+				caps = append(caps, imap.Cap("THREAD="+string(alg)))
+			}
+			if quotaSess, ok := c.session.(SessionQuota); ok {
+				caps = append(caps, imap.CapQuota)
+				for _, typ := range quotaSess.QuotaResourceTypes() {
+					caps = append(caps, imap.Cap("QUOTA=RES-"+string(typ)))
+				}
+				if _, ok := c.session.(SessionQuotaSet); ok {
+					caps = append(caps, imap.CapQuotaSet)
+				}
+			}
 		}
 	}
 	return caps
@@ -0,0 +1,79 @@
+package imapserver
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleCompress(tag string, dec *imapwire.Decoder) error {
+	var alg string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&alg) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	if !c.server.options.caps().Has(imap.CapCompressDeflate) || strings.ToUpper(alg) != "DEFLATE" {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeBad,
+			Text: "Unsupported compression algorithm",
+		}
+	}
+	if c.isCompressed() {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeCompressionActive,
+			Text: "Compression is already active",
+		}
+	}
+
+	// Do not allow to write uncompressed data past this point: keep
+	// c.encMutex locked until the end
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	err := writeStatusResp(enc.Encoder, tag, &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Text: "Begin compression now",
+	})
+	if err != nil {
+		return err
+	}
+
+	// Drain buffered data from our bufio.Reader
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(c.br.Buffered())); err != nil {
+		panic(err) // unreachable
+	}
+
+	var r io.Reader = c.conn
+	if buf.Len() > 0 {
+		r = io.MultiReader(&buf, c.conn)
+	}
+
+	// c.conn is left unchanged, so that NetConn keeps returning the
+	// underlying connection
+	compressConn := internal.NewDeflateConn(c.conn, r)
+
+	c.mutex.Lock()
+	c.compressed = true
+	c.mutex.Unlock()
+
+	rw := c.server.options.wrapReadWriter(compressConn)
+	c.br.Reset(rw)
+	c.bw.Reset(rw)
+
+	return nil
+}
+
+func (c *Conn) isCompressed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.compressed
+}
@@ -0,0 +1,312 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// maxConcurrentCommands is the maximum number of commands executed
+// concurrently for a single connection.
+const maxConcurrentCommands = 16
+
+// isConcurrentCommand checks whether a command may be executed concurrently
+// with other commands, as described in RFC 9051 section 5.5.
+//
+// These commands don't change the connection state nor the mailbox contents.
+func isConcurrentCommand(name string) bool {
+	switch name {
+	case "FETCH", "UID FETCH", "SEARCH", "UID SEARCH", "SORT", "UID SORT", "THREAD", "UID THREAD":
+		return true
+	case "STATUS", "LIST", "LSUB", "NAMESPACE":
+		return true
+	case "GETQUOTA", "GETQUOTAROOT", "GETMETADATA", "GETACL", "LISTRIGHTS", "MYRIGHTS":
+		return true
+	default:
+		return false
+	}
+}
+
+// isStreamedCommand checks whether a command reads from the connection while
+// it's executed, in which case its arguments can't be read into memory
+// beforehand.
+func isStreamedCommand(name string) bool {
+	switch name {
+	case "APPEND", "AUTHENTICATE", "IDLE", "STARTTLS", "COMPRESS":
+		return true
+	default:
+		return false
+	}
+}
+
+// readSequentialCommand reads the arguments of a command and executes it.
+func (c *Conn) readSequentialCommand(tag, name string, numKind NumKind) error {
+	args, err := c.readCommandArgs()
+	if err != nil {
+		var imapErr *imap.Error
+		if errors.As(err, &imapErr) {
+			return c.writeStatusResp(tag, (*imap.StatusResponse)(imapErr))
+		}
+		return err
+	}
+
+	return c.handleWatchedCommand(tag, name, numKind, c.newArgsDecoder(args))
+}
+
+// readConcurrentCommand reads the arguments of a command and starts
+// executing it in a separate goroutine, so that the next command can be read.
+func (c *Conn) readConcurrentCommand(tag, name string, numKind NumKind) error {
+	args, err := c.readCommandArgs()
+	if err != nil {
+		var imapErr *imap.Error
+		if errors.As(err, &imapErr) {
+			return c.writeStatusResp(tag, (*imap.StatusResponse)(imapErr))
+		}
+		return err
+	}
+
+	dec := c.newArgsDecoder(args)
+	if c.mustRunSequentially(name, args) {
+		c.waitCommands()
+		return c.handleWatchedCommand(tag, name, numKind, dec)
+	}
+
+	c.cmdSem <- struct{}{}
+	c.cmdWG.Add(1)
+	go func() {
+		defer func() {
+			<-c.cmdSem
+			c.cmdWG.Done()
+		}()
+		defer func() {
+			if v := recover(); v != nil {
+				c.server.logger().Printf("panic handling command: %v\n%s", v, debug.Stack())
+				c.NetConn().Close()
+			}
+		}()
+
+		if err := c.handleCommand(tag, name, numKind, dec); err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.server.logger().Printf("failed to handle command: %v", err)
+			}
+			c.NetConn().Close()
+		}
+	}()
+	return nil
+}
+
+// newArgsDecoder creates a decoder for command arguments read into memory.
+func (c *Conn) newArgsDecoder(args []byte) *imapwire.Decoder {
+	dec := imapwire.NewDecoder(bufio.NewReader(bytes.NewReader(args)), imapwire.ConnSideServer)
+	dec.MailboxUTF8 = c.utf8AcceptEnabled()
+	return dec
+}
+
+// mustRunSequentially checks whether a command which may otherwise be
+// executed concurrently must wait for other commands to complete. The
+// arguments are parsed separately for this purpose: parse errors are left to
+// the command handler.
+func (c *Conn) mustRunSequentially(name string, args []byte) bool {
+	dec := c.newArgsDecoder(args)
+
+	var criteria *imap.SearchCriteria
+	switch name {
+	case "FETCH", "UID FETCH":
+		numSet, items, _, err := readFetch(dec)
+		_, isSearchRes := numSet.(imap.SearchRes)
+		// The implicit \Seen flag change may affect the result of other
+		// commands
+		return err == nil && (isSearchRes || fetchMaySetSeen(items))
+	case "SEARCH", "UID SEARCH":
+		var (
+			options *imap.SearchOptions
+			err     error
+		)
+		criteria, options, _, err = c.readSearch(dec)
+		if err != nil {
+			return false
+		} else if hasSearchReturnOpt(options.Return, imap.SearchReturnSave) {
+			// Commands saving or referencing the search result must not
+			// run concurrently with each other, see RFC 5182 section 2.1
+			return true
+		}
+	case "SORT", "UID SORT":
+		var err error
+		if _, criteria, err = readSort(dec); err != nil {
+			return false
+		}
+	case "THREAD", "UID THREAD":
+		var err error
+		if _, criteria, err = readThread(dec); err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	return searchCriteriaUsesSearchRes(criteria)
+}
+
+// handleWatchedCommand executes a command whose arguments have been read into
+// memory. Meanwhile, the connection is watched so that the command is
+// cancelled if the client disconnects.
+func (c *Conn) handleWatchedCommand(tag, name string, numKind NumKind, dec *imapwire.Decoder) error {
+	if c.isCompressed() {
+		// Interrupting a read would corrupt the decompressor state
+		return c.handleCommand(tag, name, numKind, dec)
+	}
+
+	// The client may legitimately wait for the command to complete
+	c.setReadTimeout(0)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Data sent by the client is left buffered for the next command
+		if _, err := c.br.Peek(1); err != nil {
+			select {
+			case <-stop:
+				// Read interrupted below
+			default:
+				c.cancel()
+			}
+		}
+	}()
+
+	err := c.handleCommand(tag, name, numKind, dec)
+
+	close(stop)
+	c.conn.SetReadDeadline(time.Now())
+	<-done
+	return err
+}
+
+// waitCommands waits for all commands executed concurrently to complete.
+func (c *Conn) waitCommands() {
+	c.cmdWG.Wait()
+}
+
+// readCommandArgs reads the rest of the current command into memory,
+// including literals.
+func (c *Conn) readCommandArgs() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := c.br.ReadBytes('\n')
+		buf.Write(line)
+		if err != nil {
+			return nil, err
+		}
+
+		size, nonSync, ok := parseLiteralSuffix(line)
+		if !ok {
+			return buf.Bytes(), nil
+		}
+		if err := c.checkBufferedLiteral(size, nonSync); err != nil {
+			if nonSync && size <= 4096 {
+				// The client has already started sending the literal data
+				if err := c.discardCommandArgs(size); err != nil {
+					return nil, err
+				}
+			}
+			return nil, err
+		}
+		if _, err := io.CopyN(&buf, c.br, size); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// discardCommandArgs discards the rest of a rejected command, starting with
+// literal data of the specified size.
+func (c *Conn) discardCommandArgs(size int64) error {
+	for {
+		if _, err := io.CopyN(io.Discard, c.br, size); err != nil {
+			return err
+		}
+		line, err := c.br.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		var nonSync, ok bool
+		size, nonSync, ok = parseLiteralSuffix(line)
+		if !ok || !nonSync || size > 4096 {
+			// The client waits for a continuation request before sending
+			// synchronizing literals
+			return nil
+		}
+	}
+}
+
+// parseLiteralSuffix checks whether a line ends with a literal prefix, ie.
+// "{<size>}" or "{<size>+}" followed by CRLF.
+func parseLiteralSuffix(line []byte) (size int64, nonSync, ok bool) {
+	line = bytes.TrimSuffix(line, []byte("\r\n"))
+	if !bytes.HasSuffix(line, []byte("}")) {
+		return 0, false, false
+	}
+	line = line[:len(line)-1]
+	i := bytes.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false, false
+	}
+	s := line[i+1:]
+	if bytes.HasSuffix(s, []byte("+")) {
+		nonSync = true
+		s = s[:len(s)-1]
+	}
+	size, err := strconv.ParseInt(string(s), 10, 64)
+	if err != nil || size < 0 {
+		return 0, false, false
+	}
+	return size, nonSync, true
+}
+
+// fetchMaySetSeen checks whether FETCH data items implicitly set the \Seen
+// flag.
+func fetchMaySetSeen(items []imap.FetchItem) bool {
+	for _, item := range items {
+		switch item := item.(type) {
+		case *imap.FetchItemBodySection:
+			if !item.Peek {
+				return true
+			}
+		case *imap.FetchItemBinarySection:
+			if !item.Peek {
+				return true
+			}
+		case imap.FetchItemKeyword:
+			if item == internal.FetchItemRFC822 || item == internal.FetchItemRFC822Text {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchCriteriaUsesSearchRes checks whether search criteria reference the
+// saved search result.
+func searchCriteriaUsesSearchRes(criteria *imap.SearchCriteria) bool {
+	if criteria.SearchRes {
+		return true
+	}
+	for i := range criteria.Not {
+		if searchCriteriaUsesSearchRes(&criteria.Not[i]) {
+			return true
+		}
+	}
+	for i := range criteria.Or {
+		if searchCriteriaUsesSearchRes(&criteria.Or[i][0]) || searchCriteriaUsesSearchRes(&criteria.Or[i][1]) {
+			return true
+		}
+	}
+	return false
+}
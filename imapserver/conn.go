@@ -2,6 +2,7 @@ package imapserver
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -16,15 +17,6 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-const (
-	cmdReadTimeout     = 30 * time.Second
-	idleReadTimeout    = 35 * time.Minute // section 5.4 says 30min minimum
-	literalReadTimeout = 5 * time.Minute
-
-	respWriteTimeout    = 30 * time.Second
-	literalWriteTimeout = 5 * time.Minute
-)
-
 var internalServerErrorResp = &imap.StatusResponse{
 	Type: imap.StatusResponseTypeNo,
 	Code: imap.ResponseCodeServerBug,
@@ -38,25 +30,47 @@ type Conn struct {
 	bw       *bufio.Writer
 	encMutex sync.Mutex
 
-	mutex   sync.Mutex
-	conn    net.Conn
-	enabled imap.CapSet
+	remoteIP string // immutable
+	username string // protected by Server.mutex
+
+	ctx    context.Context // cancelled when the connection is closed
+	cancel context.CancelFunc
+
+	mutex      sync.Mutex
+	conn       net.Conn
+	compressed bool // c.br and c.bw use a DeflateConn wrapping conn
+	enabled    imap.CapSet
+	clientID   map[string]string
+	shutdown   bool // server is shutting down
+	waiting    bool // waiting for the client to send data
+	// UIDs saved by the last SEARCH command with the SAVE return option
+	searchRes imap.SeqSet
+	selected  string // name of the selected mailbox
 
 	state   imap.ConnState
 	session Session
+
+	cmdWG     sync.WaitGroup
+	cmdSem    chan struct{} // one token per concurrent command in progress
+	pollMutex sync.Mutex
+	notifier  *notifier // set by NOTIFY, nil if disabled
 }
 
 func newConn(c net.Conn, server *Server) *Conn {
 	rw := server.options.wrapReadWriter(c)
 	br := bufio.NewReader(rw)
 	bw := bufio.NewWriter(rw)
-	return &Conn{
-		conn:    c,
-		server:  server,
-		br:      br,
-		bw:      bw,
-		enabled: make(imap.CapSet),
+	conn := &Conn{
+		conn:     c,
+		remoteIP: remoteIP(c),
+		server:   server,
+		br:       br,
+		bw:       bw,
+		enabled:  make(imap.CapSet),
+		cmdSem:   make(chan struct{}, maxConcurrentCommands),
 	}
+	conn.ctx, conn.cancel = context.WithCancel(context.WithValue(context.Background(), connContextKey, conn))
+	return conn
 }
 
 // NetConn returns the underlying connection that is wrapped by the IMAP
@@ -92,14 +106,36 @@ func (c *Conn) serve() {
 		c.conn.Close()
 	}()
 
-	c.server.mutex.Lock()
-	c.server.conns[c] = struct{}{}
-	c.server.mutex.Unlock()
-	defer func() {
-		c.server.mutex.Lock()
-		delete(c.server.conns, c)
-		c.server.mutex.Unlock()
-	}()
+	tlsConn, isTLS := c.conn.(*tls.Conn)
+	if isTLS {
+		// Writing the greeting or the BYE response performs the TLS
+		// handshake: don't let it block forever
+		c.conn.SetDeadline(time.Now().Add(c.server.options.readTimeout()))
+	}
+
+	if resp := c.server.trackConn(c); resp != nil {
+		if err := c.writeStatusResp("", resp); err != nil {
+			c.server.logger().Printf("failed to write greeting: %v", err)
+		}
+		return
+	}
+	defer c.server.untrackConn(c)
+
+	// Complete the TLS handshake before sending the greeting, so that the
+	// client certificate is known when listing capabilities
+	if isTLS {
+		// Shutdown interrupts the handshake like any other wait for the
+		// client
+		if !c.beginWait() {
+			return
+		}
+		err := tlsConn.HandshakeContext(c.ctx)
+		c.endWait()
+		if err != nil {
+			c.server.logger().Printf("TLS handshake failed: %v", err)
+			return
+		}
+	}
 
 	var err error
 	c.session, err = c.server.options.NewSession(c)
@@ -127,6 +163,9 @@ func (c *Conn) serve() {
 			}
 		}
 	}()
+	defer c.waitCommands()
+	// Commands in progress are cancelled once the connection is closed
+	defer c.cancel()
 
 	caps := c.server.options.caps()
 	if _, ok := c.session.(SessionIMAP4rev2); !ok && caps.Has(imap.CapIMAP4rev2) {
@@ -138,6 +177,30 @@ func (c *Conn) serve() {
 	if _, ok := c.session.(SessionMove); !ok && caps.Has(imap.CapMove) {
 		panic("imapserver: server advertises MOVE but session doesn't support it")
 	}
+	if _, ok := c.session.(SessionCondStore); !ok && caps.Has(imap.CapCondStore) {
+		panic("imapserver: server advertises CONDSTORE but session doesn't support it")
+	}
+	if caps.Has(imap.CapQResync) && !caps.Has(imap.CapCondStore) {
+		panic("imapserver: server advertises QRESYNC but not CONDSTORE")
+	}
+	if _, ok := c.session.(SessionSort); !ok && caps.Has(imap.CapSort) {
+		panic("imapserver: server advertises SORT but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionThread); !ok && len(caps.ThreadAlgorithms()) > 0 {
+		panic("imapserver: server advertises THREAD but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionACL); !ok && caps.Has(imap.CapACL) {
+		panic("imapserver: server advertises ACL but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionMetadata); !ok && (caps.Has(imap.CapMetadata) || caps.Has(imap.CapMetadataServer)) {
+		panic("imapserver: server advertises METADATA but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionAppend); !ok && (caps.Has(imap.CapMultiAppend) || caps.Has(imap.CapCatenate)) {
+		panic("imapserver: server advertises MULTIAPPEND or CATENATE but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionNotify); !ok && caps.Has(imap.CapNotify) {
+		panic("imapserver: server advertises NOTIFY but session doesn't support it")
+	}
 
 	c.state = imap.ConnStateNotAuthenticated
 	if err := c.writeCapabilityOK("", "IMAP server ready"); err != nil {
@@ -149,20 +212,42 @@ func (c *Conn) serve() {
 		var readTimeout time.Duration
 		switch c.state {
 		case imap.ConnStateAuthenticated, imap.ConnStateSelected:
-			readTimeout = idleReadTimeout
+			readTimeout = c.server.options.idleTimeout()
 		default:
-			readTimeout = cmdReadTimeout
+			readTimeout = c.server.options.readTimeout()
 		}
 		c.setReadTimeout(readTimeout)
 
 		dec := imapwire.NewDecoder(c.br, imapwire.ConnSideServer)
 		dec.CheckBufferedLiteralFunc = c.checkBufferedLiteral
+		dec.MailboxUTF8 = c.utf8AcceptEnabled()
 
-		if c.state == imap.ConnStateLogout || dec.EOF() {
+		if c.state == imap.ConnStateLogout {
+			break
+		}
+		if !c.beginWait() {
+			if err := c.byeShutdown(); err != nil {
+				c.server.logger().Printf("failed to write BYE: %v", err)
+			}
+			break
+		}
+		eof := dec.EOF()
+		if c.endWait() && c.br.Buffered() == 0 {
+			if err := c.byeShutdown(); err != nil {
+				c.server.logger().Printf("failed to write BYE: %v", err)
+			}
+			break
+		} else if eof {
+			break
+		} else if err := dec.Err(); err != nil {
+			// Don't let readCommand reset the idle timeout
+			if !errors.Is(err, net.ErrClosed) {
+				c.server.logger().Printf("failed to read command: %v", err)
+			}
 			break
 		}
 
-		c.setReadTimeout(cmdReadTimeout)
+		c.setReadTimeout(c.server.options.readTimeout())
 		if err := c.readCommand(dec); err != nil {
 			if !errors.Is(err, net.ErrClosed) {
 				c.server.logger().Printf("failed to read command: %v", err)
@@ -189,7 +274,22 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		name = "UID " + strings.ToUpper(subName)
 	}
 
-	// TODO: handle multiple commands concurrently
+	if c.server.options.ConcurrentCommands && isConcurrentCommand(name) {
+		return c.readConcurrentCommand(tag, name, numKind)
+	}
+
+	// Other commands must wait for all pending commands to complete
+	c.waitCommands()
+	if isStreamedCommand(name) {
+		return c.handleCommand(tag, name, numKind, dec)
+	}
+	return c.readSequentialCommand(tag, name, numKind)
+}
+
+func (c *Conn) handleCommand(tag, name string, numKind NumKind, dec *imapwire.Decoder) error {
+	ctx, cancel := c.newCommandContext(tag, name)
+	defer cancel()
+
 	sendOK := true
 	var err error
 	switch name {
@@ -199,60 +299,93 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		err = c.handleLogout(dec)
 	case "CAPABILITY":
 		err = c.handleCapability(dec)
+	case "ID":
+		err = c.handleID(ctx, dec)
+	case "COMPRESS":
+		err = c.handleCompress(tag, dec)
+		sendOK = false
 	case "STARTTLS":
 		err = c.handleStartTLS(tag, dec)
 		sendOK = false
 	case "AUTHENTICATE":
-		err = c.handleAuthenticate(tag, dec)
+		err = c.handleAuthenticate(ctx, tag, dec)
 		sendOK = false
 	case "LOGIN":
-		err = c.handleLogin(tag, dec)
+		err = c.handleLogin(ctx, tag, dec)
 		sendOK = false
 	case "ENABLE":
 		err = c.handleEnable(dec)
 	case "CREATE":
-		err = c.handleCreate(dec)
+		err = c.handleCreate(ctx, dec)
 	case "DELETE":
-		err = c.handleDelete(dec)
+		err = c.handleDelete(ctx, dec)
 	case "RENAME":
-		err = c.handleRename(dec)
+		err = c.handleRename(ctx, dec)
 	case "SUBSCRIBE":
-		err = c.handleSubscribe(dec)
+		err = c.handleSubscribe(ctx, dec)
 	case "UNSUBSCRIBE":
-		err = c.handleUnsubscribe(dec)
+		err = c.handleUnsubscribe(ctx, dec)
 	case "STATUS":
-		err = c.handleStatus(dec)
+		err = c.handleStatus(ctx, dec)
 	case "LIST":
-		err = c.handleList(dec)
+		err = c.handleList(ctx, dec)
 	case "LSUB":
-		err = c.handleLSub(dec)
+		err = c.handleLSub(ctx, dec)
 	case "NAMESPACE":
-		err = c.handleNamespace(dec)
+		err = c.handleNamespace(ctx, dec)
 	case "IDLE":
-		err = c.handleIdle(dec)
+		err = c.handleIdle(ctx, dec)
 	case "SELECT", "EXAMINE":
-		err = c.handleSelect(tag, dec, name == "EXAMINE")
+		err = c.handleSelect(ctx, tag, dec, name == "EXAMINE")
 		sendOK = false
 	case "CLOSE", "UNSELECT":
-		err = c.handleUnselect(dec, name == "CLOSE")
+		err = c.handleUnselect(ctx, dec, name == "CLOSE")
 	case "APPEND":
-		err = c.handleAppend(tag, dec)
+		err = c.handleAppend(ctx, tag, dec)
 		sendOK = false
 	case "FETCH", "UID FETCH":
-		err = c.handleFetch(dec, numKind)
+		err = c.handleFetch(ctx, dec, numKind)
 	case "EXPUNGE":
-		err = c.handleExpunge(dec)
+		err = c.handleExpunge(ctx, dec)
 	case "UID EXPUNGE":
-		err = c.handleUIDExpunge(dec)
+		err = c.handleUIDExpunge(ctx, dec)
 	case "STORE", "UID STORE":
-		err = c.handleStore(dec, numKind)
+		err = c.handleStore(ctx, tag, dec, numKind)
+		sendOK = false
 	case "COPY", "UID COPY":
-		err = c.handleCopy(tag, dec, numKind)
+		err = c.handleCopy(ctx, tag, dec, numKind)
 		sendOK = false
 	case "MOVE", "UID MOVE":
-		err = c.handleMove(dec, numKind)
+		err = c.handleMove(ctx, dec, numKind)
 	case "SEARCH", "UID SEARCH":
-		err = c.handleSearch(tag, dec, numKind)
+		err = c.handleSearch(ctx, tag, dec, numKind)
+	case "SORT", "UID SORT":
+		err = c.handleSort(ctx, dec, numKind)
+	case "THREAD", "UID THREAD":
+		err = c.handleThread(ctx, dec, numKind)
+	case "GETQUOTA":
+		err = c.handleGetQuota(ctx, dec)
+	case "GETQUOTAROOT":
+		err = c.handleGetQuotaRoot(ctx, dec)
+	case "SETQUOTA":
+		err = c.handleSetQuota(ctx, dec)
+	case "GETMETADATA":
+		err = c.handleGetMetadata(ctx, tag, dec)
+		sendOK = false
+	case "SETMETADATA":
+		err = c.handleSetMetadata(ctx, dec)
+	case "SETACL":
+		err = c.handleSetACL(ctx, dec)
+	case "DELETEACL":
+		err = c.handleDeleteACL(ctx, dec)
+	case "GETACL":
+		err = c.handleGetACL(ctx, dec)
+	case "LISTRIGHTS":
+		err = c.handleListRights(ctx, dec)
+	case "MYRIGHTS":
+		err = c.handleMyRights(ctx, dec)
+	case "NOTIFY":
+		err = c.handleNotify(ctx, dec)
 	default:
 		err = &imap.Error{
 			Type: imap.StatusResponseTypeBad,
@@ -260,6 +393,10 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		}
 	}
 
+	if errors.Is(err, errShutdown) {
+		return nil
+	}
+
 	dec.DiscardLine()
 
 	var (
@@ -282,7 +419,7 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		if !sendOK {
 			return nil
 		}
-		if err := c.poll(name); err != nil {
+		if err := c.poll(ctx, name); err != nil {
 			return err
 		}
 		resp = &imap.StatusResponse{
@@ -313,7 +450,7 @@ func (c *Conn) handleLogout(dec *imapwire.Decoder) error {
 	})
 }
 
-func (c *Conn) handleCreate(dec *imapwire.Decoder) error {
+func (c *Conn) handleCreate(ctx context.Context, dec *imapwire.Decoder) error {
 	var name string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&name) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -321,10 +458,10 @@ func (c *Conn) handleCreate(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Create(name)
+	return c.commandSession(ctx).Create(name)
 }
 
-func (c *Conn) handleDelete(dec *imapwire.Decoder) error {
+func (c *Conn) handleDelete(ctx context.Context, dec *imapwire.Decoder) error {
 	var name string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&name) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -332,10 +469,10 @@ func (c *Conn) handleDelete(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Delete(name)
+	return c.commandSession(ctx).Delete(name)
 }
 
-func (c *Conn) handleRename(dec *imapwire.Decoder) error {
+func (c *Conn) handleRename(ctx context.Context, dec *imapwire.Decoder) error {
 	var oldName, newName string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&oldName) || !dec.ExpectSP() || !dec.ExpectMailbox(&newName) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -343,10 +480,10 @@ func (c *Conn) handleRename(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Rename(oldName, newName)
+	return c.commandSession(ctx).Rename(oldName, newName)
 }
 
-func (c *Conn) handleSubscribe(dec *imapwire.Decoder) error {
+func (c *Conn) handleSubscribe(ctx context.Context, dec *imapwire.Decoder) error {
 	var name string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&name) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -354,10 +491,10 @@ func (c *Conn) handleSubscribe(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Subscribe(name)
+	return c.commandSession(ctx).Subscribe(name)
 }
 
-func (c *Conn) handleUnsubscribe(dec *imapwire.Decoder) error {
+func (c *Conn) handleUnsubscribe(ctx context.Context, dec *imapwire.Decoder) error {
 	var name string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&name) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -365,15 +502,15 @@ func (c *Conn) handleUnsubscribe(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Unsubscribe(name)
+	return c.commandSession(ctx).Unsubscribe(name)
 }
 
 func (c *Conn) checkBufferedLiteral(size int64, nonSync bool) error {
-	if size > 4096 {
+	if max := c.server.options.maxLiteralSize(); size > max {
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeTooBig,
-			Text: "Literals are limited to 4096 bytes for this command",
+			Text: fmt.Sprintf("Literals are limited to %v bytes for this command", max),
 		}
 	}
 
@@ -447,7 +584,7 @@ func (c *Conn) setWriteTimeout(dur time.Duration) {
 	}
 }
 
-func (c *Conn) poll(cmd string) error {
+func (c *Conn) poll(ctx context.Context, cmd string) error {
 	switch c.state {
 	case imap.ConnStateAuthenticated, imap.ConnStateSelected:
 		// nothing to do
@@ -457,12 +594,21 @@ func (c *Conn) poll(cmd string) error {
 
 	allowExpunge := true
 	switch cmd {
-	case "FETCH", "STORE", "SEARCH":
+	case "FETCH", "STORE", "SEARCH", "SORT", "THREAD":
+		allowExpunge = false
+	}
+	if len(c.cmdSem) > 1 {
+		// EXPUNGE responses would make the sequence numbers used by the
+		// other commands in progress ambiguous
 		allowExpunge = false
 	}
 
+	// Updates need to be written in order
+	c.pollMutex.Lock()
+	defer c.pollMutex.Unlock()
+
 	w := &UpdateWriter{conn: c, allowExpunge: allowExpunge}
-	return c.session.Poll(w, allowExpunge)
+	return c.commandSession(ctx).Poll(w, allowExpunge)
 }
 
 type responseEncoder struct {
@@ -472,14 +618,16 @@ type responseEncoder struct {
 
 func newResponseEncoder(conn *Conn) *responseEncoder {
 	conn.mutex.Lock()
-	quotedUTF8 := conn.enabled.Has(imap.CapIMAP4rev2)
+	utf8Accept := conn.enabled.Has(imap.CapUTF8Accept)
+	quotedUTF8 := conn.enabled.Has(imap.CapIMAP4rev2) || utf8Accept
 	conn.mutex.Unlock()
 
 	wireEnc := imapwire.NewEncoder(conn.bw, imapwire.ConnSideServer)
 	wireEnc.QuotedUTF8 = quotedUTF8
+	wireEnc.MailboxUTF8 = utf8Accept
 
 	conn.encMutex.Lock() // released by responseEncoder.end
-	conn.setWriteTimeout(respWriteTimeout)
+	conn.setWriteTimeout(conn.server.options.writeTimeout())
 	return &responseEncoder{
 		Encoder: wireEnc,
 		conn:    conn,
@@ -503,13 +651,21 @@ func (enc *responseEncoder) Literal(size int64) io.WriteCloser {
 	}
 }
 
+func (enc *responseEncoder) Literal8(size int64) io.WriteCloser {
+	enc.conn.setWriteTimeout(literalWriteTimeout)
+	return literalWriter{
+		WriteCloser: enc.Encoder.Literal8(size, nil),
+		conn:        enc.conn,
+	}
+}
+
 type literalWriter struct {
 	io.WriteCloser
 	conn *Conn
 }
 
 func (lw literalWriter) Close() error {
-	lw.conn.setWriteTimeout(respWriteTimeout)
+	lw.conn.setWriteTimeout(lw.conn.server.options.writeTimeout())
 	return lw.WriteCloser.Close()
 }
 
@@ -554,6 +710,8 @@ func newClientBugError(text string) error {
 type UpdateWriter struct {
 	conn         *Conn
 	allowExpunge bool
+	// NOTIFY event group for the selected mailbox, may be nil
+	notify *imap.NotifyEventGroup
 }
 
 // WriteExpunge writes an EXPUNGE response.
@@ -574,13 +732,31 @@ func (w *UpdateWriter) WriteMailboxFlags(flags []imap.Flag) error {
 	return w.conn.writeFlags(flags)
 }
 
+// writeVanished writes a VANISHED response.
+func (w *UpdateWriter) writeVanished(uids imap.SeqSet) error {
+	if !w.allowExpunge {
+		return fmt.Errorf("imapserver: VANISHED updates are not allowed in this context")
+	}
+	return w.conn.writeVanished(uids, false)
+}
+
 // WriteMessageFlags writes a FETCH response with FLAGS.
 func (w *UpdateWriter) WriteMessageFlags(seqNum, uid uint32, flags []imap.Flag) error {
+	return w.writeMessageFlags(seqNum, uid, flags, 0)
+}
+
+// writeMessageFlags writes a FETCH response with FLAGS. If modSeq is non-zero
+// and CONDSTORE is enabled, MODSEQ is included as well.
+func (w *UpdateWriter) writeMessageFlags(seqNum, uid uint32, flags []imap.Flag, modSeq uint64) error {
+	condStore := modSeq != 0 && w.conn.condStoreEnabled()
 	fetchWriter := &FetchWriter{conn: w.conn}
 	respWriter := fetchWriter.CreateMessage(seqNum)
 	if uid != 0 {
 		respWriter.WriteUID(uid)
 	}
 	respWriter.WriteFlags(flags)
+	if condStore {
+		respWriter.WriteModSeq(modSeq)
+	}
 	return respWriter.Close()
 }
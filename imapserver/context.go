@@ -0,0 +1,63 @@
+package imapserver
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	connContextKey contextKey = iota
+	commandContextKey
+)
+
+// Command describes an IMAP command being handled.
+type Command struct {
+	Tag string
+	// Name is the upper-case command name, e.g. "FETCH" or "UID FETCH".
+	Name string
+}
+
+// ConnFromContext returns the connection associated with a context, or nil if
+// there is none.
+//
+// Contexts returned by Conn.Context and contexts passed to
+// SessionContext.WithContext carry their connection.
+func ConnFromContext(ctx context.Context) *Conn {
+	c, _ := ctx.Value(connContextKey).(*Conn)
+	return c
+}
+
+// CommandFromContext returns the command associated with a context, or nil if
+// there is none.
+//
+// Contexts passed to SessionContext.WithContext carry their command.
+func CommandFromContext(ctx context.Context) *Command {
+	cmd, _ := ctx.Value(commandContextKey).(*Command)
+	return cmd
+}
+
+// Context returns the connection's context.
+//
+// The context is cancelled when the connection is closed, including when the
+// server is closed or when Server.Shutdown gives up waiting for commands in
+// progress.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// newCommandContext returns a context for a command. The returned function
+// must be called once the command has been handled.
+func (c *Conn) newCommandContext(tag, name string) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(c.ctx, commandContextKey, &Command{Tag: tag, Name: name})
+	return context.WithCancel(ctx)
+}
+
+// commandSession returns the session to use to handle the command associated
+// with ctx.
+func (c *Conn) commandSession(ctx context.Context) Session {
+	if session, ok := c.session.(SessionContext); ok {
+		return session.WithContext(ctx)
+	}
+	return c.session
+}
@@ -1,28 +1,34 @@
 package imapserver
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleCopy(tag string, dec *imapwire.Decoder, numKind NumKind) error {
-	seqSet, dest, err := readCopy(dec)
+func (c *Conn) handleCopy(ctx context.Context, tag string, dec *imapwire.Decoder, numKind NumKind) error {
+	numSet, dest, err := readCopy(dec)
 	if err != nil {
 		return err
 	}
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
-	data, err := c.session.Copy(numKind, seqSet, dest)
-	if err != nil {
-		return err
-	}
-
 	cmdName := "COPY"
 	if numKind == NumKindUID {
 		cmdName = "UID COPY"
 	}
-	if err := c.poll(cmdName); err != nil {
+
+	var data *imap.CopyData
+	if seqSet, numKind := c.resolveSearchRes(numSet, numKind); len(seqSet) > 0 {
+		data, err = c.commandSession(ctx).Copy(numKind, seqSet, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.poll(ctx, cmdName); err != nil {
 		return err
 	}
 
@@ -47,9 +53,9 @@ func (c *Conn) writeCopyOK(tag string, data *imap.CopyData) error {
 	return enc.CRLF()
 }
 
-func readCopy(dec *imapwire.Decoder) (seqSet imap.SeqSet, dest string, err error) {
-	if !dec.ExpectSP() || !dec.ExpectSeqSet(&seqSet) || !dec.ExpectSP() || !dec.ExpectMailbox(&dest) || !dec.ExpectCRLF() {
+func readCopy(dec *imapwire.Decoder) (numSet imap.NumSet, dest string, err error) {
+	if !dec.ExpectSP() || !dec.ExpectNumSet(&numSet) || !dec.ExpectSP() || !dec.ExpectMailbox(&dest) || !dec.ExpectCRLF() {
 		return nil, "", dec.Err()
 	}
-	return seqSet, dest, nil
+	return numSet, dest, nil
 }
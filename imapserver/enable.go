@@ -27,12 +27,20 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 		switch req {
 		case imap.CapIMAP4rev2:
 			enabled = append(enabled, req)
+		case imap.CapCondStore, imap.CapQResync, imap.CapUTF8Accept:
+			if c.server.options.caps().Has(req) {
+				enabled = append(enabled, req)
+			}
 		}
 	}
 
 	c.mutex.Lock()
 	for _, e := range enabled {
 		c.enabled[e] = struct{}{}
+		if e == imap.CapQResync {
+			// QRESYNC implies CONDSTORE
+			c.enabled[imap.CapCondStore] = struct{}{}
+		}
 	}
 	c.mutex.Unlock()
 
@@ -44,3 +52,33 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 	}
 	return enc.CRLF()
 }
+
+// enableCondStore implicitly enables CONDSTORE. It's called when a
+// CONDSTORE-enabling command is received.
+func (c *Conn) enableCondStore() error {
+	if !c.server.options.caps().Has(imap.CapCondStore) {
+		return newClientBugError("CONDSTORE is not supported")
+	}
+	c.mutex.Lock()
+	c.enabled[imap.CapCondStore] = struct{}{}
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *Conn) condStoreEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.enabled.Has(imap.CapCondStore)
+}
+
+func (c *Conn) qresyncEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.enabled.Has(imap.CapQResync)
+}
+
+func (c *Conn) utf8AcceptEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.enabled.Has(imap.CapUTF8Accept)
+}
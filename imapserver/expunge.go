@@ -1,31 +1,41 @@
 package imapserver
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleExpunge(dec *imapwire.Decoder) error {
+func (c *Conn) handleExpunge(ctx context.Context, dec *imapwire.Decoder) error {
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
-	return c.expunge(nil)
+	return c.expunge(ctx, nil)
 }
 
-func (c *Conn) handleUIDExpunge(dec *imapwire.Decoder) error {
-	var seqSet imap.SeqSet
-	if !dec.ExpectSP() || !dec.ExpectSeqSet(&seqSet) || !dec.ExpectCRLF() {
+func (c *Conn) handleUIDExpunge(ctx context.Context, dec *imapwire.Decoder) error {
+	var numSet imap.NumSet
+	if !dec.ExpectSP() || !dec.ExpectNumSet(&numSet) || !dec.ExpectCRLF() {
 		return dec.Err()
 	}
-	return c.expunge(&seqSet)
+	seqSet, _ := c.resolveSearchRes(numSet, NumKindUID)
+	if len(seqSet) == 0 {
+		return c.checkState(imap.ConnStateSelected)
+	}
+	return c.expunge(ctx, &seqSet)
 }
 
-func (c *Conn) expunge(uids *imap.SeqSet) error {
+func (c *Conn) expunge(ctx context.Context, uids *imap.SeqSet) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
 	w := &ExpungeWriter{conn: c}
-	return c.session.Expunge(w, uids)
+	if err := c.commandSession(ctx).Expunge(w, uids); err != nil {
+		return err
+	}
+	return w.flush()
 }
 
 func (c *Conn) writeExpunge(seqNum uint32) error {
@@ -35,16 +45,59 @@ func (c *Conn) writeExpunge(seqNum uint32) error {
 	return enc.CRLF()
 }
 
+func (c *Conn) writeVanished(uids imap.SeqSet, earlier bool) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("VANISHED").SP()
+	if earlier {
+		enc.Atom("(EARLIER)").SP()
+	}
+	enc.SeqSet(uids)
+	return enc.CRLF()
+}
+
 // ExpungeWriter writes EXPUNGE updates.
 type ExpungeWriter struct {
-	conn *Conn
+	conn     *Conn
+	vanished imap.SeqSet
 }
 
 // WriteExpunge notifies the client that the message with the provided sequence
 // number has been deleted.
+//
+// If the client has enabled QRESYNC, WriteExpungeUID must be used instead.
 func (w *ExpungeWriter) WriteExpunge(seqNum uint32) error {
 	if w.conn == nil {
 		return nil
 	}
+	if w.conn.qresyncEnabled() {
+		return fmt.Errorf("imapserver: cannot write EXPUNGE with QRESYNC enabled, use WriteExpungeUID")
+	}
 	return w.conn.writeExpunge(seqNum)
 }
+
+// WriteExpungeUID is like WriteExpunge, but also provides the UID of the
+// deleted message.
+//
+// If the client has enabled QRESYNC, a VANISHED response is sent instead of
+// EXPUNGE, as required by RFC 7162 section 3.2.10. VANISHED responses are
+// merged and sent once the command is done.
+func (w *ExpungeWriter) WriteExpungeUID(seqNum, uid uint32) error {
+	if w.conn == nil {
+		return nil
+	}
+	if w.conn.qresyncEnabled() {
+		w.vanished.AddNum(uid)
+		return nil
+	}
+	return w.conn.writeExpunge(seqNum)
+}
+
+func (w *ExpungeWriter) flush() error {
+	if w.conn == nil || len(w.vanished) == 0 {
+		return nil
+	}
+	err := w.conn.writeVanished(w.vanished, false)
+	w.vanished = nil
+	return err
+}
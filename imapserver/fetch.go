@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -13,49 +14,26 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
-	var seqSet imap.SeqSet
-	if !dec.ExpectSP() || !dec.ExpectSeqSet(&seqSet) || !dec.ExpectSP() {
-		return dec.Err()
-	}
-
-	var items []imap.FetchItem
-	isList, err := dec.List(func() error {
-		item, err := readFetchAtt(dec)
-		if err != nil {
-			return err
-		}
-		switch item {
-		case imap.FetchItemAll, imap.FetchItemFast, imap.FetchItemFull:
-			return newClientBugError("FETCH macros are not allowed in a list")
-		}
-		items = append(items, item)
-		return nil
-	})
+func (c *Conn) handleFetch(ctx context.Context, dec *imapwire.Decoder, numKind NumKind) error {
+	numSet, items, options, err := readFetch(dec)
 	if err != nil {
 		return err
 	}
-	if !isList {
-		item, err := readFetchAtt(dec)
-		if err != nil {
-			return err
-		}
 
-		// Handle macros
-		switch item {
-		case imap.FetchItemAll:
-			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size, imap.FetchItemEnvelope)
-		case imap.FetchItemFast:
-			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size)
-		case imap.FetchItemFull:
-			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size, imap.FetchItemEnvelope, imap.FetchItemBody)
-		default:
-			items = append(items, item)
+	if options.Vanished {
+		if numKind != NumKindUID || options.ChangedSince == 0 {
+			return newClientBugError("VANISHED is only allowed in UID FETCH with CHANGEDSINCE")
+		} else if !c.qresyncEnabled() {
+			return newClientBugError("QRESYNC must be enabled to use VANISHED")
 		}
 	}
-
-	if !dec.ExpectCRLF() {
-		return dec.Err()
+	if options.ChangedSince != 0 && !hasFetchItem(items, imap.FetchItemModSeq) {
+		items = append(items, imap.FetchItemModSeq)
+	}
+	if hasFetchItem(items, imap.FetchItemModSeq) {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
 	}
 
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
@@ -94,9 +72,103 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 		items = itemsWithUID
 	}
 
+	seqSet, numKind := c.resolveSearchRes(numSet, numKind)
+	if len(seqSet) == 0 {
+		return nil
+	}
+
 	w := &FetchWriter{conn: c, obsolete: obsolete}
-	if err := c.session.Fetch(w, numKind, seqSet, items); err != nil {
-		return err
+	if c.condStoreEnabled() {
+		session := c.commandSession(ctx).(SessionCondStore)
+		err = session.FetchWithOptions(w, numKind, seqSet, items, options)
+	} else {
+		err = c.commandSession(ctx).Fetch(w, numKind, seqSet, items)
+	}
+	return err
+}
+
+// readFetch reads the arguments of a FETCH command.
+func readFetch(dec *imapwire.Decoder) (imap.NumSet, []imap.FetchItem, *imap.FetchOptions, error) {
+	var numSet imap.NumSet
+	if !dec.ExpectSP() || !dec.ExpectNumSet(&numSet) || !dec.ExpectSP() {
+		return nil, nil, nil, dec.Err()
+	}
+
+	var items []imap.FetchItem
+	isList, err := dec.List(func() error {
+		item, err := readFetchAtt(dec)
+		if err != nil {
+			return err
+		}
+		switch item {
+		case imap.FetchItemAll, imap.FetchItemFast, imap.FetchItemFull:
+			return newClientBugError("FETCH macros are not allowed in a list")
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !isList {
+		item, err := readFetchAtt(dec)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// Handle macros
+		switch item {
+		case imap.FetchItemAll:
+			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size, imap.FetchItemEnvelope)
+		case imap.FetchItemFast:
+			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size)
+		case imap.FetchItemFull:
+			items = append(items, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size, imap.FetchItemEnvelope, imap.FetchItemBody)
+		default:
+			items = append(items, item)
+		}
+	}
+
+	options := new(imap.FetchOptions)
+	if dec.SP() {
+		err := dec.ExpectList(func() error {
+			return readFetchModifier(dec, options)
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if !dec.ExpectCRLF() {
+		return nil, nil, nil, dec.Err()
+	}
+
+	return numSet, items, options, nil
+}
+
+func hasFetchItem(items []imap.FetchItem, item imap.FetchItem) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
+
+func readFetchModifier(dec *imapwire.Decoder, options *imap.FetchOptions) error {
+	var name string
+	if !dec.ExpectAtom(&name) {
+		return dec.Err()
+	}
+	switch strings.ToUpper(name) {
+	case "CHANGEDSINCE":
+		if !dec.ExpectSP() || !dec.ExpectModSeq(&options.ChangedSince) {
+			return dec.Err()
+		}
+	case "VANISHED":
+		options.Vanished = true
+	default:
+		return newClientBugError("Unknown FETCH modifier")
 	}
 	return nil
 }
@@ -120,6 +192,7 @@ func readFetchAtt(dec *imapwire.Decoder) (imap.FetchItem, error) {
 		imap.FetchItemInternalDate.(imap.FetchItemKeyword):     imap.FetchItemInternalDate,
 		imap.FetchItemRFC822Size.(imap.FetchItemKeyword):       imap.FetchItemRFC822Size,
 		imap.FetchItemUID.(imap.FetchItemKeyword):              imap.FetchItemUID,
+		imap.FetchItemModSeq.(imap.FetchItemKeyword):           imap.FetchItemModSeq,
 		internal.FetchItemRFC822.(imap.FetchItemKeyword):       internal.FetchItemRFC822,
 		internal.FetchItemRFC822Header.(imap.FetchItemKeyword): internal.FetchItemRFC822Header,
 		internal.FetchItemRFC822Text.(imap.FetchItemKeyword):   internal.FetchItemRFC822Text,
@@ -305,6 +378,13 @@ type FetchWriter struct {
 	obsolete map[imap.FetchItem]imap.FetchItemKeyword
 }
 
+// WriteVanished writes a VANISHED (EARLIER) response with the UIDs of
+// messages which have been expunged. It's used to reply to a FETCH command
+// with the VANISHED modifier.
+func (cmd *FetchWriter) WriteVanished(uids imap.SeqSet) error {
+	return cmd.conn.writeVanished(uids, true)
+}
+
 // CreateMessage writes a FETCH response for a message.
 //
 // FetchResponseWriter.Close must be called.
@@ -342,6 +422,12 @@ func (w *FetchResponseWriter) WriteFlags(flags []imap.Flag) {
 	})
 }
 
+// WriteModSeq writes the message's mod-sequence.
+func (w *FetchResponseWriter) WriteModSeq(modSeq uint64) {
+	w.writeItemSep()
+	w.enc.Atom("MODSEQ").SP().Special('(').ModSeq(modSeq).Special(')')
+}
+
 // WriteRFC822Size writes the message's full size.
 func (w *FetchResponseWriter) WriteRFC822Size(size int64) {
 	w.writeItemSep()
@@ -414,8 +500,7 @@ func (w *FetchResponseWriter) WriteBinarySection(section *imap.FetchItemBinarySe
 	enc.Atom("BINARY").Special('[')
 	writeSectionPart(enc, section.Part)
 	enc.Special(']').SP()
-	enc.Special('~') // indicates literal8
-	return w.enc.Literal(size)
+	return w.enc.Literal8(size)
 }
 
 // WriteBinarySectionSize writes a binary section size.
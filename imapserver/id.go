@@ -0,0 +1,94 @@
+package imapserver
+
+import (
+	"context"
+	"sort"
+
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleID(ctx context.Context, dec *imapwire.Decoder) error {
+	if !dec.ExpectSP() {
+		return dec.Err()
+	}
+	clientID, err := readIDParams(dec)
+	if err != nil {
+		return err
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	c.mutex.Lock()
+	c.clientID = clientID
+	c.mutex.Unlock()
+
+	serverID := c.server.options.ID
+	if session, ok := c.commandSession(ctx).(SessionID); ok {
+		serverID, err = session.ID(clientID)
+		if err != nil {
+			return err
+		}
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("ID").SP()
+	writeIDParams(enc.Encoder, serverID)
+	return enc.CRLF()
+}
+
+// ClientID returns the identification sent by the client via the ID command.
+//
+// Nil is returned if the client hasn't sent any identification.
+func (c *Conn) ClientID() map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.clientID
+}
+
+func readIDParams(dec *imapwire.Decoder) (map[string]string, error) {
+	var params map[string]string
+	err := dec.ExpectNList(func() error {
+		var key string
+		if !dec.ExpectString(&key) || !dec.ExpectSP() {
+			return dec.Err()
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+
+		var nilAtom string
+		if dec.Atom(&nilAtom) {
+			if !dec.Expect(nilAtom == "NIL", "nstring") {
+				return dec.Err()
+			}
+			// Fields without a value are omitted
+			return nil
+		}
+		var value string
+		if !dec.ExpectString(&value) {
+			return dec.Err()
+		}
+		params[key] = value
+		return nil
+	})
+	return params, err
+}
+
+func writeIDParams(enc *imapwire.Encoder, params map[string]string) {
+	if len(params) == 0 {
+		enc.NIL()
+		return
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	enc.List(len(keys), func(i int) {
+		enc.String(keys[i]).SP().String(params[keys[i]])
+	})
+}
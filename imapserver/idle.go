@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"runtime/debug"
@@ -9,7 +10,7 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
+func (c *Conn) handleIdle(ctx context.Context, dec *imapwire.Decoder) error {
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
@@ -22,6 +23,10 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 		return err
 	}
 
+	// Updates for the selected mailbox which the client doesn't want to be
+	// notified about are left pending until the next command
+	w := &UpdateWriter{conn: c, allowExpunge: true, notify: c.selectedNotifyGroup()}
+
 	stop := make(chan struct{})
 	done := make(chan error, 1)
 	go func() {
@@ -31,14 +36,29 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 				done <- fmt.Errorf("imapserver: panic idling")
 			}
 		}()
-		w := &UpdateWriter{conn: c, allowExpunge: true}
-		done <- c.session.Idle(w, stop)
+		done <- c.commandSession(ctx).Idle(w, stop)
 	}()
 
-	c.setReadTimeout(idleReadTimeout)
-	line, isPrefix, err := c.br.ReadLine()
+	c.setReadTimeout(c.server.options.idleTimeout())
+	var (
+		line     []byte
+		isPrefix bool
+		err      error
+	)
+	if c.beginWait() {
+		line, isPrefix, err = c.br.ReadLine()
+	}
+	shutdown := c.endWait()
 	close(stop)
-	if err == io.EOF {
+	if shutdown && line == nil {
+		if err := <-done; err != nil {
+			c.server.logger().Printf("failed to idle: %v", err)
+		}
+		if err := c.byeShutdown(); err != nil {
+			return err
+		}
+		return errShutdown
+	} else if err == io.EOF {
 		return nil
 	} else if err != nil {
 		return err
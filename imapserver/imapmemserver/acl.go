@@ -0,0 +1,178 @@
+package imapmemserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+var (
+	errNoSuchMailbox = &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeNonExistent,
+		Text: "No such mailbox",
+	}
+	errNoPerm = &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeNoPerm,
+		Text: "Permission denied",
+	}
+)
+
+// SetRights sets the rights granted to an identifier. An identifier is
+// either a user name, "anyone", or one of these prefixed with "-" for
+// negative rights. If rs is empty, the identifier is removed from the ACL.
+func (mbox *Mailbox) SetRights(ri imap.RightsIdentifier, rs imap.RightSet) {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	mbox.setRightsLocked(ri, rs)
+}
+
+func (mbox *Mailbox) setRightsLocked(ri imap.RightsIdentifier, rs imap.RightSet) {
+	if len(rs) == 0 {
+		delete(mbox.acl, ri)
+		return
+	}
+	if mbox.acl == nil {
+		mbox.acl = make(map[imap.RightsIdentifier]imap.RightSet)
+	}
+	mbox.acl[ri] = rs
+}
+
+// Rights returns the rights granted to a user.
+func (mbox *Mailbox) Rights(username string) imap.RightSet {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	return mbox.rightsLocked(username)
+}
+
+func (mbox *Mailbox) rightsLocked(username string) imap.RightSet {
+	ri := imap.RightsIdentifier(username)
+	rs := mbox.acl[ri].Add(mbox.acl[imap.RightsIdentifierAnyone])
+	rs = rs.Remove(mbox.acl["-"+ri])
+	rs = rs.Remove(mbox.acl["-"+imap.RightsIdentifierAnyone])
+	return rs
+}
+
+// AddMailbox makes an existing mailbox available to the user under the
+// specified name. This can be used to share a mailbox between multiple
+// users. Access to the mailbox is controlled by its ACL, see
+// Mailbox.SetRights.
+func (u *User) AddMailbox(name string, mbox *Mailbox) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	name = strings.TrimRight(name, string(mailboxDelim))
+	if u.mailboxes[name] != nil {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeAlreadyExists,
+			Text: "Mailbox already exists",
+		}
+	}
+	u.mailboxes[name] = mbox
+	return nil
+}
+
+// checkRights checks that the user has all of the specified rights on a
+// mailbox. If the user can neither look up nor read the mailbox, the mailbox
+// is reported as non-existent to avoid disclosing its existence.
+func (u *User) checkRights(mbox *Mailbox, rights imap.RightSet) error {
+	rs := mbox.Rights(u.username)
+	if !rs.Has(imap.RightLookup) && !rs.Has(imap.RightRead) {
+		return errNoSuchMailbox
+	}
+	for _, r := range rights {
+		if !rs.Has(r) {
+			return errNoPerm
+		}
+	}
+	return nil
+}
+
+// tryCreateError converts a missing mailbox error into a TRYCREATE error, as
+// expected for the destination of APPEND, COPY and MOVE.
+func tryCreateError(err error) error {
+	if err != errNoSuchMailbox {
+		return err
+	}
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeTryCreate,
+		Text: "No such mailbox",
+	}
+}
+
+func (u *User) SetACL(mailbox string, ri imap.RightsIdentifier, rm imap.RightModification, rs imap.RightSet) error {
+	mbox, err := u.mailbox(mailbox, imap.RightSet{imap.RightAdminister})
+	if err != nil {
+		return err
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+
+	switch rm {
+	case imap.RightModificationAdd:
+		rs = mbox.acl[ri].Add(rs)
+	case imap.RightModificationRemove:
+		rs = mbox.acl[ri].Remove(rs)
+	}
+	mbox.setRightsLocked(ri, rs)
+	return nil
+}
+
+func (u *User) DeleteACL(mailbox string, ri imap.RightsIdentifier) error {
+	mbox, err := u.mailbox(mailbox, imap.RightSet{imap.RightAdminister})
+	if err != nil {
+		return err
+	}
+	mbox.SetRights(ri, nil)
+	return nil
+}
+
+func (u *User) GetACL(mailbox string) (*imap.GetACLData, error) {
+	mbox, err := u.mailbox(mailbox, imap.RightSet{imap.RightAdminister})
+	if err != nil {
+		return nil, err
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+
+	data := imap.GetACLData{
+		Mailbox: mailbox,
+		Rights:  make(map[imap.RightsIdentifier]imap.RightSet, len(mbox.acl)),
+	}
+	for ri, rs := range mbox.acl {
+		data.Rights[ri] = append(imap.RightSet(nil), rs...)
+	}
+	return &data, nil
+}
+
+func (u *User) ListRights(mailbox string, ri imap.RightsIdentifier) (*imap.ListRightsData, error) {
+	if _, err := u.mailbox(mailbox, imap.RightSet{imap.RightAdminister}); err != nil {
+		return nil, err
+	}
+
+	data := imap.ListRightsData{
+		Mailbox:    mailbox,
+		Identifier: ri,
+	}
+	// All rights can be granted independently
+	for _, r := range imap.AllRights {
+		data.Optional = append(data.Optional, imap.RightSet{r})
+	}
+	return &data, nil
+}
+
+func (u *User) MyRights(mailbox string) (*imap.MyRightsData, error) {
+	mbox, err := u.mailbox(mailbox, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &imap.MyRightsData{
+		Mailbox: mailbox,
+		Rights:  mbox.Rights(u.username),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package imapmemserver
+
+import (
+	"bytes"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+var errBadURL = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeBadURL,
+	Text: "Invalid or inaccessible message URL",
+}
+
+func (u *User) BeginAppend(mailbox string) (imapserver.AppendTransaction, error) {
+	mbox, err := u.mailbox(mailbox, imap.RightSet{imap.RightInsert})
+	if err != nil {
+		return nil, tryCreateError(err)
+	}
+	return &appendTransaction{user: u, name: mailbox, mailbox: mbox}, nil
+}
+
+// appendTransaction buffers messages until they are committed.
+type appendTransaction struct {
+	user    *User
+	name    string
+	mailbox *Mailbox
+	pending []pendingMessage
+	size    int64
+}
+
+type pendingMessage struct {
+	buf     []byte
+	options *imap.AppendOptions
+}
+
+func (tx *appendTransaction) Append(r imap.LiteralReader, options *imap.AppendOptions) error {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	tx.add(buf.Bytes(), options)
+	return nil
+}
+
+func (tx *appendTransaction) Catenate(parts []imap.CatenatePart, options *imap.AppendOptions) (int64, error) {
+	var buf bytes.Buffer
+	for _, part := range parts {
+		if part.URL == "" {
+			buf.Write(part.Text)
+			continue
+		}
+		b, err := tx.user.messageURLData(part.URL)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(b)
+	}
+	tx.add(buf.Bytes(), options)
+	return int64(buf.Len()), nil
+}
+
+func (tx *appendTransaction) add(buf []byte, options *imap.AppendOptions) {
+	tx.pending = append(tx.pending, pendingMessage{buf: buf, options: options})
+	tx.size += int64(len(buf))
+}
+
+func (tx *appendTransaction) Commit() (*imap.AppendData, error) {
+	u := tx.user
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// The mailbox may have been deleted or renamed, and other messages may
+	// have been appended since BeginAppend
+	mbox, err := u.mailboxLocked(tx.name, imap.RightSet{imap.RightInsert})
+	if err != nil {
+		return nil, tryCreateError(err)
+	} else if mbox != tx.mailbox {
+		return nil, tryCreateError(errNoSuchMailbox)
+	}
+	if err := u.checkQuotaLocked(int64(len(tx.pending)), tx.size); err != nil {
+		return nil, err
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+
+	data := imap.AppendData{UIDValidity: mbox.uidValidity}
+	for _, msg := range tx.pending {
+		appendData := mbox.appendBytesLocked(msg.buf, msg.options)
+		data.UIDs.AddNum(appendData.UID)
+	}
+	if len(tx.pending) == 1 {
+		data.UID = data.UIDs[0].Start
+	}
+	tx.pending = nil
+	return &data, nil
+}
+
+func (tx *appendTransaction) Rollback() error {
+	tx.pending = nil
+	return nil
+}
+
+// messageURLData returns the contents of the message or message part
+// referenced by an IMAP URL.
+func (u *User) messageURLData(s string) ([]byte, error) {
+	url, err := imap.ParseMessageURL(s)
+	if err != nil {
+		return nil, errBadURL
+	}
+	mbox, err := u.mailbox(url.Mailbox, imap.RightSet{imap.RightRead})
+	if err != nil {
+		return nil, errBadURL
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+
+	if url.UIDValidity != 0 && url.UIDValidity != mbox.uidValidity {
+		return nil, errBadURL
+	}
+	for _, msg := range mbox.l {
+		if msg.uid != url.UID {
+			continue
+		}
+		if len(url.Part) == 0 && url.Specifier == imap.PartSpecifierNone {
+			return msg.buf, nil
+		}
+		b := msg.bodySection(&imap.FetchItemBodySection{
+			Part:      url.Part,
+			Specifier: url.Specifier,
+		})
+		if b == nil {
+			return nil, errBadURL
+		}
+		return b, nil
+	}
+	return nil, errBadURL
+}
@@ -1,7 +1,6 @@
 package imapmemserver
 
 import (
-	"bytes"
 	"fmt"
 	"sort"
 	"sync"
@@ -18,21 +17,29 @@ import (
 type Mailbox struct {
 	tracker     *imapserver.MailboxTracker
 	uidValidity uint32
-
-	mutex      sync.Mutex
-	name       string
-	subscribed bool
-	l          []*message
-	uidNext    uint32
+	// owner of the mailbox to notify about changes, may be nil
+	userTracker *imapserver.UserTracker
+
+	mutex         sync.Mutex
+	name          string
+	subscribed    bool
+	l             []*message
+	uidNext       uint32
+	highestModSeq uint64
+	metadata      map[string][]byte
+	// private metadata entries, by username
+	privateMetadata map[string]map[string][]byte
+	acl             map[imap.RightsIdentifier]imap.RightSet
 }
 
 // NewMailbox creates a new mailbox.
 func NewMailbox(name string, uidValidity uint32) *Mailbox {
 	return &Mailbox{
-		tracker:     imapserver.NewMailboxTracker(0),
-		uidValidity: uidValidity,
-		name:        name,
-		uidNext:     1,
+		tracker:       imapserver.NewMailboxTracker(0),
+		uidValidity:   uidValidity,
+		name:          name,
+		uidNext:       1,
+		highestModSeq: 1,
 	}
 }
 
@@ -84,6 +91,10 @@ func (mbox *Mailbox) statusDataLocked(items []imap.StatusItem) *imap.StatusData
 		case imap.StatusItemSize:
 			size := mbox.sizeLocked()
 			data.Size = &size
+		case imap.StatusItemHighestModSeq:
+			data.HighestModSeq = mbox.highestModSeq
+		case imap.StatusItemAppendLimit:
+			// no mailbox-specific limit, imapserver.Options.AppendLimit applies
 		default:
 			panic(fmt.Errorf("unknown STATUS item: %v", item))
 		}
@@ -109,14 +120,6 @@ func (mbox *Mailbox) sizeLocked() int64 {
 	return size
 }
 
-func (mbox *Mailbox) appendLiteral(r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
-	var buf bytes.Buffer
-	if _, err := buf.ReadFrom(r); err != nil {
-		return nil, err
-	}
-	return mbox.appendBytes(buf.Bytes(), options), nil
-}
-
 func (mbox *Mailbox) copyMsg(msg *message) *imap.AppendData {
 	return mbox.appendBytes(msg.buf, &imap.AppendOptions{
 		Time:  msg.t,
@@ -125,6 +128,12 @@ func (mbox *Mailbox) copyMsg(msg *message) *imap.AppendData {
 }
 
 func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.AppendData {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	return mbox.appendBytesLocked(buf, options)
+}
+
+func (mbox *Mailbox) appendBytesLocked(buf []byte, options *imap.AppendOptions) *imap.AppendData {
 	msg := &message{
 		flags: make(map[imap.Flag]struct{}),
 		buf:   buf,
@@ -140,14 +149,13 @@ func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.
 		msg.flags[canonicalFlag(flag)] = struct{}{}
 	}
 
-	mbox.mutex.Lock()
-	defer mbox.mutex.Unlock()
-
 	msg.uid = mbox.uidNext
 	mbox.uidNext++
+	msg.modSeq = mbox.nextModSeqLocked()
 
 	mbox.l = append(mbox.l, msg)
 	mbox.tracker.QueueNumMessages(uint32(len(mbox.l)))
+	mbox.queueStatusLocked(imap.NotifyEventMessageNew)
 
 	return &imap.AppendData{
 		UIDValidity: mbox.uidValidity,
@@ -155,6 +163,12 @@ func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.
 	}
 }
 
+// nextModSeqLocked allocates a new mod-sequence.
+func (mbox *Mailbox) nextModSeqLocked() uint64 {
+	mbox.highestModSeq++
+	return mbox.highestModSeq
+}
+
 func (mbox *Mailbox) rename(newName string) {
 	mbox.mutex.Lock()
 	mbox.name = newName
@@ -181,6 +195,7 @@ func (mbox *Mailbox) selectDataLocked() *imap.SelectData {
 		NumMessages:    uint32(len(mbox.l)),
 		UIDNext:        mbox.uidNext,
 		UIDValidity:    mbox.uidValidity,
+		HighestModSeq:  mbox.highestModSeq,
 	}
 }
 
@@ -231,6 +246,11 @@ func (mbox *Mailbox) Expunge(w *imapserver.ExpungeWriter, uids *imap.SeqSet) err
 func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []uint32) {
 	// TODO: optimize
 
+	if len(expunged) == 0 {
+		return nil
+	}
+	modSeq := mbox.nextModSeqLocked()
+
 	// Iterate in reverse order, to keep sequence numbers consistent
 	var filtered []*message
 	for i := len(mbox.l) - 1; i >= 0; i-- {
@@ -238,7 +258,7 @@ func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []ui
 		if _, ok := expunged[msg]; ok {
 			seqNum := uint32(i) + 1
 			seqNums = append(seqNums, seqNum)
-			mbox.tracker.QueueExpunge(seqNum)
+			mbox.tracker.QueueExpungeModSeq(seqNum, msg.uid, modSeq)
 		} else {
 			filtered = append(filtered, msg)
 		}
@@ -251,10 +271,36 @@ func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []ui
 	}
 
 	mbox.l = filtered
+	if len(seqNums) > 0 {
+		mbox.queueStatusLocked(imap.NotifyEventMessageExpunge)
+	}
 
 	return seqNums
 }
 
+// notifyStatusItems are the STATUS items sent to sessions which have enabled
+// NOTIFY.
+var notifyStatusItems = []imap.StatusItem{
+	imap.StatusItemNumMessages,
+	imap.StatusItemUIDNext,
+	imap.StatusItemUIDValidity,
+	imap.StatusItemNumUnseen,
+	imap.StatusItemHighestModSeq,
+}
+
+// queueStatusLocked notifies the owner of the mailbox about a change.
+func (mbox *Mailbox) queueStatusLocked(event imap.NotifyEvent) {
+	if mbox.userTracker != nil {
+		mbox.userTracker.QueueStatus(event, mbox.statusDataLocked(notifyStatusItems))
+	}
+}
+
+func (mbox *Mailbox) queueStatus(event imap.NotifyEvent) {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	mbox.queueStatusLocked(event)
+}
+
 // NewView creates a new view into this mailbox.
 //
 // Callers must call MailboxView.Close once they are done with the mailbox view.
@@ -284,11 +330,30 @@ func (mbox *MailboxView) Close() {
 }
 
 func (mbox *MailboxView) Fetch(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem) error {
+	return mbox.FetchWithOptions(w, numKind, seqSet, items, &imap.FetchOptions{})
+}
+
+func (mbox *MailboxView) FetchWithOptions(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem, options *imap.FetchOptions) error {
+	return mbox.fetch(w, numKind, seqSet, items, options, true)
+}
+
+// fetch implements FETCH. If canSetSeen is false, body sections are fetched
+// without setting the \Seen flag.
+func (mbox *MailboxView) fetch(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem, options *imap.FetchOptions, canSetSeen bool) error {
 	markSeen := false
 	for _, item := range items {
-		if item, ok := item.(*imap.FetchItemBodySection); ok && !item.Peek {
-			markSeen = true
-			break
+		switch item := item.(type) {
+		case *imap.FetchItemBodySection:
+			markSeen = markSeen || !item.Peek
+		case *imap.FetchItemBinarySection:
+			markSeen = markSeen || !item.Peek
+		}
+	}
+	markSeen = markSeen && canSetSeen
+
+	if options.Vanished {
+		if err := mbox.writeVanished(w, seqSet, options.ChangedSince); err != nil {
+			return err
 		}
 	}
 
@@ -297,18 +362,80 @@ func (mbox *MailboxView) Fetch(w *imapserver.FetchWriter, numKind imapserver.Num
 		if err != nil {
 			return
 		}
+		if options.ChangedSince != 0 && msg.modSeq <= options.ChangedSince {
+			return
+		}
+
+		binary, decodeErr := msg.binarySections(items)
+		if decodeErr != nil {
+			err = decodeErr
+			return
+		}
 
 		if markSeen {
-			msg.flags[canonicalFlag(imap.FlagSeen)] = struct{}{}
-			mbox.Mailbox.tracker.QueueMessageFlags(seqNum, msg.uid, msg.flagList(), nil)
+			seen := canonicalFlag(imap.FlagSeen)
+			if _, ok := msg.flags[seen]; !ok {
+				msg.flags[seen] = struct{}{}
+				msg.modSeq = mbox.nextModSeqLocked()
+			}
+			mbox.Mailbox.tracker.QueueMessageFlagsModSeq(seqNum, msg.uid, msg.flagList(), msg.modSeq, nil)
 		}
 
 		respWriter := w.CreateMessage(mbox.tracker.EncodeSeqNum(seqNum))
-		err = msg.fetch(respWriter, items)
+		err = msg.fetch(respWriter, items, binary)
 	})
 	return err
 }
 
+func (mbox *MailboxView) writeVanished(w *imapserver.FetchWriter, uidSet imap.SeqSet, modSeq uint64) error {
+	mbox.mutex.Lock()
+	mbox.staticSeqSet(uidSet, imapserver.NumKindUID)
+	expunged, ok := mbox.Mailbox.tracker.ExpungedSince(modSeq)
+	if !ok {
+		// The expunge history is incomplete, report all UIDs which don't
+		// exist anymore
+		expunged = mbox.missingUIDsLocked()
+	}
+	mbox.mutex.Unlock()
+
+	var vanished imap.SeqSet
+	for _, x := range expunged {
+		for _, y := range uidSet {
+			start, stop := x.Start, x.Stop
+			if y.Start > start {
+				start = y.Start
+			}
+			if y.Stop < stop {
+				stop = y.Stop
+			}
+			if start <= stop {
+				vanished.AddRange(start, stop)
+			}
+		}
+	}
+	if len(vanished) == 0 {
+		return nil
+	}
+	return w.WriteVanished(vanished)
+}
+
+// missingUIDsLocked returns the UIDs lower than UIDNEXT which don't belong to
+// any message.
+func (mbox *Mailbox) missingUIDsLocked() imap.SeqSet {
+	var uids imap.SeqSet
+	next := uint32(1)
+	for _, msg := range mbox.l {
+		if msg.uid > next {
+			uids.AddRange(next, msg.uid-1)
+		}
+		next = msg.uid + 1
+	}
+	if next < mbox.uidNext {
+		uids.AddRange(next, mbox.uidNext-1)
+	}
+	return uids
+}
+
 func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
@@ -345,22 +472,76 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 			data.Max = num
 		}
 		data.Count++
+		if criteria.ModSeq != nil && msg.modSeq > data.ModSeq {
+			data.ModSeq = msg.modSeq
+		}
 	}
 
 	return &data, nil
 }
 
 func (mbox *MailboxView) Store(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags) error {
+	changed := false
 	mbox.forEach(numKind, seqSet, func(seqNum uint32, msg *message) {
-		msg.store(flags)
-		mbox.Mailbox.tracker.QueueMessageFlags(seqNum, msg.uid, msg.flagList(), mbox.tracker)
+		if msg.store(flags) {
+			msg.modSeq = mbox.nextModSeqLocked()
+			changed = true
+		}
+		mbox.Mailbox.tracker.QueueMessageFlagsModSeq(seqNum, msg.uid, msg.flagList(), msg.modSeq, mbox.tracker)
 	})
+	if changed {
+		mbox.queueStatus(imap.NotifyEventFlagChange)
+	}
 	if !flags.Silent {
 		return mbox.Fetch(w, numKind, seqSet, []imap.FetchItem{imap.FetchItemFlags})
 	}
 	return nil
 }
 
+func (mbox *MailboxView) StoreWithOptions(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags, options *imap.StoreOptions) (imap.SeqSet, error) {
+	var items []imap.FetchItem
+	if !flags.Silent {
+		items = append(items, imap.FetchItemFlags)
+	}
+	items = append(items, imap.FetchItemModSeq)
+
+	var (
+		modified imap.SeqSet
+		changed  bool
+		err      error
+	)
+	mbox.forEach(numKind, seqSet, func(seqNum uint32, msg *message) {
+		if err != nil {
+			return
+		}
+
+		if options.UnchangedSince != 0 && msg.modSeq > options.UnchangedSince {
+			switch numKind {
+			case imapserver.NumKindSeq:
+				modified.AddNum(mbox.tracker.EncodeSeqNum(seqNum))
+			case imapserver.NumKindUID:
+				modified.AddNum(msg.uid)
+			}
+			return
+		}
+
+		if msg.store(flags) {
+			msg.modSeq = mbox.nextModSeqLocked()
+			changed = true
+		}
+		mbox.Mailbox.tracker.QueueMessageFlagsModSeq(seqNum, msg.uid, msg.flagList(), msg.modSeq, mbox.tracker)
+
+		if !flags.Silent || options.UnchangedSince != 0 {
+			respWriter := w.CreateMessage(mbox.tracker.EncodeSeqNum(seqNum))
+			err = msg.fetch(respWriter, items, nil)
+		}
+	})
+	if changed {
+		mbox.queueStatus(imap.NotifyEventFlagChange)
+	}
+	return modified, err
+}
+
 func (mbox *MailboxView) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error {
 	return mbox.tracker.Poll(w, allowExpunge)
 }
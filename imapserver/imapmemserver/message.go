@@ -3,9 +3,11 @@ package imapmemserver
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"mime"
+	"mime/quotedprintable"
 	"strings"
 	"time"
 
@@ -23,14 +25,19 @@ type message struct {
 	t   time.Time
 
 	// mutable, protected by Mailbox.mutex
-	flags map[imap.Flag]struct{}
+	flags  map[imap.Flag]struct{}
+	modSeq uint64
 }
 
-func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchItem) error {
+// fetch writes a FETCH response for the message.
+//
+// binary contains the decoded BINARY sections, as returned by
+// message.binarySections.
+func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchItem, binary map[imap.FetchItem][]byte) error {
 	w.WriteUID(msg.uid)
 
 	for _, item := range items {
-		if err := msg.fetchItem(w, item); err != nil {
+		if err := msg.fetchItem(w, item, binary); err != nil {
 			return err
 		}
 	}
@@ -38,7 +45,7 @@ func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchI
 	return w.Close()
 }
 
-func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.FetchItem) error {
+func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.FetchItem, binary map[imap.FetchItem][]byte) error {
 	switch item := item.(type) {
 	case *imap.FetchItemBodySection:
 		buf := msg.bodySection(item)
@@ -50,9 +57,18 @@ func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.Fetch
 		}
 		return closeErr
 	case *imap.FetchItemBinarySection:
-		panic("TODO")
+		buf := extractPartial(binary[item], item.Partial)
+		wc := w.WriteBinarySection(item, int64(len(buf)))
+		_, writeErr := wc.Write(buf)
+		closeErr := wc.Close()
+		if writeErr != nil {
+			return writeErr
+		}
+		return closeErr
 	case *imap.FetchItemBinarySectionSize:
-		panic("TODO")
+		section := &imap.FetchItemBinarySection{Part: item.Part}
+		w.WriteBinarySectionSize(section, uint32(len(binary[item])))
+		return nil
 	}
 
 	switch item {
@@ -64,6 +80,8 @@ func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.Fetch
 		w.WriteInternalDate(msg.t)
 	case imap.FetchItemRFC822Size:
 		w.WriteRFC822Size(int64(len(msg.buf)))
+	case imap.FetchItemModSeq:
+		w.WriteModSeq(msg.modSeq)
 	case imap.FetchItemEnvelope:
 		w.WriteEnvelope(msg.envelope())
 	case imap.FetchItemBodyStructure, imap.FetchItemBody:
@@ -90,7 +108,7 @@ func (msg *message) bodyStructure(extended bool) imap.BodyStructure {
 }
 
 func openMessagePart(header textproto.Header, body io.Reader, parentMediaType string) (textproto.Header, io.Reader) {
-	msgHeader := gomessage.Header{header}
+	msgHeader := gomessage.Header{Header: header}
 	mediaType, _, _ := msgHeader.ContentType()
 	if !msgHeader.Has("Content-Type") && parentMediaType == "multipart/digest" {
 		mediaType = "message/rfc822"
@@ -103,39 +121,34 @@ func openMessagePart(header textproto.Header, body io.Reader, parentMediaType st
 	return header, body
 }
 
-func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
-	var (
-		header textproto.Header
-		body   io.Reader
-	)
-
+// openPart returns the header and body of the message part with the
+// provided path.
+func (msg *message) openPart(partPath []int) (header textproto.Header, body io.Reader, parentMediaType string, ok bool) {
 	br := bufio.NewReader(bytes.NewReader(msg.buf))
 	header, err := textproto.ReadHeader(br)
 	if err != nil {
-		return nil
+		return header, nil, "", false
 	}
 	body = br
 
 	// First part of non-multipart message refers to the message itself
-	msgHeader := gomessage.Header{header}
+	msgHeader := gomessage.Header{Header: header}
 	mediaType, _, _ := msgHeader.ContentType()
-	partPath := item.Part
 	if !strings.HasPrefix(mediaType, "multipart/") && len(partPath) > 0 && partPath[0] == 1 {
 		partPath = partPath[1:]
 	}
 
 	// Find the requested part using the provided path
-	var parentMediaType string
 	for i := 0; i < len(partPath); i++ {
 		partNum := partPath[i]
 
 		header, body = openMessagePart(header, body, parentMediaType)
 
-		msgHeader := gomessage.Header{header}
+		msgHeader := gomessage.Header{Header: header}
 		mediaType, typeParams, _ := msgHeader.ContentType()
 		if !strings.HasPrefix(mediaType, "multipart/") {
 			if partNum != 1 {
-				return nil
+				return header, nil, "", false
 			}
 			continue
 		}
@@ -145,7 +158,7 @@ func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
 		for j := 1; j <= partNum; j++ {
 			p, err := mr.NextPart()
 			if err != nil {
-				return nil
+				return header, nil, "", false
 			}
 
 			if j == partNum {
@@ -157,10 +170,19 @@ func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
 			}
 		}
 		if !found {
-			return nil
+			return header, nil, "", false
 		}
 	}
 
+	return header, body, parentMediaType, true
+}
+
+func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
+	header, body, parentMediaType, ok := msg.openPart(item.Part)
+	if !ok {
+		return nil
+	}
+
 	if len(item.Part) > 0 {
 		switch item.Specifier {
 		case imap.PartSpecifierHeader, imap.PartSpecifierText:
@@ -207,19 +229,88 @@ func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
 		}
 	}
 
-	// Extract partial if any
-	b := buf.Bytes()
-	if partial := item.Partial; partial != nil {
-		end := partial.Offset + partial.Size
-		if partial.Offset > int64(len(b)) {
-			return nil
+	return extractPartial(buf.Bytes(), item.Partial)
+}
+
+// binarySections decodes the BINARY sections requested in a FETCH command.
+//
+// This needs to happen before the FETCH response is written, so that decoding
+// errors can be reported to the client.
+func (msg *message) binarySections(items []imap.FetchItem) (map[imap.FetchItem][]byte, error) {
+	var m map[imap.FetchItem][]byte
+	for _, item := range items {
+		var part []int
+		switch item := item.(type) {
+		case *imap.FetchItemBinarySection:
+			part = item.Part
+		case *imap.FetchItemBinarySectionSize:
+			part = item.Part
+		default:
+			continue
+		}
+
+		b, err := msg.binarySection(part)
+		if err != nil {
+			return nil, err
 		}
-		if end > int64(len(b)) {
-			end = int64(len(b))
+		if m == nil {
+			m = make(map[imap.FetchItem][]byte)
 		}
-		b = b[partial.Offset:end]
+		m[item] = b
 	}
-	return b
+	return m, nil
+}
+
+// binarySection returns the contents of a message part, with the
+// Content-Transfer-Encoding removed.
+func (msg *message) binarySection(partPath []int) ([]byte, error) {
+	if len(partPath) == 0 {
+		return msg.buf, nil
+	}
+
+	header, body, _, ok := msg.openPart(partPath)
+	if !ok {
+		return nil, nil
+	}
+
+	var r io.Reader
+	switch enc := strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))); enc {
+	case "", "7bit", "8bit", "binary":
+		r = body
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(body)
+	default:
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeUnknownCTE,
+			Text: fmt.Sprintf("Unknown Content-Transfer-Encoding %q", enc),
+		}
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: fmt.Sprintf("Failed to decode message part: %v", err),
+		}
+	}
+	return b, nil
+}
+
+func extractPartial(b []byte, partial *imap.SectionPartial) []byte {
+	if partial == nil {
+		return b
+	}
+	end := partial.Offset + partial.Size
+	if partial.Offset > int64(len(b)) {
+		return nil
+	}
+	if end > int64(len(b)) {
+		end = int64(len(b))
+	}
+	return b[partial.Offset:end]
 }
 
 func (msg *message) flagList() []imap.Flag {
@@ -230,7 +321,10 @@ func (msg *message) flagList() []imap.Flag {
 	return flags
 }
 
-func (msg *message) store(store *imap.StoreFlags) {
+// store alters the message flags. It returns true if the flags have changed.
+func (msg *message) store(store *imap.StoreFlags) bool {
+	prev := msg.flagList()
+
 	switch store.Op {
 	case imap.StoreFlagsSet:
 		msg.flags = make(map[imap.Flag]struct{})
@@ -246,6 +340,16 @@ func (msg *message) store(store *imap.StoreFlags) {
 	default:
 		panic(fmt.Errorf("unknown STORE flag operation: %v", store.Op))
 	}
+
+	if len(prev) != len(msg.flags) {
+		return true
+	}
+	for _, flag := range prev {
+		if _, ok := msg.flags[flag]; !ok {
+			return true
+		}
+	}
+	return false
 }
 
 func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
@@ -270,6 +374,10 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 		}
 	}
 
+	if criteria.ModSeq != nil && msg.modSeq < criteria.ModSeq.ModSeq {
+		return false
+	}
+
 	if criteria.Larger != 0 && int64(len(msg.buf)) <= criteria.Larger {
 		return false
 	}
@@ -283,7 +391,7 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 
 	br := bufio.NewReader(bytes.NewReader(msg.buf))
 	rawHeader, _ := textproto.ReadHeader(br)
-	header := mail.Header{gomessage.Header{rawHeader}}
+	header := mail.Header{Header: gomessage.Header{Header: rawHeader}}
 
 	for _, fieldCriteria := range criteria.Header {
 		if !header.Has(fieldCriteria.Key) {
@@ -404,7 +512,7 @@ func canonicalFlag(flag imap.Flag) imap.Flag {
 }
 
 func getBodyStructure(rawHeader textproto.Header, r io.Reader, extended bool) imap.BodyStructure {
-	header := gomessage.Header{rawHeader}
+	header := gomessage.Header{Header: rawHeader}
 
 	mediaType, typeParams, _ := header.ContentType()
 	primaryType, subType, _ := strings.Cut(mediaType, "/")
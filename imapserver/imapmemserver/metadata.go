@@ -0,0 +1,134 @@
+package imapmemserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+const (
+	// metadataMaxSize is the maximum size of a metadata entry value.
+	metadataMaxSize = 64 * 1024
+	// metadataMaxEntries is the maximum number of metadata entries per
+	// mailbox, and for the server.
+	metadataMaxEntries = 1024
+)
+
+func (u *User) GetMetadata(mailbox string, entries []string, options *imap.GetMetadataOptions) (*imap.GetMetadataData, error) {
+	data := imap.GetMetadataData{
+		Mailbox:     mailbox,
+		EntryValues: make(map[string]*[]byte),
+	}
+	err := u.withMetadata(mailbox, func(shared, private map[string][]byte) error {
+		for _, m := range []map[string][]byte{shared, private} {
+			for k, v := range m {
+				if matchMetadataEntry(k, entries, options.Depth) {
+					v := v
+					data.EntryValues[k] = &v
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (u *User) SetMetadata(mailbox string, entries map[string]*[]byte) error {
+	return u.withMetadata(mailbox, func(shared, private map[string][]byte) error {
+		nShared, nPrivate := len(shared), len(private)
+		for k, v := range entries {
+			m, n := shared, &nShared
+			if isPrivateMetadataEntry(k) {
+				m, n = private, &nPrivate
+			}
+			_, exists := m[k]
+			switch {
+			case v == nil && exists:
+				*n--
+			case v != nil && !exists:
+				*n++
+			}
+			if v != nil && len(*v) > metadataMaxSize {
+				return imapserver.NewMetadataMaxSizeError(metadataMaxSize)
+			}
+		}
+		if nShared > metadataMaxEntries || nPrivate > metadataMaxEntries {
+			return imapserver.ErrMetadataTooMany
+		}
+
+		for k, v := range entries {
+			m := shared
+			if isPrivateMetadataEntry(k) {
+				m = private
+			}
+			if v == nil {
+				delete(m, k)
+			} else {
+				m[k] = append([]byte(nil), *v...)
+			}
+		}
+		return nil
+	})
+}
+
+// withMetadata calls f with the shared metadata entries and the user's
+// private metadata entries of the specified mailbox, or with the server
+// entries if mailbox is empty.
+func (u *User) withMetadata(mailbox string, f func(shared, private map[string][]byte) error) error {
+	if mailbox == "" {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		if u.metadata == nil {
+			u.metadata = make(map[string][]byte)
+			u.privateMetadata = make(map[string][]byte)
+		}
+		return f(u.metadata, u.privateMetadata)
+	}
+
+	mbox, err := u.mailbox(mailbox, nil)
+	if err != nil {
+		return err
+	}
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	if mbox.metadata == nil {
+		mbox.metadata = make(map[string][]byte)
+		mbox.privateMetadata = make(map[string]map[string][]byte)
+	}
+	// Mailboxes may be shared with other users
+	private := mbox.privateMetadata[u.username]
+	if private == nil {
+		private = make(map[string][]byte)
+		mbox.privateMetadata[u.username] = private
+	}
+	return f(mbox.metadata, private)
+}
+
+func isPrivateMetadataEntry(k string) bool {
+	return k == "/private" || strings.HasPrefix(k, "/private/")
+}
+
+func matchMetadataEntry(k string, entries []string, depth imap.GetMetadataDepth) bool {
+	for _, entry := range entries {
+		if k == entry {
+			return true
+		}
+		rest := strings.TrimPrefix(k, entry+"/")
+		if rest == k {
+			continue
+		}
+		switch depth {
+		case imap.GetMetadataDepthOne:
+			if !strings.Contains(rest, "/") {
+				return true
+			}
+		case imap.GetMetadataDepthInfinity:
+			return true
+		}
+	}
+	return false
+}
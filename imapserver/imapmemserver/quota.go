@@ -0,0 +1,148 @@
+package imapmemserver
+
+import (
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// quotaRoot is the name of the single quota root of a user.
+const quotaRoot = ""
+
+var quotaResourceTypes = []imap.QuotaResourceType{
+	imap.QuotaResourceStorage,
+	imap.QuotaResourceMessage,
+	imap.QuotaResourceMailbox,
+}
+
+var errNoSuchQuotaRoot = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeNonExistent,
+	Text: "No such quota root",
+}
+
+func (u *User) QuotaResourceTypes() []imap.QuotaResourceType {
+	return quotaResourceTypes
+}
+
+func (u *User) GetQuota(root string) (*imap.QuotaData, error) {
+	if root != quotaRoot {
+		return nil, errNoSuchQuotaRoot
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.quotaDataLocked(), nil
+}
+
+func (u *User) GetQuotaRoot(mailbox string) ([]imap.QuotaData, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if _, err := u.mailboxLocked(mailbox, nil); err != nil {
+		return nil, err
+	}
+	if len(u.quotaLimits) == 0 {
+		return nil, nil
+	}
+	return []imap.QuotaData{*u.quotaDataLocked()}, nil
+}
+
+// SetQuota sets the user's resource limits. STORAGE limits are expressed in
+// units of 1024 octets. Resources missing from limits are unlimited.
+//
+// SetQuota isn't exposed to IMAP clients via SETQUOTA: users could otherwise
+// raise their own limits.
+func (u *User) SetQuota(limits map[imap.QuotaResourceType]int64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.quotaLimits = make(map[imap.QuotaResourceType]int64, len(limits))
+	for typ, limit := range limits {
+		u.quotaLimits[typ] = limit
+	}
+}
+
+func (u *User) quotaDataLocked() *imap.QuotaData {
+	usage := u.quotaUsageLocked()
+	data := imap.QuotaData{
+		Root:      quotaRoot,
+		Resources: make(map[imap.QuotaResourceType]imap.QuotaResourceData),
+	}
+	for typ, limit := range u.quotaLimits {
+		data.Resources[typ] = imap.QuotaResourceData{
+			Usage: usage[typ],
+			Limit: limit,
+		}
+	}
+	return &data
+}
+
+// owns returns true if the mailbox was created by the user, as opposed
+// to a mailbox shared with the user via AddMailbox. Only the mailboxes owned
+// by the user count towards the user's quota.
+func (u *User) owns(mbox *Mailbox) bool {
+	return mbox.userTracker == u.tracker
+}
+
+// usageLocked returns the total size in bytes and the total number of
+// messages stored in the mailboxes owned by the user, as well as the number
+// of these mailboxes.
+func (u *User) usageLocked() (size, numMessages, numMailboxes int64) {
+	for _, mbox := range u.mailboxes {
+		if !u.owns(mbox) {
+			continue
+		}
+		numMailboxes++
+		mbox.mutex.Lock()
+		size += mbox.sizeLocked()
+		numMessages += int64(len(mbox.l))
+		mbox.mutex.Unlock()
+	}
+	return size, numMessages, numMailboxes
+}
+
+func (u *User) quotaUsageLocked() map[imap.QuotaResourceType]int64 {
+	size, numMessages, numMailboxes := u.usageLocked()
+	return map[imap.QuotaResourceType]int64{
+		imap.QuotaResourceStorage: (size + 1023) / 1024,
+		imap.QuotaResourceMessage: numMessages,
+		imap.QuotaResourceMailbox: numMailboxes,
+	}
+}
+
+// checkQuota returns imapserver.ErrQuotaExceeded if adding the specified
+// number of messages with the specified total size in bytes would exceed the
+// user's quota.
+func (u *User) checkQuota(numMessages, size int64) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.checkQuotaLocked(numMessages, size)
+}
+
+func (u *User) checkQuotaLocked(numMessages, size int64) error {
+	if len(u.quotaLimits) == 0 {
+		return nil
+	}
+
+	curSize, curNumMessages, _ := u.usageLocked()
+	if limit, ok := u.quotaLimits[imap.QuotaResourceMessage]; ok && curNumMessages+numMessages > limit {
+		return imapserver.ErrQuotaExceeded
+	}
+	if limit, ok := u.quotaLimits[imap.QuotaResourceStorage]; ok && curSize+size > limit*1024 {
+		return imapserver.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// checkMailboxQuotaLocked returns imapserver.ErrQuotaExceeded if creating a
+// new mailbox would exceed the user's quota.
+func (u *User) checkMailboxQuotaLocked() error {
+	limit, ok := u.quotaLimits[imap.QuotaResourceMailbox]
+	if !ok {
+		return nil
+	}
+	if _, _, numMailboxes := u.usageLocked(); numMailboxes+1 > limit {
+		return imapserver.ErrQuotaExceeded
+	}
+	return nil
+}
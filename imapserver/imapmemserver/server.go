@@ -46,7 +46,10 @@ type serverSession struct {
 	server *Server // immutable
 }
 
-var _ imapserver.Session = (*serverSession)(nil)
+var (
+	_ imapserver.Session      = (*serverSession)(nil)
+	_ imapserver.SessionSCRAM = (*serverSession)(nil)
+)
 
 func (sess *serverSession) Login(username, password string) error {
 	u := sess.server.user(username)
@@ -59,3 +62,20 @@ func (sess *serverSession) Login(username, password string) error {
 	sess.UserSession = NewUserSession(u)
 	return nil
 }
+
+func (sess *serverSession) SCRAMCredentials(mech, username string) (*imapserver.SCRAMCredentials, error) {
+	u := sess.server.user(username)
+	if u == nil {
+		return nil, imapserver.ErrAuthFailed
+	}
+	return u.scramCredentials(mech)
+}
+
+func (sess *serverSession) LoginSCRAM(username string) error {
+	u := sess.server.user(username)
+	if u == nil {
+		return imapserver.ErrAuthFailed
+	}
+	sess.UserSession = NewUserSession(u)
+	return nil
+}
@@ -19,7 +19,16 @@ type UserSession struct {
 	*mailbox // may be nil
 }
 
-var _ imapserver.SessionIMAP4rev2 = (*UserSession)(nil)
+var (
+	_ imapserver.SessionIMAP4rev2 = (*UserSession)(nil)
+	_ imapserver.SessionCondStore = (*UserSession)(nil)
+	_ imapserver.SessionSort      = (*UserSession)(nil)
+	_ imapserver.SessionThread    = (*UserSession)(nil)
+	_ imapserver.SessionMetadata  = (*UserSession)(nil)
+	_ imapserver.SessionACL       = (*UserSession)(nil)
+	_ imapserver.SessionNotify    = (*UserSession)(nil)
+	_ imapserver.SessionAppend    = (*UserSession)(nil)
+)
 
 // NewUserSession creates a new user session.
 func NewUserSession(user *User) *UserSession {
@@ -34,7 +43,7 @@ func (sess *UserSession) Close() error {
 }
 
 func (sess *UserSession) Select(name string, options *imapserver.SelectOptions) (*imap.SelectData, error) {
-	mbox, err := sess.user.mailbox(name)
+	mbox, err := sess.user.mailbox(name, imap.RightSet{imap.RightRead})
 	if err != nil {
 		return nil, err
 	}
@@ -51,13 +60,13 @@ func (sess *UserSession) Unselect() error {
 }
 
 func (sess *UserSession) Copy(numKind imapserver.NumKind, seqSet imap.SeqSet, destName string) (*imap.CopyData, error) {
-	dest, err := sess.user.mailbox(destName)
+	// The quota check and the copy must happen atomically
+	sess.user.mutex.Lock()
+	defer sess.user.mutex.Unlock()
+
+	dest, err := sess.user.mailboxLocked(destName, imap.RightSet{imap.RightInsert})
 	if err != nil {
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeTryCreate,
-			Text: "No such mailbox",
-		}
+		return nil, tryCreateError(err)
 	} else if sess.mailbox != nil && dest == sess.mailbox.Mailbox {
 		return nil, &imap.Error{
 			Type: imap.StatusResponseTypeNo,
@@ -65,6 +74,15 @@ func (sess *UserSession) Copy(numKind imapserver.NumKind, seqSet imap.SeqSet, de
 		}
 	}
 
+	var numMessages, size int64
+	sess.mailbox.forEach(numKind, seqSet, func(seqNum uint32, msg *message) {
+		numMessages++
+		size += int64(len(msg.buf))
+	})
+	if err := sess.user.checkQuotaLocked(numMessages, size); err != nil {
+		return nil, err
+	}
+
 	var sourceUIDs, destUIDs imap.SeqSet
 	sess.mailbox.forEach(numKind, seqSet, func(seqNum uint32, msg *message) {
 		appendData := dest.copyMsg(msg)
@@ -80,13 +98,13 @@ func (sess *UserSession) Copy(numKind imapserver.NumKind, seqSet imap.SeqSet, de
 }
 
 func (sess *UserSession) Move(w *imapserver.MoveWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, destName string) error {
-	dest, err := sess.user.mailbox(destName)
+	if err := sess.checkRights(imap.RightSet{imap.RightDeleteMessages, imap.RightExpunge}); err != nil {
+		return err
+	}
+
+	dest, err := sess.user.mailbox(destName, imap.RightSet{imap.RightInsert})
 	if err != nil {
-		return &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeTryCreate,
-			Text: "No such mailbox",
-		}
+		return tryCreateError(err)
 	} else if sess.mailbox != nil && dest == sess.mailbox.Mailbox {
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
@@ -105,24 +123,72 @@ func (sess *UserSession) Move(w *imapserver.MoveWriter, numKind imapserver.NumKi
 		destUIDs.AddNum(appendData.UID)
 		expunged[msg] = struct{}{}
 	})
-	seqNums := sess.mailbox.expungeLocked(expunged)
+	// EXPUNGE responses are sent to this session when polling for updates
+	sess.mailbox.expungeLocked(expunged)
 
-	err = w.WriteCopyData(&imap.CopyData{
+	return w.WriteCopyData(&imap.CopyData{
 		UIDValidity: dest.uidValidity,
 		SourceUIDs:  sourceUIDs,
 		DestUIDs:    destUIDs,
 	})
-	if err != nil {
+}
+
+func (sess *UserSession) Fetch(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem) error {
+	return sess.FetchWithOptions(w, numKind, seqSet, items, &imap.FetchOptions{})
+}
+
+func (sess *UserSession) FetchWithOptions(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem, options *imap.FetchOptions) error {
+	// Messages are only marked as seen if the user has the right to do so
+	canSetSeen := sess.checkRights(imap.RightSet{imap.RightSeen}) == nil
+	return sess.mailbox.fetch(w, numKind, seqSet, items, options, canSetSeen)
+}
+
+func (sess *UserSession) Store(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags) error {
+	if err := sess.checkRights(storeRights(flags)); err != nil {
 		return err
 	}
+	return sess.mailbox.Store(w, numKind, seqSet, flags)
+}
 
-	for _, seqNum := range seqNums {
-		if err := w.WriteExpunge(sess.mailbox.tracker.EncodeSeqNum(seqNum)); err != nil {
-			return err
-		}
+func (sess *UserSession) StoreWithOptions(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags, options *imap.StoreOptions) (imap.SeqSet, error) {
+	if err := sess.checkRights(storeRights(flags)); err != nil {
+		return imap.SeqSet{}, err
 	}
+	return sess.mailbox.StoreWithOptions(w, numKind, seqSet, flags, options)
+}
 
-	return nil
+func (sess *UserSession) Expunge(w *imapserver.ExpungeWriter, uids *imap.SeqSet) error {
+	if err := sess.checkRights(imap.RightSet{imap.RightExpunge}); err != nil {
+		return err
+	}
+	return sess.mailbox.Expunge(w, uids)
+}
+
+// checkRights checks that the user has the specified rights on the currently
+// selected mailbox.
+func (sess *UserSession) checkRights(rights imap.RightSet) error {
+	return sess.user.checkRights(sess.mailbox.Mailbox, rights)
+}
+
+// storeRights returns the rights required to alter the specified flags.
+func storeRights(flags *imap.StoreFlags) imap.RightSet {
+	if flags.Op == imap.StoreFlagsSet {
+		// Replacing the flags may remove any of them
+		return imap.RightSet{imap.RightSeen, imap.RightWrite, imap.RightDeleteMessages}
+	}
+
+	var rights imap.RightSet
+	for _, flag := range flags.Flags {
+		switch flag {
+		case imap.FlagSeen:
+			rights = rights.Add(imap.RightSet{imap.RightSeen})
+		case imap.FlagDeleted:
+			rights = rights.Add(imap.RightSet{imap.RightDeleteMessages})
+		default:
+			rights = rights.Add(imap.RightSet{imap.RightWrite})
+		}
+	}
+	return rights
 }
 
 func (sess *UserSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error {
@@ -134,7 +200,10 @@ func (sess *UserSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) err
 
 func (sess *UserSession) Idle(w *imapserver.UpdateWriter, stop <-chan struct{}) error {
 	if sess.mailbox == nil {
-		return nil // TODO
+		// No mailbox updates to send in the authenticated state. Updates
+		// requested with NOTIFY are delivered by imapserver.
+		<-stop
+		return nil
 	}
 	return sess.mailbox.Idle(w, stop)
 }
@@ -0,0 +1,242 @@
+package imapmemserver
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+// sortMessage is a message matched by a SORT or THREAD command.
+type sortMessage struct {
+	seqNum uint32
+	num    uint32
+	msg    *message
+	header mail.Header
+}
+
+func (mbox *MailboxView) Sort(numKind imapserver.NumKind, criteria *imap.SearchCriteria, sortCriteria []imap.SortCriterion) ([]uint32, error) {
+	mbox.mutex.Lock()
+	l := mbox.searchLocked(numKind, criteria)
+	mbox.mutex.Unlock()
+
+	// Messages are already ordered by sequence number, which is the final
+	// tie-breaker
+	sort.SliceStable(l, func(i, j int) bool {
+		for _, criterion := range sortCriteria {
+			cmp := compareSortKey(criterion.Key, &l[i], &l[j])
+			if criterion.Reverse {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	nums := make([]uint32, len(l))
+	for i, sm := range l {
+		nums[i] = sm.num
+	}
+	return nums, nil
+}
+
+func (mbox *MailboxView) searchLocked(numKind imapserver.NumKind, criteria *imap.SearchCriteria) []sortMessage {
+	mbox.staticSeqSet(criteria.SeqNum, imapserver.NumKindSeq)
+	mbox.staticSeqSet(criteria.UID, imapserver.NumKindUID)
+
+	var l []sortMessage
+	for i, msg := range mbox.l {
+		seqNum := mbox.tracker.EncodeSeqNum(uint32(i) + 1)
+		if seqNum == 0 || !msg.search(seqNum, criteria) {
+			continue
+		}
+
+		num := seqNum
+		if numKind == imapserver.NumKindUID {
+			num = msg.uid
+		}
+
+		br := bufio.NewReader(bytes.NewReader(msg.buf))
+		header, _ := textproto.ReadHeader(br)
+
+		l = append(l, sortMessage{
+			seqNum: seqNum,
+			num:    num,
+			msg:    msg,
+			header: mail.Header{Header: gomessage.Header{Header: header}},
+		})
+	}
+	return l
+}
+
+// sentDate returns the sent date of the message, falling back to the
+// internal date if the Date header field is missing or invalid.
+func (sm *sortMessage) sentDate() time.Time {
+	if t, err := sm.header.Date(); err == nil {
+		return t
+	}
+	return sm.msg.t
+}
+
+// baseSubject returns the base subject of the message, and whether the
+// message is a reply or a forward.
+func (sm *sortMessage) baseSubject() (string, bool) {
+	subject, err := sm.header.Subject()
+	if err != nil {
+		subject = sm.header.Get("Subject")
+	}
+	return baseSubject(subject)
+}
+
+// addrMailbox returns the local-part of the first address in the specified
+// header field.
+func (sm *sortMessage) addrMailbox(k string) string {
+	addrs, _ := sm.header.AddressList(k)
+	if len(addrs) == 0 {
+		return ""
+	}
+	mailbox, _, _ := strings.Cut(addrs[0].Address, "@")
+	return mailbox
+}
+
+func compareSortKey(key imap.SortKey, a, b *sortMessage) int {
+	switch key {
+	case imap.SortKeyArrival:
+		return compareTime(a.msg.t, b.msg.t)
+	case imap.SortKeyCc:
+		return compareFold(a.addrMailbox("Cc"), b.addrMailbox("Cc"))
+	case imap.SortKeyDate:
+		return compareTime(a.sentDate(), b.sentDate())
+	case imap.SortKeyFrom:
+		return compareFold(a.addrMailbox("From"), b.addrMailbox("From"))
+	case imap.SortKeySize:
+		return compareInt(len(a.msg.buf), len(b.msg.buf))
+	case imap.SortKeySubject:
+		subjectA, _ := a.baseSubject()
+		subjectB, _ := b.baseSubject()
+		return compareFold(subjectA, subjectB)
+	case imap.SortKeyTo:
+		return compareFold(a.addrMailbox("To"), b.addrMailbox("To"))
+	default:
+		return 0
+	}
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareFold compares two strings with the i;ascii-casemap collation.
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToUpper(a), strings.ToUpper(b))
+}
+
+// baseSubject extracts the base subject as defined in RFC 5256 section 2.1.
+// It also returns whether the subject indicates a reply or a forward.
+func baseSubject(s string) (base string, isReply bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	for {
+		// Remove subj-trailer
+		for {
+			lower := strings.ToLower(s)
+			if strings.HasSuffix(lower, "(fwd)") {
+				s = strings.TrimRight(s[:len(s)-len("(fwd)")], " ")
+				isReply = true
+			} else {
+				break
+			}
+		}
+
+		// Remove subj-leader and subj-blob
+		for {
+			if rest, ok := cutSubjectLeader(s); ok {
+				s = rest
+				isReply = true
+			} else if rest, ok := cutSubjectBlob(s); ok && rest != "" {
+				s = rest
+			} else {
+				break
+			}
+		}
+
+		// Remove subj-fwd-hdr and subj-fwd-trl
+		if len(s) > len("[fwd:") && strings.EqualFold(s[:len("[fwd:")], "[fwd:") && strings.HasSuffix(s, "]") {
+			s = strings.TrimSpace(s[len("[fwd:") : len(s)-1])
+			isReply = true
+			continue
+		}
+
+		return s, isReply
+	}
+}
+
+// cutSubjectBlob removes a leading subj-blob and the whitespace after it.
+func cutSubjectBlob(s string) (string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	i := strings.IndexAny(s[1:], "[]")
+	if i < 0 || s[1+i] != ']' {
+		return s, false
+	}
+	return strings.TrimLeft(s[i+2:], " "), true
+}
+
+// cutSubjectLeader removes a leading subj-refwd, optionally preceded by
+// subj-blob items.
+func cutSubjectLeader(s string) (string, bool) {
+	for {
+		rest, ok := cutSubjectBlob(s)
+		if !ok {
+			break
+		}
+		s = rest
+	}
+
+	lower := strings.ToLower(s)
+	var prefix string
+	for _, p := range []string{"re", "fwd", "fw"} {
+		if strings.HasPrefix(lower, p) {
+			prefix = p
+			break
+		}
+	}
+	if prefix == "" {
+		return s, false
+	}
+	s = strings.TrimLeft(s[len(prefix):], " ")
+	if rest, ok := cutSubjectBlob(s); ok {
+		s = rest
+	}
+	if !strings.HasPrefix(s, ":") {
+		return s, false
+	}
+	return strings.TrimLeft(s[1:], " "), true
+}
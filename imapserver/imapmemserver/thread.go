@@ -0,0 +1,323 @@
+package imapmemserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func (mbox *MailboxView) Thread(numKind imapserver.NumKind, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]imap.ThreadData, error) {
+	mbox.mutex.Lock()
+	l := mbox.searchLocked(numKind, criteria)
+	mbox.mutex.Unlock()
+
+	var roots []*threadContainer
+	switch algorithm {
+	case imap.ThreadOrderedSubject:
+		roots = threadOrderedSubject(l)
+	case imap.ThreadReferences:
+		roots = threadReferences(l)
+	default:
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: fmt.Sprintf("Unsupported threading algorithm %q", algorithm),
+		}
+	}
+
+	data := make([]imap.ThreadData, len(roots))
+	for i, root := range roots {
+		data[i] = root.threadData()
+	}
+	return data, nil
+}
+
+// threadContainer is a node in a thread tree. Dummy containers have a nil
+// message.
+type threadContainer struct {
+	msg      *sortMessage
+	parent   *threadContainer
+	children []*threadContainer
+}
+
+func (c *threadContainer) hasDescendant(other *threadContainer) bool {
+	for _, child := range c.children {
+		if child == other || child.hasDescendant(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *threadContainer) addChild(child *threadContainer) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *threadContainer) removeChild(child *threadContainer) {
+	for i, other := range c.children {
+		if other == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// first returns the message used to sort the container: its own message,
+// or the first message of its children for dummy containers.
+func (c *threadContainer) first() *sortMessage {
+	if c.msg != nil {
+		return c.msg
+	}
+	for _, child := range c.children {
+		if msg := child.first(); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (c *threadContainer) threadData() imap.ThreadData {
+	var data imap.ThreadData
+	for c.msg != nil {
+		data.Chain = append(data.Chain, c.msg.num)
+		if len(c.children) != 1 {
+			break
+		}
+		c = c.children[0]
+	}
+	for _, child := range c.children {
+		data.SubThreads = append(data.SubThreads, child.threadData())
+	}
+	return data
+}
+
+// sortThreadContainers sorts containers by sent date, using the sequence
+// number as a tie-breaker. Children are sorted recursively.
+func sortThreadContainers(l []*threadContainer) {
+	for _, c := range l {
+		sortThreadContainers(c.children)
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].first(), l[j].first()
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if cmp := compareTime(a.sentDate(), b.sentDate()); cmp != 0 {
+			return cmp < 0
+		}
+		return a.seqNum < b.seqNum
+	})
+}
+
+// threadOrderedSubject implements the ORDEREDSUBJECT algorithm defined in
+// RFC 5256 section 3.
+func threadOrderedSubject(l []sortMessage) []*threadContainer {
+	var groups [][]*threadContainer
+	bySubject := make(map[string]int)
+	for i := range l {
+		c := &threadContainer{msg: &l[i]}
+		subject, _ := c.msg.baseSubject()
+		subject = strings.ToUpper(subject)
+		if j, ok := bySubject[subject]; ok {
+			groups[j] = append(groups[j], c)
+		} else {
+			bySubject[subject] = len(groups)
+			groups = append(groups, []*threadContainer{c})
+		}
+	}
+
+	// The first message of each thread is the parent, all others are its
+	// children
+	roots := make([]*threadContainer, len(groups))
+	for i, group := range groups {
+		sortThreadContainers(group)
+		roots[i] = group[0]
+		for _, c := range group[1:] {
+			roots[i].addChild(c)
+		}
+	}
+	sortThreadContainers(roots)
+	return roots
+}
+
+// threadReferences implements the REFERENCES algorithm defined in RFC 5256
+// section 3.
+func threadReferences(l []sortMessage) []*threadContainer {
+	byID := make(map[string]*threadContainer)
+	getContainer := func(id string) *threadContainer {
+		c, ok := byID[id]
+		if !ok {
+			c = &threadContainer{}
+			byID[id] = c
+		}
+		return c
+	}
+
+	// Step 1: link messages together
+	var all []*threadContainer
+	for i := range l {
+		sm := &l[i]
+
+		id, _ := sm.header.MessageID()
+		c := byID[id]
+		if id == "" || (c != nil && c.msg != nil) {
+			// Missing or duplicate Message-ID: make up a unique one
+			id = fmt.Sprintf("\x00%d", i)
+			c = nil
+		}
+		if c == nil {
+			c = getContainer(id)
+		}
+		c.msg = sm
+
+		refs, _ := sm.header.MsgIDList("References")
+		if len(refs) == 0 {
+			refs, _ = sm.header.MsgIDList("In-Reply-To")
+			if len(refs) > 1 {
+				refs = refs[:1]
+			}
+		}
+
+		var prev *threadContainer
+		for _, ref := range refs {
+			ref := getContainer(ref)
+			if prev != nil && ref.parent == nil && ref != prev && !ref.hasDescendant(prev) {
+				prev.addChild(ref)
+			}
+			prev = ref
+		}
+		if prev != nil && prev != c && !c.hasDescendant(prev) {
+			prev.addChild(c)
+		}
+	}
+	for _, c := range byID {
+		all = append(all, c)
+	}
+
+	// Step 2: gather the root set
+	var roots []*threadContainer
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	// Keep the root set in a stable order before sorting
+	sortThreadContainers(roots)
+
+	// Step 3: prune dummy containers
+	roots = pruneThreadContainers(roots, true)
+
+	// Step 4: sort
+	sortThreadContainers(roots)
+
+	// Step 5: group root messages by base subject
+	bySubject := make(map[string]*threadContainer)
+	rootSubject := func(c *threadContainer) (string, bool) {
+		msg := c.msg
+		if msg == nil {
+			msg = c.children[0].msg
+		}
+		subject, isReply := msg.baseSubject()
+		return strings.ToUpper(subject), isReply
+	}
+	for _, c := range roots {
+		subject, isReply := rootSubject(c)
+		if subject == "" {
+			continue
+		}
+		other, ok := bySubject[subject]
+		if !ok {
+			bySubject[subject] = c
+			continue
+		}
+		_, otherIsReply := rootSubject(other)
+		if (c.msg == nil && other.msg != nil) || (c.msg != nil && other.msg != nil && otherIsReply && !isReply) {
+			bySubject[subject] = c
+		}
+	}
+
+	for _, c := range roots {
+		if c.parent != nil {
+			continue // already merged
+		}
+		subject, isReply := rootSubject(c)
+		other, ok := bySubject[subject]
+		if subject == "" || !ok || other == c {
+			continue
+		}
+		_, otherIsReply := rootSubject(other)
+
+		switch {
+		case c.msg == nil && other.msg == nil:
+			for len(c.children) > 0 {
+				other.addChild(c.children[0])
+			}
+		case other.msg == nil:
+			other.addChild(c)
+		case c.msg == nil:
+			c.addChild(other)
+			bySubject[subject] = c
+		case !otherIsReply && isReply:
+			other.addChild(c)
+		default:
+			dummy := &threadContainer{}
+			dummy.addChild(other)
+			dummy.addChild(c)
+			bySubject[subject] = dummy
+		}
+	}
+
+	var merged []*threadContainer
+	seen := make(map[*threadContainer]bool)
+	for _, c := range roots {
+		for c.parent != nil {
+			c = c.parent
+		}
+		if seen[c] || (c.msg == nil && len(c.children) == 0) {
+			continue
+		}
+		seen[c] = true
+		merged = append(merged, c)
+	}
+
+	// Step 6: sort again
+	sortThreadContainers(merged)
+	return merged
+}
+
+// pruneThreadContainers removes dummy containers without children, and
+// promotes the children of dummy containers to the current level, unless
+// the current level is the root set and there is more than one child.
+func pruneThreadContainers(l []*threadContainer, root bool) []*threadContainer {
+	var out []*threadContainer
+	for _, c := range l {
+		c.children = pruneThreadContainers(c.children, false)
+		for _, child := range c.children {
+			child.parent = c
+		}
+
+		if c.msg != nil {
+			out = append(out, c)
+			continue
+		}
+		switch {
+		case len(c.children) == 0:
+			// Drop the empty container
+		case !root || len(c.children) == 1:
+			for _, child := range c.children {
+				child.parent = c.parent
+				out = append(out, child)
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -1,6 +1,8 @@
 package imapmemserver
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/subtle"
 	"sort"
 	"strings"
@@ -12,18 +14,33 @@ import (
 
 const mailboxDelim rune = '/'
 
+// scramIterations is the SCRAM iteration count, as recommended by RFC 7677.
+const scramIterations = 4096
+
 type User struct {
 	username, password string
+	scramSalt          []byte
+
+	tracker *imapserver.UserTracker
 
 	mutex           sync.Mutex
 	mailboxes       map[string]*Mailbox
 	prevUidValidity uint32
+	quotaLimits     map[imap.QuotaResourceType]int64
+	metadata        map[string][]byte
+	privateMetadata map[string][]byte
 }
 
 func NewUser(username, password string) *User {
+	scramSalt := make([]byte, 16)
+	if _, err := rand.Read(scramSalt); err != nil {
+		panic(err)
+	}
 	return &User{
 		username:  username,
 		password:  password,
+		scramSalt: scramSalt,
+		tracker:   imapserver.NewUserTracker(),
 		mailboxes: make(map[string]*Mailbox),
 	}
 }
@@ -38,26 +55,37 @@ func (u *User) Login(username, password string) error {
 	return nil
 }
 
-func (u *User) mailboxLocked(name string) (*Mailbox, error) {
+// UserTracker returns the tracker used to notify sessions about changes to
+// the user's mailboxes.
+func (u *User) UserTracker() *imapserver.UserTracker {
+	return u.tracker
+}
+
+func (u *User) scramCredentials(mech string) (*imapserver.SCRAMCredentials, error) {
+	return imapserver.NewSCRAMCredentials(mech, u.password, u.scramSalt, scramIterations)
+}
+
+// mailboxLocked looks up a mailbox and checks that the user has the
+// specified rights on it.
+func (u *User) mailboxLocked(name string, rights imap.RightSet) (*Mailbox, error) {
 	mbox := u.mailboxes[name]
 	if mbox == nil {
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeNonExistent,
-			Text: "No such mailbox",
-		}
+		return nil, errNoSuchMailbox
+	}
+	if err := u.checkRights(mbox, rights); err != nil {
+		return nil, err
 	}
 	return mbox, nil
 }
 
-func (u *User) mailbox(name string) (*Mailbox, error) {
+func (u *User) mailbox(name string, rights imap.RightSet) (*Mailbox, error) {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
-	return u.mailboxLocked(name)
+	return u.mailboxLocked(name, rights)
 }
 
 func (u *User) Status(name string, items []imap.StatusItem) (*imap.StatusData, error) {
-	mbox, err := u.mailbox(name)
+	mbox, err := u.mailbox(name, imap.RightSet{imap.RightRead})
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +114,7 @@ func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, opt
 				break
 			}
 		}
-		if !match {
+		if !match || !mbox.Rights(u.username).Has(imap.RightLookup) {
 			continue
 		}
 
@@ -110,15 +138,32 @@ func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, opt
 }
 
 func (u *User) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
-	mbox, err := u.mailbox(mailbox)
+	if _, err := u.mailbox(mailbox, imap.RightSet{imap.RightInsert}); err != nil {
+		return nil, tryCreateError(err)
+	}
+	// Reject the message before reading it if it's obviously too large
+	if err := u.checkQuota(1, r.Size()); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// The mailbox may have been deleted or renamed, and other messages may
+	// have been appended while the message was being read
+	mbox, err := u.mailboxLocked(mailbox, imap.RightSet{imap.RightInsert})
 	if err != nil {
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeTryCreate,
-			Text: "No such mailbox",
-		}
+		return nil, tryCreateError(err)
 	}
-	return mbox.appendLiteral(r, options)
+	if err := u.checkQuotaLocked(1, int64(buf.Len())); err != nil {
+		return nil, err
+	}
+	return mbox.appendBytes(buf.Bytes(), options), nil
 }
 
 func (u *User) Create(name string) error {
@@ -134,11 +179,18 @@ func (u *User) Create(name string) error {
 			Text: "Mailbox already exists",
 		}
 	}
+	if err := u.checkMailboxQuotaLocked(); err != nil {
+		return err
+	}
 
 	// UIDVALIDITY must change if a mailbox is deleted and re-created with the
 	// same name.
 	u.prevUidValidity++
-	u.mailboxes[name] = NewMailbox(name, u.prevUidValidity)
+	mbox := NewMailbox(name, u.prevUidValidity)
+	mbox.SetRights(imap.RightsIdentifier(u.username), imap.AllRights)
+	mbox.userTracker = u.tracker
+	u.mailboxes[name] = mbox
+	u.tracker.QueueMailboxName(&imap.ListData{Mailbox: name, Delim: mailboxDelim})
 	return nil
 }
 
@@ -146,11 +198,16 @@ func (u *User) Delete(name string) error {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
-	if _, err := u.mailboxLocked(name); err != nil {
+	if _, err := u.mailboxLocked(name, imap.RightSet{imap.RightDeleteMailbox}); err != nil {
 		return err
 	}
 
 	delete(u.mailboxes, name)
+	u.tracker.QueueMailboxName(&imap.ListData{
+		Attrs:   []imap.MailboxAttr{imap.MailboxAttrNonExistent},
+		Delim:   mailboxDelim,
+		Mailbox: name,
+	})
 	return nil
 }
 
@@ -160,7 +217,7 @@ func (u *User) Rename(oldName, newName string) error {
 
 	newName = strings.TrimRight(newName, string(mailboxDelim))
 
-	mbox, err := u.mailboxLocked(oldName)
+	mbox, err := u.mailboxLocked(oldName, imap.RightSet{imap.RightDeleteMailbox})
 	if err != nil {
 		return err
 	}
@@ -176,24 +233,38 @@ func (u *User) Rename(oldName, newName string) error {
 	mbox.rename(newName)
 	u.mailboxes[newName] = mbox
 	delete(u.mailboxes, oldName)
+	u.tracker.QueueMailboxName(&imap.ListData{
+		Delim:   mailboxDelim,
+		Mailbox: newName,
+		OldName: oldName,
+	})
 	return nil
 }
 
 func (u *User) Subscribe(name string) error {
-	mbox, err := u.mailbox(name)
+	mbox, err := u.mailbox(name, nil)
 	if err != nil {
 		return err
 	}
 	mbox.SetSubscribed(true)
+	u.tracker.QueueSubscriptionChange(&imap.ListData{
+		Attrs:   []imap.MailboxAttr{imap.MailboxAttrSubscribed},
+		Delim:   mailboxDelim,
+		Mailbox: name,
+	})
 	return nil
 }
 
 func (u *User) Unsubscribe(name string) error {
-	mbox, err := u.mailbox(name)
+	mbox, err := u.mailbox(name, nil)
 	if err != nil {
 		return err
 	}
 	mbox.SetSubscribed(false)
+	u.tracker.QueueSubscriptionChange(&imap.ListData{
+		Delim:   mailboxDelim,
+		Mailbox: name,
+	})
 	return nil
 }
 
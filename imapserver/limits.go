@@ -0,0 +1,165 @@
+package imapserver
+
+import (
+	"net"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultAppendLimit    = 100 * 1024 * 1024 // 100MiB
+	defaultMaxLiteralSize = 4096
+
+	defaultReadTimeout  = 30 * time.Second
+	defaultIdleTimeout  = 35 * time.Minute // section 5.4 says 30min minimum
+	defaultWriteTimeout = 30 * time.Second
+
+	literalReadTimeout  = 5 * time.Minute
+	literalWriteTimeout = 5 * time.Minute
+
+	// MULTIAPPEND commands are buffered until committed
+	maxAppendMessages = 1000
+	maxAppendSize     = 1024 * 1024 * 1024 // 1GiB
+)
+
+var (
+	tooManyConnsResp = &imap.StatusResponse{
+		Type: imap.StatusResponseTypeBye,
+		Code: imap.ResponseCodeUnavailable,
+		Text: "Too many connections",
+	}
+	tooManyUserConnsResp = &imap.StatusResponse{
+		Type: imap.StatusResponseTypeBye,
+		Code: imap.ResponseCodeUnavailable,
+		Text: "Too many connections for this user",
+	}
+)
+
+func (options *Options) appendLimit() int64 {
+	if options.AppendLimit > 0 {
+		return int64(options.AppendLimit)
+	}
+	return defaultAppendLimit
+}
+
+// appendTransactionLimit returns the maximum total size of the messages
+// added by a single APPEND command.
+func (options *Options) appendTransactionLimit() int64 {
+	if limit := options.appendLimit(); limit > maxAppendSize {
+		return limit
+	}
+	return maxAppendSize
+}
+
+func (options *Options) maxLiteralSize() int64 {
+	if options.MaxLiteralSize > 0 {
+		return options.MaxLiteralSize
+	}
+	return defaultMaxLiteralSize
+}
+
+func (options *Options) readTimeout() time.Duration {
+	if options.ReadTimeout > 0 {
+		return options.ReadTimeout
+	}
+	return defaultReadTimeout
+}
+
+func (options *Options) idleTimeout() time.Duration {
+	if options.IdleTimeout > 0 {
+		return options.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+func (options *Options) writeTimeout() time.Duration {
+	if options.WriteTimeout > 0 {
+		return options.WriteTimeout
+	}
+	return defaultWriteTimeout
+}
+
+// remoteIP returns the IP address of the client, or an empty string if
+// unknown (e.g. for Unix sockets).
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// trackConn registers a new connection. It returns a BYE response if the
+// connection is rejected because a connection limit has been reached or the
+// server is shutting down, in which case the connection isn't registered.
+func (s *Server) trackConn(c *Conn) *imap.StatusResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return shutdownResp
+	}
+	if max := s.options.MaxConns; max > 0 && len(s.conns) >= max {
+		return tooManyConnsResp
+	}
+	if max := s.options.MaxConnsPerIP; max > 0 && c.remoteIP != "" {
+		if s.connsPerIP[c.remoteIP] >= max {
+			return tooManyConnsResp
+		}
+		s.connsPerIP[c.remoteIP]++
+	}
+	s.conns[c] = struct{}{}
+	s.connWaitGroup.Add(1)
+	return nil
+}
+
+// untrackConn unregisters a connection previously registered with trackConn.
+func (s *Server) untrackConn(c *Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.conns, c)
+	if s.options.MaxConnsPerIP > 0 && c.remoteIP != "" {
+		decrementConnCount(s.connsPerIP, c.remoteIP)
+	}
+	if c.username != "" {
+		decrementConnCount(s.connsPerUser, c.username)
+	}
+	s.connWaitGroup.Done()
+}
+
+// trackUser records that a connection has been authenticated as a user. It
+// returns false if the per-user connection limit has been reached.
+func (s *Server) trackUser(c *Conn, username string) bool {
+	max := s.options.MaxConnsPerUser
+	if max <= 0 {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.connsPerUser[username] >= max {
+		return false
+	}
+	s.connsPerUser[username]++
+	c.username = username
+	return true
+}
+
+func decrementConnCount(m map[string]int, k string) {
+	if m[k] <= 1 {
+		delete(m, k)
+	} else {
+		m[k]--
+	}
+}
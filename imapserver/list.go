@@ -1,15 +1,16 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
-	"github.com/emersion/go-imap/v2/internal/utf7"
 )
 
-func (c *Conn) handleList(dec *imapwire.Decoder) error {
+func (c *Conn) handleList(ctx context.Context, dec *imapwire.Decoder) error {
 	ref, pattern, options, err := readListCmd(dec)
 	if err != nil {
 		return err
@@ -23,10 +24,10 @@ func (c *Conn) handleList(dec *imapwire.Decoder) error {
 		conn:    c,
 		options: options,
 	}
-	return c.session.List(w, ref, pattern, options)
+	return c.commandSession(ctx).List(w, ref, pattern, options)
 }
 
-func (c *Conn) handleLSub(dec *imapwire.Decoder) error {
+func (c *Conn) handleLSub(ctx context.Context, dec *imapwire.Decoder) error {
 	var ref string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&ref) || !dec.ExpectSP() {
 		return dec.Err()
@@ -48,7 +49,7 @@ func (c *Conn) handleLSub(dec *imapwire.Decoder) error {
 		conn: c,
 		lsub: true,
 	}
-	return c.session.List(w, ref, []string{pattern}, options)
+	return c.commandSession(ctx).List(w, ref, []string{pattern}, options)
 }
 
 func (c *Conn) writeList(data *imap.ListData) error {
@@ -204,7 +205,7 @@ func readListMailbox(dec *imapwire.Decoder) (string, error) {
 			return "", dec.Err()
 		}
 	}
-	return utf7.Encoding.NewDecoder().String(mailbox)
+	return dec.DecodeMailbox(mailbox)
 }
 
 func isListChar(ch byte) bool {
@@ -252,10 +253,16 @@ type ListWriter struct {
 	conn    *Conn
 	options *imap.ListOptions
 	lsub    bool
+	// if non-nil, LIST data is handed to collect instead of being written
+	collect func(data *imap.ListData)
 }
 
 // WriteList writes a single LIST response for a mailbox.
 func (w *ListWriter) WriteList(data *imap.ListData) error {
+	if w.collect != nil {
+		w.collect(data)
+		return nil
+	}
 	if w.lsub {
 		return w.conn.writeLSub(data)
 	}
@@ -273,57 +280,5 @@ func (w *ListWriter) WriteList(data *imap.ListData) error {
 
 // MatchList checks whether a reference and a pattern matches a mailbox.
 func MatchList(name string, delim rune, reference, pattern string) bool {
-	var delimStr string
-	if delim != 0 {
-		delimStr = string(delim)
-	}
-
-	if delimStr != "" && strings.HasPrefix(pattern, delimStr) {
-		reference = ""
-		pattern = strings.TrimPrefix(pattern, delimStr)
-	}
-	if reference != "" {
-		if delimStr != "" && !strings.HasSuffix(reference, delimStr) {
-			reference += delimStr
-		}
-		if !strings.HasPrefix(name, reference) {
-			return false
-		}
-		name = strings.TrimPrefix(name, reference)
-	}
-
-	return matchList(name, delimStr, pattern)
-}
-
-func matchList(name, delim, pattern string) bool {
-	// TODO: optimize
-
-	i := strings.IndexAny(pattern, "*%")
-	if i == -1 {
-		// No more wildcards
-		return name == pattern
-	}
-
-	// Get parts before and after wildcard
-	chunk, wildcard, rest := pattern[0:i], pattern[i], pattern[i+1:]
-
-	// Check that name begins with chunk
-	if len(chunk) > 0 && !strings.HasPrefix(name, chunk) {
-		return false
-	}
-	name = strings.TrimPrefix(name, chunk)
-
-	// Expand wildcard
-	var j int
-	for j = 0; j < len(name); j++ {
-		if wildcard == '%' && string(name[j]) == delim {
-			break // Stop on delimiter if wildcard is %
-		}
-		// Try to match the rest from here
-		if matchList(name[j:], delim, rest) {
-			return true
-		}
-	}
-
-	return matchList(name[j:], delim, rest)
+	return internal.MatchList(name, delim, reference, pattern)
 }
@@ -1,11 +1,13 @@
 package imapserver
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleLogin(tag string, dec *imapwire.Decoder) error {
+func (c *Conn) handleLogin(ctx context.Context, tag string, dec *imapwire.Decoder) error {
 	var username, password string
 	if !dec.ExpectSP() || !dec.ExpectAString(&username) || !dec.ExpectSP() || !dec.ExpectAString(&password) || !dec.ExpectCRLF() {
 		return dec.Err()
@@ -20,9 +22,13 @@ func (c *Conn) handleLogin(tag string, dec *imapwire.Decoder) error {
 			Text: "TLS is required to authenticate",
 		}
 	}
-	if err := c.session.Login(username, password); err != nil {
+	if err := c.commandSession(ctx).Login(username, password); err != nil {
 		return err
 	}
+	if !c.server.trackUser(c, username) {
+		c.state = imap.ConnStateLogout
+		return c.writeStatusResp("", tooManyUserConnsResp)
+	}
 	c.state = imap.ConnStateAuthenticated
 	return c.writeCapabilityOK(tag, "Logged in")
 }
@@ -0,0 +1,287 @@
+package imapserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// ErrMetadataTooMany is returned by SessionMetadata.SetMetadata when the
+// maximum number of entries would be exceeded.
+var ErrMetadataTooMany = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: "METADATA " + imap.ResponseCodeTooMany,
+	Text: "Too many metadata entries",
+}
+
+// NewMetadataMaxSizeError returns an error which can be returned by
+// SessionMetadata.SetMetadata when an entry value exceeds the maximum size
+// supported by the server.
+func NewMetadataMaxSizeError(maxSize uint32) error {
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCode(fmt.Sprintf("METADATA MAXSIZE %v", maxSize)),
+		Text: "Metadata entry value is too large",
+	}
+}
+
+func (c *Conn) handleGetMetadata(ctx context.Context, tag string, dec *imapwire.Decoder) error {
+	var (
+		mailbox string
+		options imap.GetMetadataOptions
+	)
+
+	// RFC 5464 is inconsistent regarding the position of the options: the
+	// formal syntax puts them before the mailbox, the examples after
+	if !dec.ExpectSP() {
+		return dec.Err()
+	}
+	isList, err := dec.List(func() error {
+		return readGetMetadataOption(dec, &options)
+	})
+	if err != nil {
+		return fmt.Errorf("in getmetadata-options: %w", err)
+	} else if isList && !dec.ExpectSP() {
+		return dec.Err()
+	}
+	if !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	entries, isOptions, err := readMetadataEntries(dec, &options)
+	if err != nil {
+		return err
+	} else if isOptions {
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		entries, _, err = readMetadataEntries(dec, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	session, err := c.metadataSession(ctx, mailbox)
+	if err != nil {
+		return err
+	}
+
+	data, err := session.GetMetadata(mailbox, entries, &options)
+	if err != nil {
+		return err
+	}
+
+	var longEntries uint32
+	if options.MaxSize != nil {
+		for name, value := range data.EntryValues {
+			if value == nil || uint32(len(*value)) <= *options.MaxSize {
+				continue
+			}
+			if uint32(len(*value)) > longEntries {
+				longEntries = uint32(len(*value))
+			}
+			delete(data.EntryValues, name)
+		}
+	}
+
+	if len(data.EntryValues) > 0 {
+		if err := c.writeMetadata(mailbox, data.EntryValues); err != nil {
+			return err
+		}
+	}
+
+	if err := c.poll(ctx, "GETMETADATA"); err != nil {
+		return err
+	}
+
+	resp := &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Text: "GETMETADATA completed",
+	}
+	if longEntries > 0 {
+		resp.Code = imap.ResponseCode(fmt.Sprintf("METADATA LONGENTRIES %v", longEntries))
+	}
+	return c.writeStatusResp(tag, resp)
+}
+
+func (c *Conn) handleSetMetadata(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	entries := make(map[string]*[]byte)
+	err := dec.ExpectList(func() error {
+		var name string
+		if !dec.ExpectAString(&name) || !dec.ExpectSP() {
+			return dec.Err()
+		}
+		if err := checkMetadataEntry(name, false); err != nil {
+			return err
+		}
+
+		var (
+			value *[]byte
+			s     string
+		)
+		if dec.String(&s) {
+			b := []byte(s)
+			value = &b
+		} else if !dec.ExpectNIL() {
+			return dec.Err()
+		}
+		entries[name] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	session, err := c.metadataSession(ctx, mailbox)
+	if err != nil {
+		return err
+	}
+
+	return session.SetMetadata(mailbox, entries)
+}
+
+func (c *Conn) metadataSession(ctx context.Context, mailbox string) (SessionMetadata, error) {
+	session, ok := c.commandSession(ctx).(SessionMetadata)
+	if !ok {
+		return nil, newClientBugError("METADATA is not supported")
+	}
+	if mailbox != "" && !c.server.options.caps().Has(imap.CapMetadata) {
+		return nil, newClientBugError("Only server metadata is supported")
+	}
+	return session, nil
+}
+
+func (c *Conn) writeMetadata(mailbox string, values map[string]*[]byte) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enc.Atom("*").SP().Atom("METADATA").SP().Mailbox(mailbox).SP()
+	enc.List(len(names), func(i int) {
+		enc.String(names[i]).SP()
+		if value := values[names[i]]; value != nil {
+			enc.String(string(*value))
+		} else {
+			enc.NIL()
+		}
+	})
+	return enc.CRLF()
+}
+
+// readMetadataEntries reads either a single entry name or a list of entry
+// names. If options is non-nil and a list of GETMETADATA options is found
+// instead, the options are populated and isOptions is set.
+func readMetadataEntries(dec *imapwire.Decoder, options *imap.GetMetadataOptions) (entries []string, isOptions bool, err error) {
+	isList, err := dec.List(func() error {
+		var name string
+		if !dec.ExpectAString(&name) {
+			return dec.Err()
+		}
+		if !strings.HasPrefix(name, "/") && options != nil && (isOptions || len(entries) == 0) {
+			isOptions = true
+			return readGetMetadataOptionWithName(dec, options, name)
+		}
+		if isOptions {
+			return newClientBugError("Unexpected metadata entry in GETMETADATA options")
+		}
+		if err := checkMetadataEntry(name, true); err != nil {
+			return err
+		}
+		entries = append(entries, name)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	} else if isList {
+		return entries, isOptions, nil
+	}
+
+	var name string
+	if !dec.ExpectAString(&name) {
+		return nil, false, dec.Err()
+	}
+	if err := checkMetadataEntry(name, true); err != nil {
+		return nil, false, err
+	}
+	return []string{name}, false, nil
+}
+
+func readGetMetadataOption(dec *imapwire.Decoder, options *imap.GetMetadataOptions) error {
+	var name string
+	if !dec.ExpectAtom(&name) {
+		return dec.Err()
+	}
+	return readGetMetadataOptionWithName(dec, options, name)
+}
+
+func readGetMetadataOptionWithName(dec *imapwire.Decoder, options *imap.GetMetadataOptions, name string) error {
+	if !dec.ExpectSP() {
+		return dec.Err()
+	}
+	switch strings.ToUpper(name) {
+	case "MAXSIZE":
+		var maxSize uint32
+		if !dec.ExpectNumber(&maxSize) {
+			return dec.Err()
+		}
+		options.MaxSize = &maxSize
+	case "DEPTH":
+		var depth string
+		if !dec.ExpectAtom(&depth) {
+			return dec.Err()
+		}
+		switch strings.ToLower(depth) {
+		case "0":
+			options.Depth = imap.GetMetadataDepthZero
+		case "1":
+			options.Depth = imap.GetMetadataDepthOne
+		case "infinity":
+			options.Depth = imap.GetMetadataDepthInfinity
+		default:
+			return newClientBugError("Invalid GETMETADATA depth")
+		}
+	default:
+		return newClientBugError("Unknown GETMETADATA option")
+	}
+	return nil
+}
+
+// checkMetadataEntry checks that an entry name is valid, as defined in
+// RFC 5464 section 3.2. If allowRoot is set, the /private and /shared
+// hierarchy roots are accepted as well.
+func checkMetadataEntry(name string, allowRoot bool) error {
+	lower := strings.ToLower(name)
+	switch {
+	case allowRoot && (lower == "/private" || lower == "/shared"):
+		return nil
+	case !strings.HasPrefix(lower, "/private/") && !strings.HasPrefix(lower, "/shared/"):
+		return newClientBugError("Metadata entry names must start with /private/ or /shared/")
+	case strings.ContainsAny(name, "*%"), strings.Contains(name, "//"), strings.HasSuffix(name, "/"):
+		return newClientBugError("Invalid metadata entry name")
+	}
+	return nil
+}
@@ -1,24 +1,33 @@
 package imapserver
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleMove(dec *imapwire.Decoder, numKind NumKind) error {
-	seqSet, dest, err := readCopy(dec)
+func (c *Conn) handleMove(ctx context.Context, dec *imapwire.Decoder, numKind NumKind) error {
+	numSet, dest, err := readCopy(dec)
 	if err != nil {
 		return err
 	}
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
-	session, ok := c.session.(SessionMove)
+	session, ok := c.commandSession(ctx).(SessionMove)
 	if !ok {
 		return newClientBugError("MOVE is not supported")
 	}
-	w := &MoveWriter{conn: c}
-	return session.Move(w, numKind, seqSet, dest)
+	seqSet, numKind := c.resolveSearchRes(numSet, numKind)
+	if len(seqSet) == 0 {
+		return nil
+	}
+	w := &MoveWriter{conn: c, expunge: ExpungeWriter{conn: c}}
+	if err := session.Move(w, numKind, seqSet, dest); err != nil {
+		return err
+	}
+	return w.expunge.flush()
 }
 
 // MoveWriter writes responses for the MOVE command.
@@ -26,7 +35,8 @@ func (c *Conn) handleMove(dec *imapwire.Decoder, numKind NumKind) error {
 // Servers must first call WriteCopyData once, then call WriteExpunge any
 // number of times.
 type MoveWriter struct {
-	conn *Conn
+	conn    *Conn
+	expunge ExpungeWriter
 }
 
 // WriteCopyData writes the untagged COPYUID response for a MOVE command.
@@ -35,6 +45,14 @@ func (w *MoveWriter) WriteCopyData(data *imap.CopyData) error {
 }
 
 // WriteExpunge writes an EXPUNGE response for a MOVE command.
+//
+// If the client has enabled QRESYNC, WriteExpungeUID must be used instead.
 func (w *MoveWriter) WriteExpunge(seqNum uint32) error {
-	return w.conn.writeExpunge(seqNum)
+	return w.expunge.WriteExpunge(seqNum)
+}
+
+// WriteExpungeUID is like WriteExpunge, but also provides the UID of the
+// moved message. See ExpungeWriter.WriteExpungeUID.
+func (w *MoveWriter) WriteExpungeUID(seqNum, uid uint32) error {
+	return w.expunge.WriteExpungeUID(seqNum, uid)
 }
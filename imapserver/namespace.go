@@ -1,11 +1,13 @@
 package imapserver
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleNamespace(dec *imapwire.Decoder) error {
+func (c *Conn) handleNamespace(ctx context.Context, dec *imapwire.Decoder) error {
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
@@ -14,7 +16,7 @@ func (c *Conn) handleNamespace(dec *imapwire.Decoder) error {
 		return err
 	}
 
-	session, ok := c.session.(SessionNamespace)
+	session, ok := c.commandSession(ctx).(SessionNamespace)
 	if !ok {
 		return newClientBugError("NAMESPACE is not supported")
 	}
@@ -0,0 +1,477 @@
+package imapserver
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+var notifyEvents = []imap.NotifyEvent{
+	imap.NotifyEventMessageNew,
+	imap.NotifyEventMessageExpunge,
+	imap.NotifyEventFlagChange,
+	imap.NotifyEventMailboxName,
+	imap.NotifyEventSubscriptionChange,
+}
+
+func (c *Conn) handleNotify(ctx context.Context, dec *imapwire.Decoder) error {
+	var action string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&action) {
+		return dec.Err()
+	}
+
+	var options *imap.NotifyOptions
+	switch strings.ToUpper(action) {
+	case "NONE":
+		// options is nil
+	case "SET":
+		options = new(imap.NotifyOptions)
+		if err := readNotifySet(dec, options); err != nil {
+			return err
+		}
+	default:
+		return newClientBugError("Unknown NOTIFY action")
+	}
+
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	session, ok := c.commandSession(ctx).(SessionNotify)
+	if !ok || !c.server.options.caps().Has(imap.CapNotify) {
+		return newClientBugError("NOTIFY is not supported")
+	}
+
+	c.stopNotify()
+	if options == nil {
+		return nil
+	}
+	return c.startNotify(session, options)
+}
+
+func readNotifySet(dec *imapwire.Decoder, options *imap.NotifyOptions) error {
+	if !dec.ExpectSP() {
+		return dec.Err()
+	}
+
+	var atom string
+	if dec.Atom(&atom) {
+		if !strings.EqualFold(atom, "STATUS") {
+			return newClientBugError("Expected STATUS or event group")
+		}
+		options.Status = true
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+	}
+
+	for {
+		var group imap.NotifyEventGroup
+		if err := readNotifyEventGroup(dec, &group); err != nil {
+			return err
+		}
+		options.EventGroups = append(options.EventGroups, group)
+
+		if !dec.SP() {
+			break
+		}
+	}
+	return nil
+}
+
+func readNotifyEventGroup(dec *imapwire.Decoder, group *imap.NotifyEventGroup) error {
+	var filter string
+	if !dec.ExpectSpecial('(') || !dec.ExpectAtom(&filter) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+
+	group.Filter = imap.NotifyFilter(strings.ToUpper(filter))
+	switch group.Filter {
+	case imap.NotifyFilterSelected, imap.NotifyFilterSelectedDelayed, imap.NotifyFilterInboxes, imap.NotifyFilterPersonal, imap.NotifyFilterSubscribed:
+		// no mailbox argument
+	case imap.NotifyFilterSubtree, imap.NotifyFilterMailboxes:
+		readMailbox := func() error {
+			var name string
+			if !dec.ExpectMailbox(&name) {
+				return dec.Err()
+			}
+			group.Mailboxes = append(group.Mailboxes, name)
+			return nil
+		}
+		isList, err := dec.List(readMailbox)
+		if err != nil {
+			return err
+		} else if !isList {
+			if err := readMailbox(); err != nil {
+				return err
+			}
+		}
+		if len(group.Mailboxes) == 0 {
+			return newClientBugError("Expected at least one mailbox")
+		}
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+	default:
+		return newClientBugError("Unknown NOTIFY filter")
+	}
+
+	var badEvent bool
+	var none string
+	if dec.Atom(&none) {
+		if !strings.EqualFold(none, "NONE") {
+			return newClientBugError("Expected NONE or event list")
+		}
+	} else {
+		err := dec.ExpectList(func() error {
+			if dec.Special('(') {
+				return &imap.Error{
+					Type: imap.StatusResponseTypeNo,
+					Text: "MessageNew fetch attributes are not supported",
+				}
+			}
+
+			var name string
+			if !dec.ExpectAtom(&name) {
+				return dec.Err()
+			}
+			for _, event := range notifyEvents {
+				if strings.EqualFold(name, string(event)) {
+					group.Events = append(group.Events, event)
+					return nil
+				}
+			}
+			badEvent = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !dec.ExpectSpecial(')') {
+		return dec.Err()
+	}
+
+	if badEvent {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeBadEvent,
+			Text: "Unsupported NOTIFY event",
+		}
+	}
+	return checkNotifyEventGroup(group)
+}
+
+func checkNotifyEventGroup(group *imap.NotifyEventGroup) error {
+	messageNew := hasNotifyEvent(group.Events, imap.NotifyEventMessageNew)
+	messageExpunge := hasNotifyEvent(group.Events, imap.NotifyEventMessageExpunge)
+	if messageNew != messageExpunge {
+		return newClientBugError("MessageNew and MessageExpunge must be specified together")
+	}
+	if hasNotifyEvent(group.Events, imap.NotifyEventFlagChange) && !messageNew {
+		return newClientBugError("FlagChange requires MessageNew and MessageExpunge")
+	}
+
+	switch group.Filter {
+	case imap.NotifyFilterSelected, imap.NotifyFilterSelectedDelayed:
+		if hasNotifyEvent(group.Events, imap.NotifyEventMailboxName) || hasNotifyEvent(group.Events, imap.NotifyEventSubscriptionChange) {
+			return newClientBugError("Mailbox events cannot be requested for the selected mailbox")
+		}
+	}
+	return nil
+}
+
+func hasNotifyEvent(events []imap.NotifyEvent, event imap.NotifyEvent) bool {
+	for _, ev := range events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedNotifyGroup returns the NOTIFY event group which applies to the
+// selected mailbox, or nil if there is none.
+func (c *Conn) selectedNotifyGroup() *imap.NotifyEventGroup {
+	if c.notifier == nil {
+		return nil
+	}
+	for i, group := range c.notifier.groups {
+		switch group.Filter {
+		case imap.NotifyFilterSelected, imap.NotifyFilterSelectedDelayed:
+			return &c.notifier.groups[i]
+		}
+	}
+	return nil
+}
+
+// wantsSelectedUpdate checks whether an update for the selected mailbox can be
+// sent to a client which has requested the specified NOTIFY event group.
+func wantsSelectedUpdate(group *imap.NotifyEventGroup, update *trackerUpdate) bool {
+	if group == nil {
+		return true
+	}
+	switch {
+	case update.expunge != 0:
+		// SELECTED-DELAYED postpones expunges until the next command
+		return group.Filter == imap.NotifyFilterSelected && hasNotifyEvent(group.Events, imap.NotifyEventMessageExpunge)
+	case update.numMessages != 0:
+		return hasNotifyEvent(group.Events, imap.NotifyEventMessageNew)
+	case update.fetch != nil:
+		return hasNotifyEvent(group.Events, imap.NotifyEventFlagChange)
+	default:
+		return true
+	}
+}
+
+// notifier delivers the mailbox-level updates requested with NOTIFY.
+//
+// Updates for the selected mailbox are delivered as usual via the mailbox
+// tracker, the notifier only takes care of the other mailboxes.
+type notifier struct {
+	conn    *Conn
+	groups  []imap.NotifyEventGroup
+	tracker *UserSessionTracker
+	stop    chan struct{}
+	done    chan struct{}
+
+	// only accessed by the delivery goroutine once started
+	delim      rune
+	subscribed map[string]struct{}
+}
+
+func (c *Conn) startNotify(session SessionNotify, options *imap.NotifyOptions) error {
+	n := &notifier{
+		conn:       c,
+		groups:     options.EventGroups,
+		subscribed: make(map[string]struct{}),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	// Register the tracker before listing mailboxes, to make sure no update
+	// is missed
+	n.tracker = session.UserTracker().NewSession()
+
+	var mailboxes []imap.ListData
+	listOptions := &imap.ListOptions{ReturnSubscribed: true}
+	w := &ListWriter{
+		conn:    c,
+		options: listOptions,
+		collect: func(data *imap.ListData) {
+			mailboxes = append(mailboxes, *data)
+		},
+	}
+	if err := session.List(w, "", []string{"*"}, listOptions); err != nil {
+		n.tracker.Close()
+		return err
+	}
+	for _, data := range mailboxes {
+		if data.Delim != 0 {
+			n.delim = data.Delim
+		}
+		if hasMailboxAttr(data.Attrs, imap.MailboxAttrSubscribed) {
+			n.subscribed[data.Mailbox] = struct{}{}
+		}
+	}
+
+	if options.Status {
+		items := []imap.StatusItem{
+			imap.StatusItemNumMessages,
+			imap.StatusItemUIDNext,
+			imap.StatusItemUIDValidity,
+			imap.StatusItemNumUnseen,
+		}
+		if c.condStoreEnabled() {
+			items = append(items, imap.StatusItemHighestModSeq)
+		}
+
+		selected := c.selectedMailbox()
+		for _, data := range mailboxes {
+			if data.Mailbox == selected || hasMailboxAttr(data.Attrs, imap.MailboxAttrNoSelect) || hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+				continue
+			}
+			if !n.wants(data.Mailbox, imap.NotifyEventMessageNew) {
+				continue
+			}
+			status, err := session.Status(data.Mailbox, items)
+			if err != nil {
+				n.tracker.Close()
+				return err
+			}
+			if err := c.writeStatus(status, items); err != nil {
+				n.tracker.Close()
+				return err
+			}
+		}
+	}
+
+	c.notifier = n
+	go n.run()
+	return nil
+}
+
+// stopNotify stops delivering mailbox-level updates.
+func (c *Conn) stopNotify() {
+	if c.notifier == nil {
+		return
+	}
+	close(c.notifier.stop)
+	<-c.notifier.done
+	c.notifier = nil
+}
+
+func (n *notifier) run() {
+	defer close(n.done)
+	defer n.tracker.Close()
+	defer func() {
+		if v := recover(); v != nil {
+			n.conn.server.logger().Printf("panic delivering notifications: %v\n%s", v, debug.Stack())
+		}
+	}()
+
+	for {
+		select {
+		case <-n.tracker.updates:
+			updates, overflow := n.tracker.poll()
+			for i := range updates {
+				if err := n.deliver(&updates[i]); err != nil {
+					return
+				}
+			}
+			if overflow {
+				// Notifications are disabled, as if NOTIFY NONE was sent
+				n.conn.writeStatusResp("", &imap.StatusResponse{
+					Type: imap.StatusResponseTypeOK,
+					Code: imap.ResponseCodeNotificationOverflow,
+					Text: "Too many pending notifications",
+				})
+				return
+			}
+		case <-n.stop:
+			return
+		case <-n.conn.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *notifier) deliver(update *userTrackerUpdate) error {
+	switch update.event {
+	case imap.NotifyEventMailboxName:
+		data := update.list
+		send := n.wants(data.Mailbox, update.event) || (data.OldName != "" && n.wants(data.OldName, update.event))
+		if data.OldName != "" {
+			if _, ok := n.subscribed[data.OldName]; ok {
+				delete(n.subscribed, data.OldName)
+				n.subscribed[data.Mailbox] = struct{}{}
+			}
+		} else if hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+			delete(n.subscribed, data.Mailbox)
+		}
+		send = send || n.wants(data.Mailbox, update.event)
+		if !send {
+			return nil
+		}
+		return n.conn.writeList(data)
+	case imap.NotifyEventSubscriptionChange:
+		data := update.list
+		send := n.wants(data.Mailbox, update.event)
+		if hasMailboxAttr(data.Attrs, imap.MailboxAttrSubscribed) {
+			n.subscribed[data.Mailbox] = struct{}{}
+		} else {
+			delete(n.subscribed, data.Mailbox)
+		}
+		send = send || n.wants(data.Mailbox, update.event)
+		if !send {
+			return nil
+		}
+		return n.conn.writeList(data)
+	default:
+		data := update.status
+		if data.Mailbox == n.conn.selectedMailbox() || !n.wants(data.Mailbox, update.event) {
+			return nil
+		}
+		return n.conn.writeStatus(data, n.statusItems(data))
+	}
+}
+
+// wants checks whether the client wants to be notified about an event for a
+// mailbox other than the selected one. The first event group matching the
+// mailbox applies.
+func (n *notifier) wants(mailbox string, event imap.NotifyEvent) bool {
+	for _, group := range n.groups {
+		if n.match(&group, mailbox) {
+			return hasNotifyEvent(group.Events, event)
+		}
+	}
+	return false
+}
+
+func (n *notifier) match(group *imap.NotifyEventGroup, mailbox string) bool {
+	switch group.Filter {
+	case imap.NotifyFilterInboxes:
+		return strings.EqualFold(mailbox, "INBOX")
+	case imap.NotifyFilterPersonal:
+		return true
+	case imap.NotifyFilterSubscribed:
+		_, ok := n.subscribed[mailbox]
+		return ok
+	case imap.NotifyFilterSubtree:
+		for _, name := range group.Mailboxes {
+			if mailbox == name || (n.delim != 0 && strings.HasPrefix(mailbox, name+string(n.delim))) {
+				return true
+			}
+		}
+		return false
+	case imap.NotifyFilterMailboxes:
+		for _, name := range group.Mailboxes {
+			if mailbox == name || (strings.EqualFold(name, "INBOX") && strings.EqualFold(mailbox, "INBOX")) {
+				return true
+			}
+		}
+		return false
+	case imap.NotifyFilterSelected, imap.NotifyFilterSelectedDelayed:
+		return false
+	default:
+		panic(fmt.Errorf("imapserver: unknown NOTIFY filter %v", group.Filter))
+	}
+}
+
+// statusItems returns the STATUS items populated by the backend.
+func (n *notifier) statusItems(data *imap.StatusData) []imap.StatusItem {
+	var items []imap.StatusItem
+	if data.NumMessages != nil {
+		items = append(items, imap.StatusItemNumMessages)
+	}
+	if data.UIDNext != 0 {
+		items = append(items, imap.StatusItemUIDNext)
+	}
+	if data.UIDValidity != 0 {
+		items = append(items, imap.StatusItemUIDValidity)
+	}
+	if data.NumUnseen != nil {
+		items = append(items, imap.StatusItemNumUnseen)
+	}
+	if data.HighestModSeq != 0 && n.conn.condStoreEnabled() {
+		items = append(items, imap.StatusItemHighestModSeq)
+	}
+	return items
+}
+
+func hasMailboxAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package imapserver
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleGetQuota(ctx context.Context, dec *imapwire.Decoder) error {
+	var root string
+	if !dec.ExpectSP() || !dec.ExpectAString(&root) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.commandSession(ctx).(SessionQuota)
+	if !ok {
+		return newClientBugError("QUOTA is not supported")
+	}
+
+	data, err := session.GetQuota(root)
+	if err != nil {
+		return err
+	}
+
+	return c.writeQuota(data)
+}
+
+func (c *Conn) handleGetQuotaRoot(ctx context.Context, dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.commandSession(ctx).(SessionQuota)
+	if !ok {
+		return newClientBugError("QUOTA is not supported")
+	}
+
+	l, err := session.GetQuotaRoot(mailbox)
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeQuotaRoot(mailbox, l); err != nil {
+		return err
+	}
+	for i := range l {
+		if err := c.writeQuota(&l[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) handleSetQuota(ctx context.Context, dec *imapwire.Decoder) error {
+	var root string
+	if !dec.ExpectSP() || !dec.ExpectAString(&root) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	limits := make(map[imap.QuotaResourceType]int64)
+	err := dec.ExpectList(func() error {
+		var (
+			name  string
+			limit int64
+		)
+		if !dec.ExpectAtom(&name) || !dec.ExpectSP() || !dec.ExpectNumber64(&limit) {
+			return dec.Err()
+		}
+		limits[imap.QuotaResourceType(strings.ToUpper(name))] = limit
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.commandSession(ctx).(SessionQuotaSet)
+	if !ok {
+		return newClientBugError("SETQUOTA is not supported")
+	}
+
+	supported := make(map[imap.QuotaResourceType]bool)
+	for _, typ := range session.QuotaResourceTypes() {
+		supported[typ] = true
+	}
+	for typ := range limits {
+		if !supported[typ] {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Text: "Unsupported quota resource type: " + string(typ),
+			}
+		}
+	}
+
+	data, err := session.SetQuota(root, limits)
+	if err != nil {
+		return err
+	} else if data == nil {
+		return nil
+	}
+
+	return c.writeQuota(data)
+}
+
+func (c *Conn) writeQuota(data *imap.QuotaData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	types := make([]imap.QuotaResourceType, 0, len(data.Resources))
+	for typ := range data.Resources {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	enc.Atom("*").SP().Atom("QUOTA").SP().String(data.Root).SP()
+	enc.List(len(types), func(i int) {
+		res := data.Resources[types[i]]
+		enc.Atom(string(types[i])).SP().Number64(res.Usage).SP().Number64(res.Limit)
+	})
+	return enc.CRLF()
+}
+
+func (c *Conn) writeQuotaRoot(mailbox string, l []imap.QuotaData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("QUOTAROOT").SP().Mailbox(mailbox)
+	for _, data := range l {
+		enc.SP().String(data.Root)
+	}
+	return enc.CRLF()
+}
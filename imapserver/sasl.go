@@ -0,0 +1,256 @@
+package imapserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/scram"
+)
+
+// XOAUTH2 is the name of the XOAUTH2 SASL mechanism.
+const XOAUTH2 = "XOAUTH2"
+
+// SCRAMCredentials contains the credentials stored by the server for the
+// SCRAM authentication mechanisms, as defined in RFC 5802 section 3.
+//
+// Servers don't need to store passwords: the salted keys are enough to
+// authenticate users.
+type SCRAMCredentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewSCRAMCredentials derives SCRAM credentials from a password. mech is
+// either "SCRAM-SHA-1" or "SCRAM-SHA-256".
+//
+// The salt should be random and at least 16 bytes long. RFC 7677 recommends
+// at least 4096 iterations.
+func NewSCRAMCredentials(mech, password string, salt []byte, iterations int) (*SCRAMCredentials, error) {
+	m := scram.Lookup(mech)
+	if m == nil {
+		return nil, fmt.Errorf("imapserver: unsupported SCRAM mechanism %q", mech)
+	} else if iterations < 1 {
+		return nil, fmt.Errorf("imapserver: invalid SCRAM iteration count %v", iterations)
+	}
+	creds := m.NewCredentials(password, salt, iterations)
+	return (*SCRAMCredentials)(creds), nil
+}
+
+// authMechanisms returns the SASL mechanisms available for the connection.
+func (c *Conn) authMechanisms() []string {
+	if authSess, ok := c.session.(SessionSASL); ok {
+		return authSess.AuthenticateMechanisms()
+	}
+
+	var mechs []string
+	if _, ok := c.session.(SessionSCRAM); ok {
+		mechs = append(mechs, scram.SHA256.Name, scram.SHA1.Name)
+	}
+	if _, ok := c.session.(SessionOAuth); ok {
+		mechs = append(mechs, sasl.OAuthBearer, XOAUTH2)
+	}
+	if _, ok := c.session.(SessionExternal); ok && c.clientCert() != nil {
+		mechs = append(mechs, sasl.External)
+	}
+	return append(mechs, sasl.Plain)
+}
+
+// clientCert returns the verified TLS client certificate, if any.
+func (c *Conn) clientCert() *x509.Certificate {
+	tlsConn, ok := c.NetConn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// newSASLServer creates a SASL server for the specified mechanism. For the
+// built-in mechanisms, the name of the logged in user is stored in authUser.
+func (c *Conn) newSASLServer(ctx context.Context, mech string, authUser *string) (sasl.Server, error) {
+	if authSess, ok := c.commandSession(ctx).(SessionSASL); ok {
+		return authSess.Authenticate(mech)
+	}
+
+	supported := false
+	for _, m := range c.authMechanisms() {
+		if strings.EqualFold(m, mech) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "SASL mechanism not supported",
+		}
+	}
+
+	var saslServer sasl.Server
+	switch mech {
+	case sasl.Plain:
+		saslServer = sasl.NewPlainServer(func(identity, username, password string) error {
+			if identity != "" && identity != username {
+				return &imap.Error{
+					Type: imap.StatusResponseTypeNo,
+					Code: imap.ResponseCodeAuthorizationFailed,
+					Text: "SASL identity not supported",
+				}
+			}
+			if err := c.commandSession(ctx).Login(username, password); err != nil {
+				return err
+			}
+			*authUser = username
+			return nil
+		})
+	case scram.SHA1.Name, scram.SHA256.Name:
+		scramSess := c.commandSession(ctx).(SessionSCRAM)
+		saslServer = scram.NewServer(scram.Lookup(mech), func(username string) (*scram.Credentials, error) {
+			creds, err := scramSess.SCRAMCredentials(mech, username)
+			if err != nil {
+				return nil, err
+			}
+			return (*scram.Credentials)(creds), nil
+		}, func(username string) error {
+			if err := scramSess.LoginSCRAM(username); err != nil {
+				return err
+			}
+			*authUser = username
+			return nil
+		})
+	case sasl.OAuthBearer:
+		oauthSess := c.commandSession(ctx).(SessionOAuth)
+		saslServer = sasl.NewOAuthBearerServer(func(options sasl.OAuthBearerOptions) *sasl.OAuthBearerError {
+			username, err := oauthSess.LoginOAuth(options.Username, options.Token)
+			if err != nil {
+				return oauthBearerError(err)
+			}
+			*authUser = username
+			return nil
+		})
+	case XOAUTH2:
+		oauthSess := c.commandSession(ctx).(SessionOAuth)
+		saslServer = &xoauth2Server{authenticate: func(username, token string) error {
+			username, err := oauthSess.LoginOAuth(username, token)
+			if err != nil {
+				return err
+			}
+			*authUser = username
+			return nil
+		}}
+	case sasl.External:
+		extSess := c.commandSession(ctx).(SessionExternal)
+		saslServer = sasl.NewExternalServer(func(identity string) error {
+			cert := c.clientCert()
+			if cert == nil {
+				return errAuthFailed
+			}
+			username, err := extSess.LoginExternal(identity, cert)
+			if err != nil {
+				return err
+			}
+			*authUser = username
+			return nil
+		})
+	default:
+		panic(fmt.Errorf("imapserver: unknown built-in SASL mechanism %v", mech))
+	}
+	return &authFailedServer{saslServer}, nil
+}
+
+// authFailedServer wraps a SASL server and turns errors which aren't IMAP
+// errors into authentication failures.
+type authFailedServer struct {
+	sasl.Server
+}
+
+func (s *authFailedServer) Next(response []byte) (challenge []byte, done bool, err error) {
+	challenge, done, err = s.Server.Next(response)
+	var imapErr *imap.Error
+	if err != nil && !errors.As(err, &imapErr) {
+		err = errAuthFailed
+	}
+	return challenge, done, err
+}
+
+func oauthBearerError(err error) *sasl.OAuthBearerError {
+	var bearerErr *sasl.OAuthBearerError
+	if errors.As(err, &bearerErr) {
+		return bearerErr
+	}
+	return &sasl.OAuthBearerError{
+		Status:  "invalid_token",
+		Schemes: "bearer",
+	}
+}
+
+// xoauth2Server implements the XOAUTH2 mechanism, as defined in:
+// https://developers.google.com/gmail/imap/xoauth2-protocol
+type xoauth2Server struct {
+	authenticate func(username, token string) error
+	done         bool
+	failErr      error
+}
+
+func (s *xoauth2Server) Next(response []byte) (challenge []byte, done bool, err error) {
+	// On failure, an error is sent as a challenge and the client is
+	// expected to reply with an empty response
+	if s.failErr != nil {
+		return nil, true, s.failErr
+	} else if s.done {
+		return nil, false, sasl.ErrUnexpectedClientResponse
+	}
+
+	if response == nil {
+		return []byte{}, false, nil
+	}
+	s.done = true
+
+	var username, token string
+	for _, field := range bytes.Split(response, []byte{0x01}) {
+		if len(field) == 0 {
+			continue
+		}
+		k, v, ok := strings.Cut(string(field), "=")
+		if !ok {
+			return nil, false, errors.New("malformed XOAUTH2 response")
+		}
+		switch k {
+		case "user":
+			username = v
+		case "auth":
+			const prefix = "bearer "
+			if !strings.HasPrefix(strings.ToLower(v), prefix) {
+				return nil, false, errors.New("unsupported XOAUTH2 token type")
+			}
+			token = v[len(prefix):]
+		}
+	}
+	if username == "" || token == "" {
+		return nil, false, errors.New("malformed XOAUTH2 response")
+	}
+
+	if err := s.authenticate(username, token); err != nil {
+		blob, jsonErr := json.Marshal(oauthBearerError(err))
+		if jsonErr != nil {
+			panic(jsonErr) // unreachable
+		}
+		s.failErr = err
+		return blob, false, nil
+	}
+	return nil, true, nil
+}
@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -10,12 +11,68 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind) error {
+func (c *Conn) handleSearch(ctx context.Context, tag string, dec *imapwire.Decoder, numKind NumKind) error {
+	criteria, options, extended, err := c.readSearch(dec)
+	if err != nil {
+		return err
+	}
+
+	// The SAVE return option is handled here, backends don't need to know
+	// about it
+	var save bool
+	if hasSearchReturnOpt(options.Return, imap.SearchReturnSave) {
+		save = true
+		var l []imap.SearchReturnOption
+		for _, opt := range options.Return {
+			if opt != imap.SearchReturnSave {
+				l = append(l, opt)
+			}
+		}
+		options.Return = l
+	}
+
+	if hasSearchModSeq(criteria) {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkState(imap.ConnStateSelected); err != nil {
+		return err
+	}
+
+	c.resolveSearchResCriteria(criteria)
+
+	data, err := c.commandSession(ctx).Search(numKind, criteria, options)
+	if err == nil && save {
+		err = c.saveSearchRes(ctx, numKind, criteria, options, data)
+	}
+	if err != nil {
+		if save {
+			// A failed SEARCH with SAVE resets the saved result
+			c.setSearchRes(nil)
+		}
+		return err
+	}
+
+	if save && len(options.Return) == 0 {
+		// No ESEARCH response is sent when SAVE is the only return option
+		return nil
+	} else if c.enabled.Has(imap.CapIMAP4rev2) || extended {
+		return c.writeESearch(tag, data, options)
+	} else {
+		return c.writeSearch(data.All, data.ModSeq)
+	}
+}
+
+// readSearch reads the arguments of a SEARCH command.
+func (c *Conn) readSearch(dec *imapwire.Decoder) (*imap.SearchCriteria, *imap.SearchOptions, bool, error) {
 	if !dec.ExpectSP() {
-		return dec.Err()
+		return nil, nil, false, dec.Err()
 	}
 	var (
 		atom     string
+		criteria imap.SearchCriteria
 		options  imap.SearchOptions
 		extended bool
 	)
@@ -23,70 +80,91 @@ func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind)
 		var err error
 		options.Return, err = readSearchReturnOpts(dec)
 		if err != nil {
-			return fmt.Errorf("in search-return-opts: %w", err)
+			return nil, nil, false, fmt.Errorf("in search-return-opts: %w", err)
 		}
 		if !dec.ExpectSP() {
-			return dec.Err()
+			return nil, nil, false, dec.Err()
 		}
 		extended = true
 		atom = ""
 		maybeReadSearchKeyAtom(dec, &atom)
 	}
 	if strings.EqualFold(atom, "CHARSET") {
+		if c.utf8AcceptEnabled() {
+			// RFC 6855 section 3
+			return nil, nil, false, newClientBugError("SEARCH CHARSET is not allowed once UTF8=ACCEPT is enabled")
+		}
 		var charset string
 		if !dec.ExpectSP() || !dec.ExpectAString(&charset) || !dec.ExpectSP() {
-			return dec.Err()
+			return nil, nil, false, dec.Err()
 		}
-		switch strings.ToUpper(charset) {
-		case "US-ASCII", "UTF-8":
-			// nothing to do
-		default:
-			return &imap.Error{
-				Type: imap.StatusResponseTypeNo,
-				Code: imap.ResponseCodeBadCharset, // TODO: return list of supported charsets
-				Text: "Only US-ASCII and UTF-8 are supported SEARCH charsets",
-			}
+		if err := checkSearchCharset(charset); err != nil {
+			return nil, nil, false, err
 		}
 		atom = ""
 		maybeReadSearchKeyAtom(dec, &atom)
 	}
 
-	var criteria imap.SearchCriteria
+	if err := readSearchKeys(&criteria, dec, atom); err != nil {
+		return nil, nil, false, err
+	}
+
+	if !dec.ExpectCRLF() {
+		return nil, nil, false, dec.Err()
+	}
+
+	return &criteria, &options, extended, nil
+}
+
+func checkSearchCharset(charset string) error {
+	switch strings.ToUpper(charset) {
+	case "US-ASCII", "UTF-8":
+		return nil
+	default:
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeBadCharset, // TODO: return list of supported charsets
+			Text: "Only US-ASCII and UTF-8 are supported SEARCH charsets",
+		}
+	}
+}
+
+// readSearchKeys reads one or more search keys separated by spaces. If atom
+// is non-empty, it's used as the already-consumed beginning of the first key.
+func readSearchKeys(criteria *imap.SearchCriteria, dec *imapwire.Decoder, atom string) error {
 	for {
 		var err error
 		if atom != "" {
-			err = readSearchKeyWithAtom(&criteria, dec, atom)
+			err = readSearchKeyWithAtom(criteria, dec, atom)
 			atom = ""
 		} else {
-			err = readSearchKey(&criteria, dec)
+			err = readSearchKey(criteria, dec)
 		}
 		if err != nil {
 			return fmt.Errorf("in search-key: %w", err)
 		}
 
 		if !dec.SP() {
-			break
+			return nil
 		}
 	}
+}
 
-	if !dec.ExpectCRLF() {
-		return dec.Err()
-	}
-
-	if err := c.checkState(imap.ConnStateSelected); err != nil {
-		return err
+func hasSearchModSeq(criteria *imap.SearchCriteria) bool {
+	if criteria.ModSeq != nil {
+		return true
 	}
-
-	data, err := c.session.Search(numKind, &criteria, &options)
-	if err != nil {
-		return err
+	for i := range criteria.Not {
+		if hasSearchModSeq(&criteria.Not[i]) {
+			return true
+		}
 	}
-
-	if c.enabled.Has(imap.CapIMAP4rev2) || extended {
-		return c.writeESearch(tag, data, &options)
-	} else {
-		return c.writeSearch(data.All)
+	for i := range criteria.Or {
+		if hasSearchModSeq(&criteria.Or[i][0]) || hasSearchModSeq(&criteria.Or[i][1]) {
+			return true
+		}
 	}
+	return false
 }
 
 func (c *Conn) writeESearch(tag string, data *imap.SearchData, options *imap.SearchOptions) error {
@@ -117,10 +195,13 @@ func (c *Conn) writeESearch(tag string, data *imap.SearchData, options *imap.Sea
 	if returnOpts[imap.SearchReturnCount] {
 		enc.SP().Atom("COUNT").SP().Number(data.Count)
 	}
+	if data.ModSeq > 0 {
+		enc.SP().Atom("MODSEQ").SP().ModSeq(data.ModSeq)
+	}
 	return enc.CRLF()
 }
 
-func (c *Conn) writeSearch(seqSet imap.SeqSet) error {
+func (c *Conn) writeSearch(seqSet imap.SeqSet, modSeq uint64) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 
@@ -133,6 +214,9 @@ func (c *Conn) writeSearch(seqSet imap.SeqSet) error {
 	for _, num := range nums {
 		enc.SP().Number(num)
 	}
+	if modSeq > 0 {
+		enc.SP().Special('(').Atom("MODSEQ").SP().ModSeq(modSeq).Special(')')
+	}
 	return enc.CRLF()
 }
 
@@ -147,7 +231,7 @@ func readSearchReturnOpts(dec *imapwire.Decoder) ([]imap.SearchReturnOption, err
 			return dec.Err()
 		}
 		switch opt := imap.SearchReturnOption(strings.ToUpper(name)); opt {
-		case imap.SearchReturnMin, imap.SearchReturnMax, imap.SearchReturnAll, imap.SearchReturnCount:
+		case imap.SearchReturnMin, imap.SearchReturnMax, imap.SearchReturnAll, imap.SearchReturnCount, imap.SearchReturnSave:
 			l = append(l, opt)
 		default:
 			return newClientBugError("unknown SEARCH RETURN option")
@@ -179,11 +263,16 @@ func readSearchKeyWithAtom(criteria *imap.SearchCriteria, dec *imapwire.Decoder,
 	case "ALL":
 		// nothing to do
 	case "UID":
-		var seqSet imap.SeqSet
-		if !dec.ExpectSP() || !dec.ExpectSeqSet(&seqSet) {
+		var numSet imap.NumSet
+		if !dec.ExpectSP() || !dec.ExpectNumSet(&numSet) {
 			return dec.Err()
 		}
-		criteria.UID = seqSet // TODO: intersect
+		switch numSet := numSet.(type) {
+		case imap.SeqSet:
+			criteria.UID = numSet // TODO: intersect
+		case imap.SearchRes:
+			criteria.SearchRes = true
+		}
 	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "RECENT", "SEEN":
 		criteria.Flag = append(criteria.Flag, searchKeyFlag(key))
 	case "UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNSEEN":
@@ -278,6 +367,26 @@ func readSearchKeyWithAtom(criteria *imap.SearchCriteria, dec *imapwire.Decoder,
 				criteria.Smaller = n
 			}
 		}
+	case "MODSEQ":
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		modSeq := imap.SearchCriteriaModSeq{}
+		if !dec.ModSeq(&modSeq.ModSeq) {
+			var typ string
+			if !dec.ExpectString(&modSeq.MetadataName) || !dec.ExpectSP() || !dec.ExpectAtom(&typ) || !dec.ExpectSP() || !dec.ExpectModSeq(&modSeq.ModSeq) {
+				return dec.Err()
+			}
+			switch t := imap.SearchCriteriaMetadataType(strings.ToLower(typ)); t {
+			case imap.SearchCriteriaMetadataAll, imap.SearchCriteriaMetadataPrivate, imap.SearchCriteriaMetadataShared:
+				modSeq.MetadataType = t
+			default:
+				return newClientBugError("Unknown MODSEQ entry type")
+			}
+		}
+		if criteria.ModSeq == nil || modSeq.ModSeq > criteria.ModSeq.ModSeq {
+			criteria.ModSeq = &modSeq
+		}
 	case "NOT":
 		if !dec.ExpectSP() {
 			return dec.Err()
@@ -302,6 +411,8 @@ func readSearchKeyWithAtom(criteria *imap.SearchCriteria, dec *imapwire.Decoder,
 			return nil
 		}
 		criteria.Or = append(criteria.Or, or)
+	case "$":
+		criteria.SearchRes = true
 	default:
 		seqSet, err := imap.ParseSeqSet(key)
 		if err != nil {
@@ -0,0 +1,128 @@
+package imapserver
+
+import (
+	"context"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// setSearchRes replaces the saved search result with a set of UIDs.
+func (c *Conn) setSearchRes(uids imap.SeqSet) {
+	c.mutex.Lock()
+	c.searchRes = uids
+	c.mutex.Unlock()
+}
+
+func (c *Conn) loadSearchRes() imap.SeqSet {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.searchRes
+}
+
+// resolveSearchRes replaces a reference to the saved search result ("$") with
+// the saved UIDs.
+//
+// The returned set is empty if the saved search result is empty.
+func (c *Conn) resolveSearchRes(numSet imap.NumSet, numKind NumKind) (imap.SeqSet, NumKind) {
+	if seqSet, ok := numSet.(imap.SeqSet); ok {
+		return seqSet, numKind
+	}
+	return c.loadSearchRes(), NumKindUID
+}
+
+// uidsToSeqNums converts a set of UIDs to message sequence numbers. UIDs which
+// don't belong to any message are ignored.
+func (c *Conn) uidsToSeqNums(ctx context.Context, uids imap.SeqSet) (imap.SeqSet, error) {
+	criteria := imap.SearchCriteria{UID: uids}
+	options := imap.SearchOptions{Return: []imap.SearchReturnOption{imap.SearchReturnAll}}
+	data, err := c.commandSession(ctx).Search(NumKindSeq, &criteria, &options)
+	if err != nil {
+		return nil, err
+	}
+	return data.All, nil
+}
+
+// resolveSearchResCriteria replaces references to the saved search result
+// ("$") in search criteria.
+func (c *Conn) resolveSearchResCriteria(criteria *imap.SearchCriteria) {
+	if criteria.SearchRes {
+		criteria.SearchRes = false
+		uids := c.loadSearchRes()
+		switch {
+		case len(uids) == 0:
+			// NOT ALL doesn't match any message
+			criteria.Not = append(criteria.Not, imap.SearchCriteria{})
+		case criteria.UID == nil:
+			criteria.UID = uids
+		default:
+			// Intersect with the existing UID criteria
+			criteria.Not = append(criteria.Not, imap.SearchCriteria{
+				Not: []imap.SearchCriteria{{UID: uids}},
+			})
+		}
+	}
+
+	for i := range criteria.Not {
+		c.resolveSearchResCriteria(&criteria.Not[i])
+	}
+	for i := range criteria.Or {
+		c.resolveSearchResCriteria(&criteria.Or[i][0])
+		c.resolveSearchResCriteria(&criteria.Or[i][1])
+	}
+}
+
+// saveSearchRes saves the result of a SEARCH command with the SAVE return
+// option.
+//
+// If only MIN and/or MAX are requested, only these messages are saved, as
+// described in RFC 5182 section 2.4.
+func (c *Conn) saveSearchRes(ctx context.Context, numKind NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions, data *imap.SearchData) error {
+	var minMax []imap.SearchReturnOption
+	all := len(options.Return) == 0
+	for _, opt := range options.Return {
+		switch opt {
+		case imap.SearchReturnMin, imap.SearchReturnMax:
+			minMax = append(minMax, opt)
+		case imap.SearchReturnAll, imap.SearchReturnCount:
+			all = true
+		}
+	}
+
+	saveOptions := imap.SearchOptions{Return: []imap.SearchReturnOption{imap.SearchReturnAll}}
+	if !all {
+		saveOptions.Return = minMax
+	}
+
+	if numKind != NumKindUID || (all && !hasSearchReturnOpt(options.Return, imap.SearchReturnAll) && len(options.Return) > 0) {
+		var err error
+		data, err = c.commandSession(ctx).Search(NumKindUID, criteria, &saveOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	var uids imap.SeqSet
+	if all {
+		uids = data.All
+	} else {
+		for _, opt := range minMax {
+			switch {
+			case opt == imap.SearchReturnMin && data.Min > 0:
+				uids.AddNum(data.Min)
+			case opt == imap.SearchReturnMax && data.Max > 0:
+				uids.AddNum(data.Max)
+			}
+		}
+	}
+	c.setSearchRes(uids)
+	return nil
+}
+
+func hasSearchReturnOpt(l []imap.SearchReturnOption, opt imap.SearchReturnOption) bool {
+	for _, o := range l {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
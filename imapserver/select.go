@@ -1,32 +1,58 @@
 package imapserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
 // SelectOptions contains options for the SELECT or EXAMINE command.
-type SelectOptions struct {
-	ReadOnly bool
-}
+type SelectOptions = imap.SelectOptions
 
-func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) error {
+func (c *Conn) handleSelect(ctx context.Context, tag string, dec *imapwire.Decoder, readOnly bool) error {
 	var mailbox string
-	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) {
+		return dec.Err()
+	}
+
+	options := SelectOptions{ReadOnly: readOnly}
+	if dec.SP() {
+		err := dec.ExpectList(func() error {
+			return readSelectParam(dec, &options)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
 
+	if options.CondStore {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
+	}
+	if options.QResync != nil && !c.qresyncEnabled() {
+		return newClientBugError("QRESYNC must be enabled before use")
+	}
+
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
 
 	if c.state == imap.ConnStateSelected {
-		if err := c.session.Unselect(); err != nil {
+		if err := c.commandSession(ctx).Unselect(); err != nil {
 			return err
 		}
 		c.state = imap.ConnStateAuthenticated
+		c.setSearchRes(nil)
+		c.setSelected("")
 		err := c.writeStatusResp("", &imap.StatusResponse{
 			Type: imap.StatusResponseTypeOK,
 			Code: "CLOSED",
@@ -37,8 +63,7 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 		}
 	}
 
-	options := SelectOptions{ReadOnly: readOnly}
-	data, err := c.session.Select(mailbox, &options)
+	data, err := c.commandSession(ctx).Select(mailbox, &options)
 	if err != nil {
 		return err
 	}
@@ -68,8 +93,21 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 			return err
 		}
 	}
+	// RFC 7162 section 3.1.2.1: HIGHESTMODSEQ is sent even if the client
+	// hasn't enabled CONDSTORE
+	if _, ok := c.session.(SessionCondStore); ok {
+		if err := c.writeHighestModSeq(data.HighestModSeq); err != nil {
+			return err
+		}
+	}
+	if options.QResync != nil && options.QResync.UIDValidity == data.UIDValidity {
+		if err := c.qresync(ctx, options.QResync); err != nil {
+			return err
+		}
+	}
 
 	c.state = imap.ConnStateSelected
+	c.setSelected(mailbox)
 	// TODO: forbid write commands in read-only mode
 
 	var (
@@ -90,7 +128,7 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	})
 }
 
-func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
+func (c *Conn) handleUnselect(ctx context.Context, dec *imapwire.Decoder, expunge bool) error {
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
@@ -101,19 +139,110 @@ func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
 
 	if expunge {
 		w := &ExpungeWriter{}
-		if err := c.session.Expunge(w, nil); err != nil {
+		err := c.commandSession(ctx).Expunge(w, nil)
+		// RFC 4314 section 4: without the right to expunge messages, CLOSE
+		// closes the mailbox without expunging
+		var imapErr *imap.Error
+		if err != nil && !(errors.As(err, &imapErr) && imapErr.Code == imap.ResponseCodeNoPerm) {
 			return err
 		}
 	}
 
-	if err := c.session.Unselect(); err != nil {
+	if err := c.commandSession(ctx).Unselect(); err != nil {
 		return err
 	}
 
 	c.state = imap.ConnStateAuthenticated
+	c.setSearchRes(nil)
+	c.setSelected("")
+	return nil
+}
+
+// setSelected records the name of the selected mailbox, or an empty string if
+// no mailbox is selected.
+func (c *Conn) setSelected(mailbox string) {
+	c.mutex.Lock()
+	c.selected = mailbox
+	c.mutex.Unlock()
+}
+
+func (c *Conn) selectedMailbox() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.selected
+}
+
+// qresync sends the changes which occurred since the last client
+// synchronization, as described by the QRESYNC parameters.
+func (c *Conn) qresync(ctx context.Context, params *imap.QResyncParams) error {
+	seqSet := params.KnownUIDs
+	if seqSet == nil {
+		seqSet = imap.SeqSetRange(1, 0)
+	}
+	items := []imap.FetchItem{imap.FetchItemUID, imap.FetchItemFlags, imap.FetchItemModSeq}
+	w := &FetchWriter{conn: c}
+	session := c.commandSession(ctx).(SessionCondStore)
+	return session.FetchWithOptions(w, NumKindUID, seqSet, items, &imap.FetchOptions{
+		ChangedSince: params.ModSeq,
+		Vanished:     true,
+	})
+}
+
+func readSelectParam(dec *imapwire.Decoder, options *SelectOptions) error {
+	var name string
+	if !dec.ExpectAtom(&name) {
+		return dec.Err()
+	}
+	switch strings.ToUpper(name) {
+	case "CONDSTORE":
+		options.CondStore = true
+	case "QRESYNC":
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		params, err := readQResyncParams(dec)
+		if err != nil {
+			return err
+		}
+		options.QResync = params
+	default:
+		return newClientBugError("Unknown SELECT parameter")
+	}
 	return nil
 }
 
+func readQResyncParams(dec *imapwire.Decoder) (*imap.QResyncParams, error) {
+	var params imap.QResyncParams
+	if !dec.ExpectSpecial('(') || !dec.ExpectNumber(&params.UIDValidity) || !dec.ExpectSP() || !dec.ExpectModSeq(&params.ModSeq) {
+		return nil, dec.Err()
+	}
+	if dec.SP() {
+		hasSeqMatch := dec.Special('(')
+		if !hasSeqMatch {
+			if !dec.ExpectSeqSet(&params.KnownUIDs) {
+				return nil, dec.Err()
+			}
+			if dec.SP() {
+				if !dec.ExpectSpecial('(') {
+					return nil, dec.Err()
+				}
+				hasSeqMatch = true
+			}
+		}
+		if hasSeqMatch {
+			var seqMatch imap.QResyncSeqMatch
+			if !dec.ExpectSeqSet(&seqMatch.SeqNums) || !dec.ExpectSP() || !dec.ExpectSeqSet(&seqMatch.UIDs) || !dec.ExpectSpecial(')') {
+				return nil, dec.Err()
+			}
+			params.SeqMatch = &seqMatch
+		}
+	}
+	if !dec.ExpectSpecial(')') {
+		return nil, dec.Err()
+	}
+	return &params, nil
+}
+
 func (c *Conn) writeExists(numMessages uint32) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -144,6 +273,18 @@ func (c *Conn) writeUIDNext(uidNext uint32) error {
 	return enc.CRLF()
 }
 
+func (c *Conn) writeHighestModSeq(highestModSeq uint64) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("OK").SP().Special('[')
+	if highestModSeq == 0 {
+		enc.Atom("NOMODSEQ").Special(']').SP().Text("No persistent mod-sequences")
+	} else {
+		enc.Atom("HIGHESTMODSEQ").SP().ModSeq(highestModSeq).Special(']').SP().Text("Highest mod-sequence")
+	}
+	return enc.CRLF()
+}
+
 func (c *Conn) writeFlags(flags []imap.Flag) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
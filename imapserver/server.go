@@ -41,6 +41,10 @@ type Options struct {
 	//   - MOVE
 	//   - STATUS=SIZE
 	Caps imap.CapSet
+	// ID contains the server identification fields returned in response to
+	// the ID command, as defined in RFC 2971. It's ignored if the session
+	// implements SessionID. The ID capability needs to be advertised in Caps.
+	ID map[string]string
 	// Logger is a logger to print error messages. If nil, log.Default is used.
 	Logger Logger
 	// TLSConfig is a TLS configuration for STARTTLS. If nil, STARTTLS is
@@ -49,6 +53,47 @@ type Options struct {
 	// InsecureAuth allows clients to authenticate without TLS. In this mode,
 	// the server is susceptible to man-in-the-middle attacks.
 	InsecureAuth bool
+	// ConcurrentCommands enables concurrent execution of pipelined commands
+	// when allowed by RFC 9051 section 5.5, e.g. multiple FETCH, SEARCH or
+	// STATUS commands. Session methods called by these commands (including
+	// Session.Poll) may then be invoked concurrently and must be safe for
+	// concurrent use.
+	ConcurrentCommands bool
+
+	// AppendLimit is the maximum size of a message added via APPEND, in bytes.
+	// If zero, a 100MiB limit is enforced. The limit is advertised via the
+	// APPENDLIMIT capability and returned in the STATUS APPENDLIMIT item when
+	// the session doesn't provide a mailbox-specific value.
+	AppendLimit uint32
+	// MaxLiteralSize is the maximum size of literals sent as arguments of
+	// commands other than APPEND, in bytes. These literals are buffered in
+	// memory. If zero, a 4096 bytes limit is enforced.
+	MaxLiteralSize int64
+	// ReadTimeout is the maximum duration to wait for a command to be sent by
+	// an unauthenticated client, or for the rest of a command once it has
+	// started. If zero, 30 seconds is used.
+	ReadTimeout time.Duration
+	// IdleTimeout is the maximum duration to wait for the next command of an
+	// authenticated client, including during IDLE. RFC 9051 section 5.4
+	// requires at least 30 minutes. If zero, 35 minutes is used.
+	IdleTimeout time.Duration
+	// WriteTimeout is the maximum duration to wait for a response to be
+	// written. If zero, 30 seconds is used.
+	WriteTimeout time.Duration
+
+	// MaxConns is the maximum number of simultaneous connections. If zero,
+	// the number of connections is unlimited.
+	MaxConns int
+	// MaxConnsPerIP is the maximum number of simultaneous connections from a
+	// single IP address. If zero, the number of connections is unlimited.
+	MaxConnsPerIP int
+	// MaxConnsPerUser is the maximum number of simultaneous connections
+	// authenticated as a single user. Connections logged in via LOGIN or a
+	// built-in AUTHENTICATE mechanism (PLAIN, SCRAM, OAUTHBEARER, XOAUTH2 and
+	// EXTERNAL) are counted, connections authenticated via the mechanisms of
+	// a SessionSASL aren't. If zero, the number of connections is unlimited.
+	MaxConnsPerUser int
+
 	// Raw ingress and egress data will be written to this writer, if any.
 	// Note, this may include sensitive information such as credentials used
 	// during authentication.
@@ -80,11 +125,14 @@ type Server struct {
 	options Options
 
 	listenerWaitGroup sync.WaitGroup
+	connWaitGroup     sync.WaitGroup
 
-	mutex     sync.Mutex
-	listeners map[net.Listener]struct{}
-	conns     map[*Conn]struct{}
-	closed    bool
+	mutex        sync.Mutex
+	listeners    map[net.Listener]struct{}
+	conns        map[*Conn]struct{}
+	connsPerIP   map[string]int
+	connsPerUser map[string]int
+	closed       bool
 }
 
 // New creates a new server.
@@ -93,9 +141,11 @@ func New(options *Options) *Server {
 		panic("imapserver: at least IMAP4rev1 must be supported")
 	}
 	return &Server{
-		options:   *options,
-		listeners: make(map[net.Listener]struct{}),
-		conns:     make(map[*Conn]struct{}),
+		options:      *options,
+		listeners:    make(map[net.Listener]struct{}),
+		conns:        make(map[*Conn]struct{}),
+		connsPerIP:   make(map[string]int),
+		connsPerUser: make(map[string]int),
 	}
 }
 
@@ -191,10 +241,27 @@ func (s *Server) ListenAndServeTLS(addr string) error {
 // Once Close has been called on a server, it may not be reused; future calls
 // to methods such as Serve will return an error.
 func (s *Server) Close() error {
-	var err error
+	ok, err := s.closeListeners()
+	if !ok {
+		return errClosed
+	}
 
 	s.mutex.Lock()
-	ok := !s.closed
+	for c := range s.conns {
+		c.cancel()
+		c.conn.Close()
+	}
+	s.mutex.Unlock()
+
+	return err
+}
+
+// closeListeners marks the server as closed, then closes all active listeners
+// and waits for Serve calls to return. It returns false if the server was
+// already closed.
+func (s *Server) closeListeners() (ok bool, err error) {
+	s.mutex.Lock()
+	ok = !s.closed
 	if ok {
 		s.closed = true
 		for l := range s.listeners {
@@ -205,16 +272,9 @@ func (s *Server) Close() error {
 	}
 	s.mutex.Unlock()
 	if !ok {
-		return errClosed
+		return false, nil
 	}
 
 	s.listenerWaitGroup.Wait()
-
-	s.mutex.Lock()
-	for c := range s.conns {
-		c.conn.Close()
-	}
-	s.mutex.Unlock()
-
-	return err
+	return true, err
 }
@@ -1,6 +1,8 @@
 package imapserver
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
@@ -16,6 +18,14 @@ var errAuthFailed = &imap.Error{
 // ErrAuthFailed is returned by Session.Login on authentication failure.
 var ErrAuthFailed = errAuthFailed
 
+// ErrQuotaExceeded can be returned by Session.Append, Session.Copy and
+// SessionMove.Move when the operation would exceed a quota.
+var ErrQuotaExceeded = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeOverQuota,
+	Text: "Quota exceeded",
+}
+
 // NumKind describes how a number should be interpreted: either as a sequence
 // number, either as a UID.
 type NumKind int
@@ -82,6 +92,171 @@ type SessionMove interface {
 	Move(w *MoveWriter, kind NumKind, seqSet imap.SeqSet, dest string) error
 }
 
+// SessionCondStore is an IMAP session which supports CONDSTORE.
+type SessionCondStore interface {
+	Session
+
+	// Selected state
+
+	// FetchWithOptions is called instead of Session.Fetch when FETCH options
+	// are specified. If options.ChangedSince is non-zero, only messages whose
+	// mod-sequence is greater than this value must be returned. If
+	// options.Vanished is set, the UIDs of messages expunged since
+	// options.ChangedSince must be written with FetchWriter.WriteVanished.
+	FetchWithOptions(w *FetchWriter, kind NumKind, seqSet imap.SeqSet, items []imap.FetchItem, options *imap.FetchOptions) error
+	// StoreWithOptions is called instead of Session.Store once CONDSTORE has
+	// been enabled. FETCH responses written by StoreWithOptions must include
+	// the MODSEQ data item, even if flags.Silent is set and
+	// options.UnchangedSince is non-zero.
+	//
+	// If options.UnchangedSince is non-zero, messages whose mod-sequence is
+	// greater than this value must be left untouched and must be returned in
+	// the modified set.
+	StoreWithOptions(w *FetchWriter, kind NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags, options *imap.StoreOptions) (modified imap.SeqSet, err error)
+}
+
+// SessionSort is an IMAP session which supports SORT.
+type SessionSort interface {
+	Session
+
+	// Selected state
+
+	// Sort returns the numbers of the messages matching criteria, ordered by
+	// sortCriteria. Ties are broken by sequence number.
+	Sort(kind NumKind, criteria *imap.SearchCriteria, sortCriteria []imap.SortCriterion) ([]uint32, error)
+}
+
+// SessionThread is an IMAP session which supports THREAD.
+type SessionThread interface {
+	Session
+
+	// Selected state
+
+	// Thread returns the messages matching criteria, grouped into threads
+	// with the specified algorithm. The algorithm is guaranteed to be
+	// advertised via a THREAD capability.
+	Thread(kind NumKind, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]imap.ThreadData, error)
+}
+
+// SessionQuota is an IMAP session which supports QUOTA.
+type SessionQuota interface {
+	Session
+
+	// QuotaResourceTypes returns the list of supported resource types. It's
+	// used to advertise QUOTA=RES-* capabilities.
+	QuotaResourceTypes() []imap.QuotaResourceType
+
+	// Authenticated state
+	GetQuota(root string) (*imap.QuotaData, error)
+	// GetQuotaRoot returns the quota roots of a mailbox, with their
+	// resource usage and limits.
+	GetQuotaRoot(mailbox string) ([]imap.QuotaData, error)
+}
+
+// SessionQuotaSet is an IMAP session which supports SETQUOTA.
+type SessionQuotaSet interface {
+	SessionQuota
+
+	// Authenticated state
+
+	// SetQuota changes the resource limits of a quota root. Resources
+	// missing from limits must be removed from the quota root. The
+	// resource types are guaranteed to be supported by the session.
+	//
+	// If the returned quota data is non-nil, it's sent to the client.
+	SetQuota(root string, limits map[imap.QuotaResourceType]int64) (*imap.QuotaData, error)
+}
+
+// SessionMetadata is an IMAP session which supports METADATA.
+type SessionMetadata interface {
+	Session
+
+	// Authenticated state
+
+	// GetMetadata returns the values of the requested entries. If mailbox is
+	// empty, server entries are requested. Entries which don't exist must be
+	// omitted. options.MaxSize is handled by imapserver and can be ignored.
+	GetMetadata(mailbox string, entries []string, options *imap.GetMetadataOptions) (*imap.GetMetadataData, error)
+	// SetMetadata sets the values of the specified entries. A nil value
+	// removes the entry. If mailbox is empty, server entries are set.
+	//
+	// ErrMetadataTooMany or an error created with NewMetadataMaxSizeError
+	// can be returned.
+	SetMetadata(mailbox string, entries map[string]*[]byte) error
+}
+
+// SessionACL is an IMAP session which supports ACL.
+type SessionACL interface {
+	Session
+
+	// Authenticated state
+	SetACL(mailbox string, ri imap.RightsIdentifier, rm imap.RightModification, rs imap.RightSet) error
+	DeleteACL(mailbox string, ri imap.RightsIdentifier) error
+	GetACL(mailbox string) (*imap.GetACLData, error)
+	ListRights(mailbox string, ri imap.RightsIdentifier) (*imap.ListRightsData, error)
+	MyRights(mailbox string) (*imap.MyRightsData, error)
+}
+
+// SessionAppend is an IMAP session which supports MULTIAPPEND and CATENATE.
+//
+// When implemented, all APPEND commands are handled with BeginAppend instead
+// of Session.Append.
+type SessionAppend interface {
+	Session
+
+	// Authenticated state
+
+	// BeginAppend starts appending messages to a mailbox.
+	BeginAppend(mailbox string) (AppendTransaction, error)
+}
+
+// AppendTransaction appends one or more messages to a mailbox atomically:
+// either all messages are appended, or none.
+//
+// Exactly one of Commit or Rollback is called at the end of the APPEND
+// command.
+type AppendTransaction interface {
+	// Append adds a message to the transaction. The reader is only valid
+	// during the call.
+	Append(r imap.LiteralReader, options *imap.AppendOptions) error
+	// Catenate adds a message built by concatenating parts to the
+	// transaction. URLs reference messages or message parts stored on the
+	// server, see imap.ParseMessageURL. Invalid URLs should be reported with
+	// the BADURL response code. The size of the resulting message in bytes
+	// is returned.
+	Catenate(parts []imap.CatenatePart, options *imap.AppendOptions) (size int64, err error)
+	// Commit appends the messages to the mailbox. AppendData.UIDs should
+	// contain the UIDs of the appended messages.
+	Commit() (*imap.AppendData, error)
+	// Rollback discards the messages.
+	Rollback() error
+}
+
+// SessionNotify is an IMAP session which supports NOTIFY.
+type SessionNotify interface {
+	Session
+
+	// Authenticated state
+
+	// UserTracker returns the tracker used to deliver mailbox-level updates
+	// for the logged in user. The returned tracker must not change for the
+	// lifetime of the session.
+	UserTracker() *UserTracker
+}
+
+// SessionID is an IMAP session which supports ID.
+//
+// ID may be called in any connection state, including before
+// authentication.
+type SessionID interface {
+	Session
+
+	// ID is called with the identification sent by the client, which may be
+	// nil. The returned fields are sent back to the client, a nil map is sent
+	// as NIL. Returning an error rejects the command.
+	ID(clientID map[string]string) (serverID map[string]string, err error)
+}
+
 // SessionIMAP4rev2 is an IMAP session which supports IMAP4rev2.
 type SessionIMAP4rev2 interface {
 	Session
@@ -89,6 +264,23 @@ type SessionIMAP4rev2 interface {
 	SessionMove
 }
 
+// SessionContext is an IMAP session which receives a context for each
+// command.
+type SessionContext interface {
+	Session
+
+	// WithContext returns the session used to handle a single command. ctx
+	// is cancelled once the command has been handled or when the connection
+	// is closed. CommandFromContext and ConnFromContext can be used to
+	// retrieve information about the command. WithContext may be called
+	// more than once for the same command.
+	//
+	// The returned session must share its state with the original session
+	// and implement the same interfaces. Commands may be handled
+	// concurrently when Options.ConcurrentCommands is set.
+	WithContext(ctx context.Context) Session
+}
+
 // SessionSASL is an IMAP session which supports its own set of SASL
 // authentication mechanisms.
 type SessionSASL interface {
@@ -96,3 +288,52 @@ type SessionSASL interface {
 	AuthenticateMechanisms() []string
 	Authenticate(mech string) (sasl.Server, error)
 }
+
+// SessionSCRAM is an IMAP session which supports the SCRAM-SHA-1 and
+// SCRAM-SHA-256 authentication mechanisms.
+//
+// It's ignored if the session implements SessionSASL.
+type SessionSCRAM interface {
+	Session
+
+	// SCRAMCredentials returns the credentials stored for a user. mech is
+	// either "SCRAM-SHA-1" or "SCRAM-SHA-256". ErrAuthFailed should be
+	// returned if the user doesn't exist.
+	SCRAMCredentials(mech, username string) (*SCRAMCredentials, error)
+	// LoginSCRAM is called once the client has proven it knows the password
+	// matching the credentials returned by SCRAMCredentials. The session
+	// must log in the user.
+	LoginSCRAM(username string) error
+}
+
+// SessionOAuth is an IMAP session which supports the OAUTHBEARER and XOAUTH2
+// authentication mechanisms.
+//
+// It's ignored if the session implements SessionSASL.
+type SessionOAuth interface {
+	Session
+
+	// LoginOAuth validates an OAuth 2.0 bearer token and logs in the user it
+	// has been issued for. username is the identity requested by the client,
+	// it may be empty with OAUTHBEARER. The name of the logged in user is
+	// returned.
+	//
+	// A *sasl.OAuthBearerError can be returned to customize the error sent
+	// to the client.
+	LoginOAuth(username, token string) (string, error)
+}
+
+// SessionExternal is an IMAP session which supports the EXTERNAL
+// authentication mechanism with TLS client certificates.
+//
+// The mechanism is only offered if the client has presented a certificate
+// verified against tls.Config.ClientCAs. It's ignored if the session
+// implements SessionSASL.
+type SessionExternal interface {
+	Session
+
+	// LoginExternal logs in the user identified by a verified TLS client
+	// certificate. identity is the identity requested by the client, it may
+	// be empty. The name of the logged in user is returned.
+	LoginExternal(identity string, cert *x509.Certificate) (string, error)
+}
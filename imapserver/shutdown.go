@@ -0,0 +1,105 @@
+package imapserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// errShutdown is returned by command handlers when the connection has been
+// terminated because the server is shutting down. The BYE response has
+// already been sent.
+var errShutdown = errors.New("imapserver: server shutting down")
+
+var shutdownResp = &imap.StatusResponse{
+	Type: imap.StatusResponseTypeBye,
+	Code: imap.ResponseCodeUnavailable,
+	Text: "Server shutting down",
+}
+
+// Shutdown gracefully shuts down the server.
+//
+// Shutdown first closes all active listeners. Then, clients waiting for a
+// command or running IDLE are sent a BYE response and disconnected, and
+// commands in progress are allowed to complete before their connection is
+// terminated the same way.
+//
+// If the context expires before all connections are closed, the remaining
+// connections are closed immediately and the context's error is returned.
+// Otherwise, any error returned from closing the server's underlying listeners
+// is returned.
+//
+// Once Shutdown has been called on a server, it may not be reused; future
+// calls to methods such as Serve will return an error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	ok, err := s.closeListeners()
+	if !ok {
+		return errClosed
+	}
+
+	s.mutex.Lock()
+	for c := range s.conns {
+		c.startShutdown()
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.connWaitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mutex.Lock()
+		for c := range s.conns {
+			c.cancel()
+			c.NetConn().Close()
+		}
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// startShutdown requests the connection to be terminated once the current
+// command completes. If the connection is waiting for the client, the
+// blocking read is interrupted.
+func (c *Conn) startShutdown() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.shutdown = true
+	if c.waiting {
+		c.conn.SetReadDeadline(time.Now())
+	}
+}
+
+// beginWait marks the connection as waiting for the client. It returns false
+// if the server is shutting down, in which case the caller must not wait.
+func (c *Conn) beginWait() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.waiting = !c.shutdown
+	return c.waiting
+}
+
+// endWait marks the connection as no longer waiting for the client. It
+// returns true if the server is shutting down.
+func (c *Conn) endWait() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.waiting = false
+	return c.shutdown
+}
+
+// byeShutdown waits for commands in progress to complete, then sends a BYE
+// response.
+func (c *Conn) byeShutdown() error {
+	c.waitCommands()
+	c.state = imap.ConnStateLogout
+	return c.writeStatusResp("", shutdownResp)
+}
@@ -0,0 +1,112 @@
+package imapserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleSort(ctx context.Context, dec *imapwire.Decoder, numKind NumKind) error {
+	sortCriteria, criteria, err := readSort(dec)
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkState(imap.ConnStateSelected); err != nil {
+		return err
+	}
+
+	session, ok := c.commandSession(ctx).(SessionSort)
+	if !ok {
+		return newClientBugError("SORT is not supported")
+	}
+
+	c.resolveSearchResCriteria(criteria)
+
+	nums, err := session.Sort(numKind, criteria, sortCriteria)
+	if err != nil {
+		return err
+	}
+
+	return c.writeSort(nums)
+}
+
+// readSort reads the arguments of a SORT command.
+func readSort(dec *imapwire.Decoder) ([]imap.SortCriterion, *imap.SearchCriteria, error) {
+	var (
+		sortCriteria []imap.SortCriterion
+		charset      string
+	)
+	if !dec.ExpectSP() {
+		return nil, nil, dec.Err()
+	}
+	err := dec.ExpectList(func() error {
+		criterion, err := readSortCriterion(dec)
+		if err != nil {
+			return err
+		}
+		sortCriteria = append(sortCriteria, *criterion)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("in sort-criteria: %w", err)
+	}
+	if len(sortCriteria) == 0 {
+		return nil, nil, newClientBugError("Empty sort criteria list")
+	}
+	if !dec.ExpectSP() || !dec.ExpectAString(&charset) || !dec.ExpectSP() {
+		return nil, nil, dec.Err()
+	}
+	if err := checkSearchCharset(charset); err != nil {
+		return nil, nil, err
+	}
+
+	var criteria imap.SearchCriteria
+	if err := readSearchKeys(&criteria, dec, ""); err != nil {
+		return nil, nil, err
+	}
+
+	if !dec.ExpectCRLF() {
+		return nil, nil, dec.Err()
+	}
+
+	return sortCriteria, &criteria, nil
+}
+
+func readSortCriterion(dec *imapwire.Decoder) (*imap.SortCriterion, error) {
+	var criterion imap.SortCriterion
+
+	var name string
+	if !dec.ExpectAtom(&name) {
+		return nil, dec.Err()
+	}
+	if strings.EqualFold(name, "REVERSE") {
+		criterion.Reverse = true
+		if !dec.ExpectSP() || !dec.ExpectAtom(&name) {
+			return nil, dec.Err()
+		}
+	}
+
+	switch key := imap.SortKey(strings.ToUpper(name)); key {
+	case imap.SortKeyArrival, imap.SortKeyCc, imap.SortKeyDate, imap.SortKeyFrom, imap.SortKeySize, imap.SortKeySubject, imap.SortKeyTo:
+		criterion.Key = key
+	default:
+		return nil, newClientBugError("Unknown sort key")
+	}
+
+	return &criterion, nil
+}
+
+func (c *Conn) writeSort(nums []uint32) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("SORT")
+	for _, num := range nums {
+		enc.SP().Number(num)
+	}
+	return enc.CRLF()
+}
@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,7 +10,7 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
+func (c *Conn) handleStatus(ctx context.Context, dec *imapwire.Decoder) error {
 	var mailbox string
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
 		return dec.Err()
@@ -36,11 +37,19 @@ func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
 		return dec.Err()
 	}
 
+	for _, item := range items {
+		if item == imap.StatusItemHighestModSeq {
+			if err := c.enableCondStore(); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
 
-	data, err := c.session.Status(mailbox, items)
+	data, err := c.commandSession(ctx).Status(mailbox, items)
 	if err != nil {
 		return err
 	}
@@ -52,6 +61,12 @@ func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
 }
 
 func (c *Conn) writeStatus(data *imap.StatusData, items []imap.StatusItem) error {
+	appendLimit := data.AppendLimit
+	if appendLimit == nil {
+		limit := uint32(c.server.options.appendLimit())
+		appendLimit = &limit
+	}
+
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	return enc.Atom("*").SP().Atom("STATUS").SP().Mailbox(data.Mailbox).SP().List(len(items), func(i int) {
@@ -71,13 +86,15 @@ func (c *Conn) writeStatus(data *imap.StatusData, items []imap.StatusItem) error
 		case imap.StatusItemSize:
 			enc.Number64(*data.Size)
 		case imap.StatusItemAppendLimit:
-			if data.AppendLimit != nil {
-				enc.Number(*data.AppendLimit)
+			if appendLimit != nil {
+				enc.Number(*appendLimit)
 			} else {
 				enc.NIL()
 			}
 		case imap.StatusItemDeletedStorage:
 			enc.Number64(*data.DeletedStorage)
+		case imap.StatusItemHighestModSeq:
+			enc.ModSeq(data.HighestModSeq)
 		case internal.StatusItemRecent:
 			enc.Number(0)
 		default:
@@ -92,7 +109,7 @@ func readStatusItem(dec *imapwire.Decoder) (imap.StatusItem, error) {
 		return "", dec.Err()
 	}
 	switch item := imap.StatusItem(strings.ToUpper(name)); item {
-	case imap.StatusItemNumMessages, imap.StatusItemUIDNext, imap.StatusItemUIDValidity, imap.StatusItemNumUnseen, imap.StatusItemNumDeleted, imap.StatusItemSize, imap.StatusItemAppendLimit, imap.StatusItemDeletedStorage:
+	case imap.StatusItemNumMessages, imap.StatusItemUIDNext, imap.StatusItemUIDValidity, imap.StatusItemNumUnseen, imap.StatusItemNumDeleted, imap.StatusItemSize, imap.StatusItemAppendLimit, imap.StatusItemDeletedStorage, imap.StatusItemHighestModSeq:
 		return item, nil
 	case internal.StatusItemRecent:
 		return item, nil
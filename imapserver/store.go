@@ -1,6 +1,8 @@
 package imapserver
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/emersion/go-imap/v2"
@@ -8,16 +10,28 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
+func (c *Conn) handleStore(ctx context.Context, tag string, dec *imapwire.Decoder, numKind NumKind) error {
 	var (
-		seqSet imap.SeqSet
-		item   string
+		numSet  imap.NumSet
+		item    string
+		options imap.StoreOptions
 	)
-	if !dec.ExpectSP() || !dec.ExpectSeqSet(&seqSet) || !dec.ExpectSP() || !dec.ExpectAtom(&item) || !dec.ExpectSP() {
+	if !dec.ExpectSP() || !dec.ExpectNumSet(&numSet) || !dec.ExpectSP() {
 		return dec.Err()
 	}
-	var flags []imap.Flag
 	isList, err := dec.List(func() error {
+		return readStoreModifier(dec, &options)
+	})
+	if err != nil {
+		return err
+	} else if isList && !dec.ExpectSP() {
+		return dec.Err()
+	}
+	if !dec.ExpectAtom(&item) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	var flags []imap.Flag
+	isList, err = dec.List(func() error {
 		flag, err := internal.ReadFlag(dec)
 		if err != nil {
 			return err
@@ -64,14 +78,81 @@ func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
 		return newClientBugError("STORE can only change FLAGS")
 	}
 
+	if options.UnchangedSince != 0 {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
+	}
+
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
 
+	cmdName := "STORE"
+	if numKind == NumKindUID {
+		cmdName = "UID STORE"
+	}
+
 	w := &FetchWriter{conn: c}
-	return c.session.Store(w, numKind, seqSet, &imap.StoreFlags{
+	storeFlags := &imap.StoreFlags{
 		Op:     op,
 		Silent: silent,
 		Flags:  flags,
-	})
+	}
+	var modified imap.SeqSet
+	seqSet, storeNumKind := c.resolveSearchRes(numSet, numKind)
+	if len(seqSet) == 0 {
+		// Empty saved search result, nothing to do
+	} else if c.condStoreEnabled() {
+		session := c.commandSession(ctx).(SessionCondStore)
+		modified, err = session.StoreWithOptions(w, storeNumKind, seqSet, storeFlags, &options)
+	} else {
+		err = c.commandSession(ctx).Store(w, storeNumKind, seqSet, storeFlags)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.poll(ctx, cmdName); err != nil {
+		return err
+	}
+
+	if len(modified) > 0 && storeNumKind != numKind {
+		// The saved search result contains UIDs, but STORE must report
+		// message sequence numbers
+		modified, err = c.uidsToSeqNums(ctx, modified)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.writeStoreOK(tag, cmdName, modified)
+}
+
+func (c *Conn) writeStoreOK(tag, cmdName string, modified imap.SeqSet) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom(tag).SP().Atom("OK").SP()
+	if len(modified) > 0 {
+		enc.Special('[').Atom("MODIFIED").SP().SeqSet(modified).Special(']').SP()
+	}
+	enc.Text(fmt.Sprintf("%v completed", cmdName))
+	return enc.CRLF()
+}
+
+func readStoreModifier(dec *imapwire.Decoder, options *imap.StoreOptions) error {
+	var name string
+	if !dec.ExpectAtom(&name) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	switch strings.ToUpper(name) {
+	case "UNCHANGEDSINCE":
+		if !dec.ExpectModSeq(&options.UnchangedSince) {
+			return dec.Err()
+		}
+	default:
+		return newClientBugError("Unknown STORE modifier")
+	}
+	return nil
 }
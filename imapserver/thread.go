@@ -0,0 +1,91 @@
+package imapserver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleThread(ctx context.Context, dec *imapwire.Decoder, numKind NumKind) error {
+	algorithm, criteria, err := readThread(dec)
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkState(imap.ConnStateSelected); err != nil {
+		return err
+	}
+
+	if !c.server.options.caps().Has(imap.Cap("THREAD=" + string(algorithm))) {
+		return newClientBugError("Unsupported threading algorithm")
+	}
+	session, ok := c.commandSession(ctx).(SessionThread)
+	if !ok {
+		return newClientBugError("THREAD is not supported")
+	}
+
+	c.resolveSearchResCriteria(criteria)
+
+	data, err := session.Thread(numKind, algorithm, criteria)
+	if err != nil {
+		return err
+	}
+
+	return c.writeThread(data)
+}
+
+// readThread reads the arguments of a THREAD command.
+func readThread(dec *imapwire.Decoder) (imap.ThreadAlgorithm, *imap.SearchCriteria, error) {
+	var name, charset string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&name) || !dec.ExpectSP() || !dec.ExpectAString(&charset) || !dec.ExpectSP() {
+		return "", nil, dec.Err()
+	}
+	algorithm := imap.ThreadAlgorithm(strings.ToUpper(name))
+	if err := checkSearchCharset(charset); err != nil {
+		return "", nil, err
+	}
+
+	var criteria imap.SearchCriteria
+	if err := readSearchKeys(&criteria, dec, ""); err != nil {
+		return "", nil, err
+	}
+
+	if !dec.ExpectCRLF() {
+		return "", nil, dec.Err()
+	}
+
+	return algorithm, &criteria, nil
+}
+
+func (c *Conn) writeThread(data []imap.ThreadData) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	enc.Atom("*").SP().Atom("THREAD")
+	if len(data) > 0 {
+		enc.SP()
+	}
+	for i := range data {
+		writeThreadList(enc.Encoder, &data[i])
+	}
+	return enc.CRLF()
+}
+
+func writeThreadList(enc *imapwire.Encoder, data *imap.ThreadData) {
+	enc.Special('(')
+	for i, num := range data.Chain {
+		if i > 0 {
+			enc.SP()
+		}
+		enc.Number(num)
+	}
+	if len(data.Chain) > 0 && len(data.SubThreads) > 0 {
+		enc.SP()
+	}
+	for i := range data.SubThreads {
+		writeThreadList(enc, &data.SubThreads[i])
+	}
+	enc.Special(')')
+}
@@ -16,6 +16,18 @@ type MailboxTracker struct {
 	mutex       sync.Mutex
 	numMessages uint32
 	sessions    map[*SessionTracker]struct{}
+	vanished    []trackerVanished
+	// mod-sequence of the most recent expunge dropped from vanished
+	vanishedDroppedModSeq uint64
+}
+
+// maxTrackerVanished is the maximum number of expunged UIDs remembered by a
+// MailboxTracker.
+const maxTrackerVanished = 4096
+
+type trackerVanished struct {
+	uid    uint32
+	modSeq uint64
 }
 
 // NewMailboxTracker creates a new mailbox tracker.
@@ -65,6 +77,8 @@ func (t *MailboxTracker) queueUpdate(update *trackerUpdate, source *SessionTrack
 }
 
 // QueueExpunge queues a new EXPUNGE update.
+//
+// Servers supporting QRESYNC must use QueueExpungeModSeq instead.
 func (t *MailboxTracker) QueueExpunge(seqNum uint32) {
 	if seqNum == 0 {
 		panic("imapserver: invalid expunge message sequence number")
@@ -72,6 +86,49 @@ func (t *MailboxTracker) QueueExpunge(seqNum uint32) {
 	t.queueUpdate(&trackerUpdate{expunge: seqNum}, nil)
 }
 
+// QueueExpungeModSeq queues a new EXPUNGE update and records the message UID as
+// expunged at the provided mod-sequence.
+//
+// Sessions which have enabled QRESYNC receive a VANISHED response instead of
+// EXPUNGE.
+func (t *MailboxTracker) QueueExpungeModSeq(seqNum, uid uint32, modSeq uint64) {
+	if seqNum == 0 || uid == 0 {
+		panic("imapserver: invalid expunge message sequence number or UID")
+	}
+	t.mutex.Lock()
+	t.vanished = append(t.vanished, trackerVanished{uid: uid, modSeq: modSeq})
+	if len(t.vanished) > maxTrackerVanished {
+		// Drop the oldest half, to avoid copying on each expunge
+		n := len(t.vanished) - maxTrackerVanished/2
+		t.vanishedDroppedModSeq = t.vanished[n-1].modSeq
+		t.vanished = append([]trackerVanished(nil), t.vanished[n:]...)
+	}
+	t.mutex.Unlock()
+	t.queueUpdate(&trackerUpdate{expunge: seqNum, expungeUID: uid}, nil)
+}
+
+// ExpungedSince returns the UIDs of the messages expunged with a mod-sequence
+// strictly greater than modSeq.
+//
+// Only expunges queued with QueueExpungeModSeq are taken into account. Only
+// the most recent expunges are remembered: if some of the expunges after
+// modSeq have been forgotten, ok is false and the caller needs to compute the
+// expunged UIDs by other means.
+func (t *MailboxTracker) ExpungedSince(modSeq uint64) (uids imap.SeqSet, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if modSeq < t.vanishedDroppedModSeq {
+		return nil, false
+	}
+	for _, v := range t.vanished {
+		if v.modSeq > modSeq {
+			uids.AddNum(v.uid)
+		}
+	}
+	return uids, true
+}
+
 // QueueNumMessages queues a new EXISTS update.
 func (t *MailboxTracker) QueueNumMessages(n uint32) {
 	// TODO: merge consecutive NumMessages updates
@@ -90,15 +147,27 @@ func (t *MailboxTracker) QueueMailboxFlags(flags []imap.Flag) {
 //
 // If source is not nil, the update won't be dispatched to it.
 func (t *MailboxTracker) QueueMessageFlags(seqNum, uid uint32, flags []imap.Flag, source *SessionTracker) {
+	t.QueueMessageFlagsModSeq(seqNum, uid, flags, 0, source)
+}
+
+// QueueMessageFlagsModSeq queues a new FETCH FLAGS update with the message's
+// new mod-sequence.
+//
+// The mod-sequence is only sent to sessions which have enabled CONDSTORE.
+//
+// If source is not nil, the update won't be dispatched to it.
+func (t *MailboxTracker) QueueMessageFlagsModSeq(seqNum, uid uint32, flags []imap.Flag, modSeq uint64, source *SessionTracker) {
 	t.queueUpdate(&trackerUpdate{fetch: &trackerUpdateFetch{
 		seqNum: seqNum,
 		uid:    uid,
 		flags:  flags,
+		modSeq: modSeq,
 	}}, source)
 }
 
 type trackerUpdate struct {
 	expunge      uint32
+	expungeUID   uint32
 	numMessages  uint32
 	mailboxFlags []imap.Flag
 	fetch        *trackerUpdateFetch
@@ -108,6 +177,7 @@ type trackerUpdateFetch struct {
 	seqNum uint32
 	uid    uint32
 	flags  []imap.Flag
+	modSeq uint64
 }
 
 // SessionTracker tracks the state of a mailbox for an IMAP client.
@@ -146,29 +216,54 @@ func (t *SessionTracker) queueUpdate(update *trackerUpdate) {
 
 // Poll dequeues pending mailbox updates for this session.
 func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
-	var updates []trackerUpdate
+	var updates, skipped []trackerUpdate
 	t.mutex.Lock()
-	if allowExpunge {
-		updates = t.queue
-		t.queue = nil
-	} else {
-		stopIndex := -1
-		for i, update := range t.queue {
-			if update.expunge != 0 {
+	// Updates the client doesn't want to be notified about are left queued
+	// for the next poll. Expunges renumber messages: if one can't be written
+	// yet, or if an earlier update has been left queued, it's left queued
+	// along with the following updates.
+	stopIndex := len(t.queue)
+	for i := range t.queue {
+		update := &t.queue[i]
+		if update.expunge != 0 {
+			if !allowExpunge || len(skipped) > 0 || !wantsSelectedUpdate(w.notify, update) {
 				stopIndex = i
 				break
 			}
-			updates = append(updates, update)
-		}
-		if stopIndex >= 0 {
-			t.queue = t.queue[stopIndex:]
-		} else {
-			t.queue = nil
+		} else if !wantsSelectedUpdate(w.notify, update) {
+			skipped = append(skipped, *update)
+			continue
 		}
+		skipped = dropSupersededUpdates(skipped, update)
+		updates = append(updates, *update)
+	}
+	t.queue = append(skipped, t.queue[stopIndex:]...)
+	if len(t.queue) == 0 {
+		t.queue = nil
 	}
 	t.mutex.Unlock()
 
+	// Consecutive expunges are merged into a single VANISHED response
+	qresync := w.conn.qresyncEnabled()
+	var vanished imap.SeqSet
+	flushVanished := func() error {
+		if len(vanished) == 0 {
+			return nil
+		}
+		err := w.writeVanished(vanished)
+		vanished = nil
+		return err
+	}
+
 	for _, update := range updates {
+		if qresync && update.expunge != 0 && update.expungeUID != 0 {
+			vanished.AddNum(update.expungeUID)
+			continue
+		}
+		if err := flushVanished(); err != nil {
+			return err
+		}
+
 		var err error
 		switch {
 		case update.expunge != 0:
@@ -178,7 +273,7 @@ func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
 		case update.mailboxFlags != nil:
 			err = w.WriteMailboxFlags(update.mailboxFlags)
 		case update.fetch != nil:
-			err = w.WriteMessageFlags(update.fetch.seqNum, update.fetch.uid, update.fetch.flags)
+			err = w.writeMessageFlags(update.fetch.seqNum, update.fetch.uid, update.fetch.flags, update.fetch.modSeq)
 		default:
 			panic(fmt.Errorf("imapserver: unknown tracker update %#v", update))
 		}
@@ -186,7 +281,25 @@ func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
 			return err
 		}
 	}
-	return nil
+	return flushVanished()
+}
+
+// dropSupersededUpdates removes the updates made obsolete by a more recent
+// one. l must not contain expunges.
+func dropSupersededUpdates(l []trackerUpdate, update *trackerUpdate) []trackerUpdate {
+	var out []trackerUpdate
+	for _, u := range l {
+		switch {
+		case update.numMessages != 0 && u.numMessages != 0:
+			continue
+		case update.mailboxFlags != nil && u.mailboxFlags != nil:
+			continue
+		case update.fetch != nil && u.fetch != nil && update.fetch.seqNum == u.fetch.seqNum:
+			continue
+		}
+		out = append(out, u)
+	}
+	return out
 }
 
 // Idle continuously writes mailbox updates.
@@ -153,3 +153,20 @@ func TestSessionTracker(t *testing.T) {
 		})
 	}
 }
+
+func TestMailboxTracker_ExpungedSince(t *testing.T) {
+	const n = 10000
+	tracker := imapserver.NewMailboxTracker(n)
+	for uid := uint32(1); uid <= n; uid++ {
+		tracker.QueueExpungeModSeq(1, uid, uint64(uid))
+	}
+
+	if uids, ok := tracker.ExpungedSince(n - 10); !ok {
+		t.Errorf("ExpungedSince(%v) = incomplete", n-10)
+	} else if want := "9991:10000"; uids.String() != want {
+		t.Errorf("ExpungedSince(%v) = %v, want %v", n-10, uids, want)
+	}
+	if _, ok := tracker.ExpungedSince(1); ok {
+		t.Errorf("ExpungedSince(1) = complete, want incomplete history")
+	}
+}
@@ -0,0 +1,135 @@
+package imapserver
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// maxUserTrackerQueue is the maximum number of pending updates per session.
+// Once reached, the session is notified that updates have been lost.
+const maxUserTrackerQueue = 1024
+
+// UserTracker tracks mailbox-level changes for a user.
+//
+// It's used to implement the NOTIFY extension: connections which have
+// requested notifications receive STATUS and LIST responses for mailboxes
+// other than the selected one.
+type UserTracker struct {
+	mutex    sync.Mutex
+	sessions map[*UserSessionTracker]struct{}
+}
+
+// NewUserTracker creates a new user tracker.
+func NewUserTracker() *UserTracker {
+	return &UserTracker{
+		sessions: make(map[*UserSessionTracker]struct{}),
+	}
+}
+
+// NewSession creates a new session tracker for the user.
+//
+// The caller must call UserSessionTracker.Close once they are done with the
+// session.
+func (t *UserTracker) NewSession() *UserSessionTracker {
+	st := &UserSessionTracker{
+		user:    t,
+		updates: make(chan struct{}, 1),
+	}
+	t.mutex.Lock()
+	t.sessions[st] = struct{}{}
+	t.mutex.Unlock()
+	return st
+}
+
+func (t *UserTracker) queueUpdate(update *userTrackerUpdate) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for st := range t.sessions {
+		st.queueUpdate(update)
+	}
+}
+
+// QueueStatus queues a mailbox status update.
+//
+// event must be one of NotifyEventMessageNew, NotifyEventMessageExpunge or
+// NotifyEventFlagChange. data contains the up-to-date status of the mailbox:
+// MESSAGES, UIDNEXT, UIDVALIDITY and UNSEEN should be populated, and
+// HIGHESTMODSEQ if the backend supports CONDSTORE.
+func (t *UserTracker) QueueStatus(event imap.NotifyEvent, data *imap.StatusData) {
+	switch event {
+	case imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge, imap.NotifyEventFlagChange:
+		// ok
+	default:
+		panic(fmt.Errorf("imapserver: invalid mailbox status event %v", event))
+	}
+	t.queueUpdate(&userTrackerUpdate{event: event, status: data})
+}
+
+// QueueMailboxName queues an update for a created, deleted or renamed
+// mailbox.
+//
+// For deleted mailboxes, data.Attrs contains imap.MailboxAttrNonExistent. For
+// renamed mailboxes, data.OldName contains the previous name.
+func (t *UserTracker) QueueMailboxName(data *imap.ListData) {
+	t.queueUpdate(&userTrackerUpdate{event: imap.NotifyEventMailboxName, list: data})
+}
+
+// QueueSubscriptionChange queues an update for a subscribed or unsubscribed
+// mailbox.
+//
+// data.Attrs contains imap.MailboxAttrSubscribed if the mailbox is now
+// subscribed.
+func (t *UserTracker) QueueSubscriptionChange(data *imap.ListData) {
+	t.queueUpdate(&userTrackerUpdate{event: imap.NotifyEventSubscriptionChange, list: data})
+}
+
+type userTrackerUpdate struct {
+	event  imap.NotifyEvent
+	status *imap.StatusData
+	list   *imap.ListData
+}
+
+// UserSessionTracker tracks mailbox-level changes for an IMAP client.
+type UserSessionTracker struct {
+	user *UserTracker
+
+	mutex    sync.Mutex
+	queue    []userTrackerUpdate
+	overflow bool
+	updates  chan struct{}
+}
+
+// Close unregisters the session.
+func (t *UserSessionTracker) Close() {
+	t.user.mutex.Lock()
+	delete(t.user.sessions, t)
+	t.user.mutex.Unlock()
+}
+
+func (t *UserSessionTracker) queueUpdate(update *userTrackerUpdate) {
+	t.mutex.Lock()
+	if len(t.queue) < maxUserTrackerQueue {
+		t.queue = append(t.queue, *update)
+	} else {
+		t.overflow = true
+	}
+	t.mutex.Unlock()
+
+	select {
+	case t.updates <- struct{}{}:
+	default:
+		// a notification is already pending
+	}
+}
+
+// poll dequeues pending updates. overflow is true if updates have been lost.
+func (t *UserSessionTracker) poll() (updates []userTrackerUpdate, overflow bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	updates, overflow = t.queue, t.overflow
+	t.queue = nil
+	return updates, overflow
+}
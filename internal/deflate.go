@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+)
+
+// DeflateConn is a connection compressed with DEFLATE, as defined in
+// RFC 4978.
+type DeflateConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+// NewDeflateConn wraps a connection with DEFLATE compression.
+//
+// Compressed data is read from r, which typically reads from conn after
+// draining any buffered data.
+func NewDeflateConn(conn net.Conn, r io.Reader) *DeflateConn {
+	w, err := flate.NewWriter(conn, flate.DefaultCompression)
+	if err != nil {
+		panic(err) // unreachable
+	}
+	return &DeflateConn{
+		Conn: conn,
+		r:    flate.NewReader(r),
+		w:    w,
+	}
+}
+
+func (conn *DeflateConn) Read(b []byte) (int, error) {
+	return conn.r.Read(b)
+}
+
+// Write compresses and writes data. The compressor is flushed after each
+// write, so that the other side can decompress everything sent so far.
+func (conn *DeflateConn) Write(b []byte) (int, error) {
+	n, err := conn.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, conn.w.Flush()
+}
+
+func (conn *DeflateConn) Close() error {
+	conn.r.Close()
+	return conn.Conn.Close()
+}
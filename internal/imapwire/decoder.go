@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/utf7"
@@ -43,6 +44,9 @@ type Decoder struct {
 	// CheckBufferedLiteralFunc is called when a literal is about to be decoded
 	// and needs to be fully buffered in memory.
 	CheckBufferedLiteralFunc func(size int64, nonSync bool) error
+	// MailboxUTF8 decodes mailbox names as UTF-8 instead of modified UTF-7.
+	// This requires UTF8=ACCEPT to be enabled.
+	MailboxUTF8 bool
 
 	r       *bufio.Reader
 	side    ConnSide
@@ -324,6 +328,23 @@ func (dec *Decoder) ExpectNumber64(ptr *int64) bool {
 	return dec.Expect(dec.Number64(ptr), "number64")
 }
 
+func (dec *Decoder) ModSeq(ptr *uint64) bool {
+	s, ok := dec.numberStr()
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return false // can happen on overflow
+	}
+	*ptr = v
+	return true
+}
+
+func (dec *Decoder) ExpectModSeq(ptr *uint64) bool {
+	return dec.Expect(dec.ModSeq(ptr), "mod-sequence-value")
+}
+
 func (dec *Decoder) Quoted(ptr *string) bool {
 	if !dec.Special('"') {
 		return false
@@ -358,6 +379,9 @@ func (dec *Decoder) ExpectAString(ptr *string) bool {
 	}
 	if dec.Literal(ptr) {
 		return true
+	} else if dec.err != nil {
+		// The literal was rejected
+		return false
 	}
 	// TODO: accept unquoted resp-specials
 	return dec.ExpectAtom(ptr)
@@ -453,13 +477,24 @@ func (dec *Decoder) ExpectMailbox(ptr *string) bool {
 		*ptr = "INBOX"
 		return true
 	}
-	name, err := utf7.Encoding.NewDecoder().String(name)
+	name, err := dec.DecodeMailbox(name)
 	if err == nil {
 		*ptr = name
 	}
 	return dec.returnErr(err)
 }
 
+// DecodeMailbox decodes a mailbox name, which may contain LIST wildcards.
+func (dec *Decoder) DecodeMailbox(name string) (string, error) {
+	if dec.MailboxUTF8 {
+		if !utf8.ValidString(name) {
+			return "", fmt.Errorf("imapwire: mailbox name contains invalid UTF-8")
+		}
+		return name, nil
+	}
+	return utf7.Encoding.NewDecoder().String(name)
+}
+
 func (dec *Decoder) ExpectSeqSet(ptr *imap.SeqSet) bool {
 	var s string
 	if !dec.Expect(dec.Func(&s, isSeqSetChar), "sequence-set") {
@@ -472,6 +507,18 @@ func (dec *Decoder) ExpectSeqSet(ptr *imap.SeqSet) bool {
 	return dec.returnErr(err)
 }
 
+func (dec *Decoder) ExpectNumSet(ptr *imap.NumSet) bool {
+	var s string
+	if !dec.Expect(dec.Func(&s, isSeqSetChar), "sequence-set") {
+		return false
+	}
+	numSet, err := imap.ParseNumSet(s)
+	if err == nil {
+		*ptr = numSet
+	}
+	return dec.returnErr(err)
+}
+
 func isSeqSetChar(ch byte) bool {
 	return ch == '*' || IsAtomChar(ch)
 }
@@ -484,7 +531,7 @@ func (dec *Decoder) Literal(ptr *string) bool {
 	if dec.CheckBufferedLiteralFunc != nil {
 		if err := dec.CheckBufferedLiteralFunc(lit.Size(), nonSync); err != nil {
 			lit.cancel()
-			return false
+			return dec.returnErr(err)
 		}
 	}
 	var sb strings.Builder
@@ -21,6 +21,9 @@ type Encoder struct {
 	// QuotedUTF8 allows non-ASCII strings to be encoded as quoted strings.
 	// This requires IMAP4rev2 or UTF8=ACCEPT.
 	QuotedUTF8 bool
+	// MailboxUTF8 encodes mailbox names in UTF-8 instead of modified UTF-7.
+	// This requires UTF8=ACCEPT to be enabled.
+	MailboxUTF8 bool
 	// LiteralMinus enables non-synchronizing literals for short payloads.
 	// This requires IMAP4rev2 or LITERAL-. This is only meaningful for
 	// clients.
@@ -150,8 +153,27 @@ func (enc *Encoder) Mailbox(name string) *Encoder {
 	if strings.EqualFold(name, "INBOX") {
 		return enc.Atom("INBOX")
 	} else {
-		name, _ = utf7.Encoding.NewEncoder().String(name)
-		return enc.String(name)
+		return enc.MailboxPattern(name)
+	}
+}
+
+// MailboxPattern writes a mailbox name which may contain LIST wildcards.
+func (enc *Encoder) MailboxPattern(pattern string) *Encoder {
+	if !enc.MailboxUTF8 {
+		pattern, _ = utf7.Encoding.NewEncoder().String(pattern)
+	}
+	return enc.String(pattern)
+}
+
+func (enc *Encoder) NumSet(numSet imap.NumSet) *Encoder {
+	switch numSet := numSet.(type) {
+	case imap.SeqSet:
+		return enc.SeqSet(numSet)
+	case imap.SearchRes:
+		return enc.writeString(numSet.String())
+	default:
+		enc.setErr(fmt.Errorf("imapwire: cannot encode number set %T", numSet))
+		return enc
 	}
 }
 
@@ -192,6 +214,10 @@ func (enc *Encoder) Number64(v int64) *Encoder {
 	return enc.writeString(strconv.FormatInt(v, 10))
 }
 
+func (enc *Encoder) ModSeq(v uint64) *Encoder {
+	return enc.writeString(strconv.FormatUint(v, 10))
+}
+
 // List writes a parenthesized list.
 func (enc *Encoder) List(n int, f func(i int)) *Encoder {
 	enc.Special('(')
@@ -225,7 +251,6 @@ func (enc *Encoder) Literal(size int64, sync *ContinuationRequest) io.WriteClose
 		panic("imapwire: sync must be nil on a server-side Encoder.Literal")
 	}
 
-	// TODO: literal8
 	enc.writeString("{")
 	enc.Number64(size)
 	if sync == nil && enc.side == ConnSideClient {
@@ -252,6 +277,15 @@ func (enc *Encoder) Literal(size int64, sync *ContinuationRequest) io.WriteClose
 	}
 }
 
+// Literal8 writes a literal8, as defined in RFC 3516. Unlike regular literals,
+// literal8 values may contain NUL bytes.
+//
+// See Literal for the semantics of size and sync.
+func (enc *Encoder) Literal8(size int64, sync *ContinuationRequest) io.WriteCloser {
+	enc.Special('~')
+	return enc.Literal(size, sync)
+}
+
 type errorWriter struct {
 	err error
 }
@@ -0,0 +1,414 @@
+// Package scram implements the SCRAM SASL authentication mechanisms, as
+// defined in RFC 5802 and RFC 7677.
+//
+// Channel binding isn't supported. Passwords are used as-is, without SASLprep
+// normalization.
+package scram
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// maxIterations is the maximum iteration count accepted by clients, to avoid
+// spending an unbounded amount of CPU time.
+const maxIterations = 1 << 20
+
+// Mechanism is a SCRAM mechanism.
+type Mechanism struct {
+	Name string
+	Hash func() hash.Hash
+}
+
+var (
+	SHA1   = &Mechanism{Name: "SCRAM-SHA-1", Hash: sha1.New}
+	SHA256 = &Mechanism{Name: "SCRAM-SHA-256", Hash: sha256.New}
+)
+
+// Lookup returns the mechanism with the specified name, or nil if it's not
+// supported.
+func Lookup(name string) *Mechanism {
+	switch strings.ToUpper(name) {
+	case SHA1.Name:
+		return SHA1
+	case SHA256.Name:
+		return SHA256
+	default:
+		return nil
+	}
+}
+
+func (mech *Mechanism) hmac(key, b []byte) []byte {
+	h := hmac.New(mech.Hash, key)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+func (mech *Mechanism) hash(b []byte) []byte {
+	h := mech.Hash()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// saltedPassword computes Hi(password, salt, iterations), which is PBKDF2 with
+// a single output block.
+func (mech *Mechanism) saltedPassword(password string, salt []byte, iterations int) []byte {
+	prf := hmac.New(mech.Hash, []byte(password))
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+
+	result := make([]byte, len(u))
+	copy(result, u)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// Credentials are the credentials stored by a server for a user, as defined
+// in RFC 5802 section 3.
+type Credentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewCredentials derives credentials from a password.
+func (mech *Mechanism) NewCredentials(password string, salt []byte, iterations int) *Credentials {
+	saltedPassword := mech.saltedPassword(password, salt, iterations)
+	clientKey := mech.hmac(saltedPassword, []byte("Client Key"))
+	return &Credentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  mech.hash(clientKey),
+		ServerKey:  mech.hmac(saltedPassword, []byte("Server Key")),
+	}
+}
+
+func newNonce() string {
+	var b [18]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // unreachable
+	}
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func encodeName(name string) string {
+	name = strings.ReplaceAll(name, "=", "=3D")
+	return strings.ReplaceAll(name, ",", "=2C")
+}
+
+func decodeName(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case ',':
+			return "", errors.New("scram: invalid character in name")
+		case '=':
+			if i+3 > len(s) {
+				return "", errors.New("scram: invalid escape sequence in name")
+			}
+			switch s[i+1 : i+3] {
+			case "2C":
+				sb.WriteByte(',')
+			case "3D":
+				sb.WriteByte('=')
+			default:
+				return "", errors.New("scram: invalid escape sequence in name")
+			}
+			i += 2
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseAttr parses an attribute of the form "k=value".
+func parseAttr(s string, k byte) (string, error) {
+	if len(s) < 2 || s[0] != k || s[1] != '=' {
+		return "", fmt.Errorf("scram: expected attribute %q", k)
+	}
+	return s[2:], nil
+}
+
+// Server is the server side of a SCRAM authentication exchange. It
+// implements the go-sasl Server interface.
+type Server struct {
+	mech         *Mechanism
+	lookup       func(username string) (*Credentials, error)
+	authenticate func(username string) error
+
+	step            int
+	nonce           string // full nonce, client and server parts
+	serverNonce     string // generated if empty
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	username        string
+	creds           *Credentials
+}
+
+// NewServer creates a new SCRAM server.
+//
+// lookup is called to retrieve the credentials of a user. authenticate is
+// called once the user has proven it knows the password matching these
+// credentials.
+func NewServer(mech *Mechanism, lookup func(username string) (*Credentials, error), authenticate func(username string) error) *Server {
+	return &Server{mech: mech, lookup: lookup, authenticate: authenticate}
+}
+
+// Next processes a client response and returns the next challenge.
+func (s *Server) Next(response []byte) (challenge []byte, done bool, err error) {
+	switch s.step {
+	case 0:
+		if response == nil {
+			// No initial response, send an empty challenge
+			return []byte{}, false, nil
+		}
+		s.step++
+		challenge, err := s.handleClientFirst(string(response))
+		return challenge, false, err
+	case 1:
+		s.step++
+		challenge, err := s.handleClientFinal(string(response))
+		return challenge, false, err
+	case 2:
+		s.step++
+		if len(response) != 0 {
+			return nil, false, errors.New("scram: unexpected client response")
+		}
+		return nil, true, nil
+	default:
+		return nil, false, errors.New("scram: unexpected client response")
+	}
+}
+
+func (s *Server) handleClientFirst(msg string) ([]byte, error) {
+	parts := strings.SplitN(msg, ",", 3)
+	if len(parts) != 3 {
+		return nil, errors.New("scram: malformed client-first-message")
+	}
+	switch parts[0] {
+	case "n", "y":
+		// ok
+	default:
+		return nil, errors.New("scram: channel binding not supported")
+	}
+	var authzid string
+	if parts[1] != "" {
+		encoded, err := parseAttr(parts[1], 'a')
+		if err != nil {
+			return nil, err
+		}
+		if authzid, err = decodeName(encoded); err != nil {
+			return nil, err
+		}
+	}
+	s.gs2Header = parts[0] + "," + parts[1] + ","
+	s.clientFirstBare = parts[2]
+
+	attrs := strings.Split(s.clientFirstBare, ",")
+	if len(attrs) < 2 {
+		return nil, errors.New("scram: malformed client-first-message")
+	}
+	encodedUsername, err := parseAttr(attrs[0], 'n')
+	if err != nil {
+		return nil, err
+	}
+	s.username, err = decodeName(encodedUsername)
+	if err != nil {
+		return nil, err
+	}
+	clientNonce, err := parseAttr(attrs[1], 'r')
+	if err != nil {
+		return nil, err
+	} else if clientNonce == "" {
+		return nil, errors.New("scram: empty client nonce")
+	}
+
+	if authzid != "" && authzid != s.username {
+		return nil, errors.New("scram: authorization identity not supported")
+	}
+
+	s.creds, err = s.lookup(s.username)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.serverNonce == "" {
+		s.serverNonce = newNonce()
+	}
+	s.nonce = clientNonce + s.serverNonce
+	s.serverFirst = fmt.Sprintf("r=%v,s=%v,i=%v", s.nonce, base64.StdEncoding.EncodeToString(s.creds.Salt), s.creds.Iterations)
+	return []byte(s.serverFirst), nil
+}
+
+func (s *Server) handleClientFinal(msg string) ([]byte, error) {
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return nil, errors.New("scram: missing client proof")
+	}
+	withoutProof := msg[:i]
+	proof, err := base64.StdEncoding.DecodeString(msg[i+len(",p="):])
+	if err != nil {
+		return nil, errors.New("scram: malformed client proof")
+	}
+
+	attrs := strings.Split(withoutProof, ",")
+	if len(attrs) < 2 {
+		return nil, errors.New("scram: malformed client-final-message")
+	}
+	channelBinding, err := parseAttr(attrs[0], 'c')
+	if err != nil {
+		return nil, err
+	}
+	if channelBinding != base64.StdEncoding.EncodeToString([]byte(s.gs2Header)) {
+		return nil, errors.New("scram: channel binding mismatch")
+	}
+	nonce, err := parseAttr(attrs[1], 'r')
+	if err != nil {
+		return nil, err
+	} else if nonce != s.nonce {
+		return nil, errors.New("scram: nonce mismatch")
+	}
+
+	authMessage := []byte(s.clientFirstBare + "," + s.serverFirst + "," + withoutProof)
+	clientSignature := s.mech.hmac(s.creds.StoredKey, authMessage)
+	if len(proof) != len(clientSignature) {
+		return nil, errors.New("scram: invalid client proof")
+	}
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	if subtle.ConstantTimeCompare(s.mech.hash(clientKey), s.creds.StoredKey) != 1 {
+		return nil, errors.New("scram: invalid client proof")
+	}
+
+	if err := s.authenticate(s.username); err != nil {
+		return nil, err
+	}
+
+	serverSignature := s.mech.hmac(s.creds.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), nil
+}
+
+// Client is the client side of a SCRAM authentication exchange. It
+// implements the go-sasl Client interface.
+type Client struct {
+	mech               *Mechanism
+	username, password string
+
+	step            int
+	clientNonce     string // generated if empty
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// NewClient creates a new SCRAM client.
+func NewClient(mech *Mechanism, username, password string) *Client {
+	return &Client{mech: mech, username: username, password: password}
+}
+
+// Start begins the authentication exchange.
+func (c *Client) Start() (mech string, ir []byte, err error) {
+	if c.clientNonce == "" {
+		c.clientNonce = newNonce()
+	}
+	c.step = 0
+	c.clientFirstBare = "n=" + encodeName(c.username) + ",r=" + c.clientNonce
+	return c.mech.Name, []byte("n,," + c.clientFirstBare), nil
+}
+
+// Next processes a server challenge and returns the next response.
+func (c *Client) Next(challenge []byte) (response []byte, err error) {
+	c.step++
+	switch c.step {
+	case 1:
+		return c.handleServerFirst(string(challenge))
+	case 2:
+		return c.handleServerFinal(string(challenge))
+	default:
+		return nil, errors.New("scram: unexpected server challenge")
+	}
+}
+
+func (c *Client) handleServerFirst(msg string) ([]byte, error) {
+	attrs := strings.Split(msg, ",")
+	if len(attrs) < 3 {
+		return nil, errors.New("scram: malformed server-first-message")
+	}
+	nonce, err := parseAttr(attrs[0], 'r')
+	if err != nil {
+		return nil, err
+	} else if !strings.HasPrefix(nonce, c.clientNonce) || len(nonce) == len(c.clientNonce) {
+		return nil, errors.New("scram: invalid server nonce")
+	}
+	encodedSalt, err := parseAttr(attrs[1], 's')
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, errors.New("scram: malformed salt")
+	}
+	iterStr, err := parseAttr(attrs[2], 'i')
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := strconv.Atoi(iterStr)
+	if err != nil || iterations < 1 || iterations > maxIterations {
+		return nil, errors.New("scram: invalid iteration count")
+	}
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + nonce
+	authMessage := []byte(c.clientFirstBare + "," + msg + "," + withoutProof)
+
+	saltedPassword := c.mech.saltedPassword(c.password, salt, iterations)
+	clientKey := c.mech.hmac(saltedPassword, []byte("Client Key"))
+	clientSignature := c.mech.hmac(c.mech.hash(clientKey), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverKey := c.mech.hmac(saltedPassword, []byte("Server Key"))
+	c.serverSignature = c.mech.hmac(serverKey, authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func (c *Client) handleServerFinal(msg string) ([]byte, error) {
+	if errMsg, err := parseAttr(msg, 'e'); err == nil {
+		return nil, fmt.Errorf("scram: server error: %v", errMsg)
+	}
+	encoded, err := parseAttr(msg, 'v')
+	if err != nil {
+		return nil, err
+	}
+	serverSignature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("scram: malformed server signature")
+	}
+	if !bytes.Equal(serverSignature, c.serverSignature) {
+		return nil, errors.New("scram: invalid server signature")
+	}
+	return []byte{}, nil
+}
@@ -0,0 +1,138 @@
+package scram
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// Test vectors from RFC 5802 section 5 and RFC 7677 section 3
+var scramTests = []struct {
+	mech                     *Mechanism
+	username, password       string
+	clientNonce, serverNonce string
+	salt                     string
+	iterations               int
+	clientFirst, serverFirst string
+	clientFinal, serverFinal string
+}{
+	{
+		mech:        SHA1,
+		username:    "user",
+		password:    "pencil",
+		clientNonce: "fyko+d2lbbFgONRv9qkxdawL",
+		serverNonce: "3rfcNHYJY1ZVvWVs7j",
+		salt:        "QSXCR+Q6sek8bf92",
+		iterations:  4096,
+		clientFirst: "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+		serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+		clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+		serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+	},
+	{
+		mech:        SHA256,
+		username:    "user",
+		password:    "pencil",
+		clientNonce: "rOprNGfwEbeRWgbNEkqO",
+		serverNonce: "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0",
+		salt:        "W22ZaJ0SNY7soEsUEjb6gQ==",
+		iterations:  4096,
+		clientFirst: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+	},
+}
+
+func TestClient(t *testing.T) {
+	for _, tc := range scramTests {
+		tc := tc
+		t.Run(tc.mech.Name, func(t *testing.T) {
+			c := NewClient(tc.mech, tc.username, tc.password)
+			c.clientNonce = tc.clientNonce
+
+			mech, ir, err := c.Start()
+			if err != nil {
+				t.Fatalf("Start() = %v", err)
+			} else if mech != tc.mech.Name {
+				t.Errorf("Start() mech = %v, want %v", mech, tc.mech.Name)
+			} else if string(ir) != tc.clientFirst {
+				t.Errorf("Start() = %q, want %q", ir, tc.clientFirst)
+			}
+
+			resp, err := c.Next([]byte(tc.serverFirst))
+			if err != nil {
+				t.Fatalf("Next(server-first) = %v", err)
+			} else if string(resp) != tc.clientFinal {
+				t.Errorf("Next(server-first) = %q, want %q", resp, tc.clientFinal)
+			}
+
+			if _, err := c.Next([]byte(tc.serverFinal)); err != nil {
+				t.Errorf("Next(server-final) = %v", err)
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	for _, tc := range scramTests {
+		tc := tc
+		t.Run(tc.mech.Name, func(t *testing.T) {
+			salt, err := base64.StdEncoding.DecodeString(tc.salt)
+			if err != nil {
+				t.Fatalf("failed to decode salt: %v", err)
+			}
+			creds := tc.mech.NewCredentials(tc.password, salt, tc.iterations)
+
+			var authenticated string
+			s := NewServer(tc.mech, func(username string) (*Credentials, error) {
+				return creds, nil
+			}, func(username string) error {
+				authenticated = username
+				return nil
+			})
+			s.serverNonce = tc.serverNonce
+
+			challenge, done, err := s.Next([]byte(tc.clientFirst))
+			if err != nil || done {
+				t.Fatalf("Next(client-first) = %v, %v", done, err)
+			} else if string(challenge) != tc.serverFirst {
+				t.Errorf("Next(client-first) = %q, want %q", challenge, tc.serverFirst)
+			}
+
+			challenge, done, err = s.Next([]byte(tc.clientFinal))
+			if err != nil || done {
+				t.Fatalf("Next(client-final) = %v, %v", done, err)
+			} else if string(challenge) != tc.serverFinal {
+				t.Errorf("Next(client-final) = %q, want %q", challenge, tc.serverFinal)
+			}
+			if authenticated != tc.username {
+				t.Errorf("authenticated username = %q, want %q", authenticated, tc.username)
+			}
+
+			if _, done, err := s.Next([]byte{}); err != nil || !done {
+				t.Errorf("Next(empty) = %v, %v, want done", done, err)
+			}
+		})
+	}
+}
+
+func TestServer_invalidProof(t *testing.T) {
+	tc := scramTests[1]
+	salt, _ := base64.StdEncoding.DecodeString(tc.salt)
+	creds := tc.mech.NewCredentials("wrong password", salt, tc.iterations)
+
+	s := NewServer(tc.mech, func(username string) (*Credentials, error) {
+		return creds, nil
+	}, func(username string) error {
+		t.Errorf("authenticate called with invalid proof")
+		return nil
+	})
+	s.serverNonce = tc.serverNonce
+
+	if _, _, err := s.Next([]byte(tc.clientFirst)); err != nil {
+		t.Fatalf("Next(client-first) = %v", err)
+	}
+	if _, _, err := s.Next([]byte(tc.clientFinal)); err == nil {
+		t.Errorf("Next(client-final) succeeded with invalid proof")
+	}
+}
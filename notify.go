@@ -0,0 +1,46 @@
+package imap
+
+// NotifyEvent is an event type for the NOTIFY command.
+type NotifyEvent string
+
+const (
+	// Message events
+	NotifyEventMessageNew     NotifyEvent = "MessageNew"
+	NotifyEventMessageExpunge NotifyEvent = "MessageExpunge"
+	NotifyEventFlagChange     NotifyEvent = "FlagChange"
+
+	// Mailbox events
+	NotifyEventMailboxName        NotifyEvent = "MailboxName"
+	NotifyEventSubscriptionChange NotifyEvent = "SubscriptionChange"
+)
+
+// NotifyFilter selects the mailboxes an event group applies to.
+type NotifyFilter string
+
+const (
+	NotifyFilterSelected        NotifyFilter = "SELECTED"
+	NotifyFilterSelectedDelayed NotifyFilter = "SELECTED-DELAYED"
+	NotifyFilterInboxes         NotifyFilter = "INBOXES"
+	NotifyFilterPersonal        NotifyFilter = "PERSONAL"
+	NotifyFilterSubscribed      NotifyFilter = "SUBSCRIBED"
+	NotifyFilterSubtree         NotifyFilter = "SUBTREE"   // requires Mailboxes
+	NotifyFilterMailboxes       NotifyFilter = "MAILBOXES" // requires Mailboxes
+)
+
+// NotifyEventGroup is a set of events the client wants to be notified about
+// for a set of mailboxes.
+type NotifyEventGroup struct {
+	Filter NotifyFilter
+	// Mailbox names for the SUBTREE and MAILBOXES filters
+	Mailboxes []string
+	// Events to report. If empty, no events are reported for the mailboxes
+	// matched by the filter.
+	Events []NotifyEvent
+}
+
+// NotifyOptions contains options for the NOTIFY command.
+type NotifyOptions struct {
+	// Send the current status of the matched mailboxes right away
+	Status      bool
+	EventGroups []NotifyEventGroup
+}
@@ -0,0 +1,48 @@
+package imap
+
+// NumSet is a set of message sequence numbers or UIDs used as a command
+// argument. It's either a SeqSet or SearchRes.
+type NumSet interface {
+	// String returns the IMAP representation of the set.
+	String() string
+	// Dynamic returns true if the messages referenced by the set depend on
+	// the mailbox state.
+	Dynamic() bool
+
+	numSet()
+}
+
+var (
+	_ NumSet = SeqSet(nil)
+	_ NumSet = SearchRes{}
+)
+
+func (SeqSet) numSet() {}
+
+// SearchRes references the result of the last SEARCH command with the SAVE
+// return option ("$"). It requires IMAP4rev2 or SEARCHRES.
+//
+// The messages referenced by SearchRes are only known to the server.
+type SearchRes struct{}
+
+// String returns "$".
+func (SearchRes) String() string {
+	return "$"
+}
+
+// Dynamic always returns true: the saved search result is updated by the
+// server.
+func (SearchRes) Dynamic() bool {
+	return true
+}
+
+func (SearchRes) numSet() {}
+
+// ParseNumSet parses a sequence set or a reference to the saved search
+// result ("$").
+func ParseNumSet(s string) (NumSet, error) {
+	if s == "$" {
+		return SearchRes{}, nil
+	}
+	return ParseSeqSet(s)
+}
@@ -27,6 +27,7 @@ const (
 	ResponseCodeBadCharset           ResponseCode = "BADCHARSET"
 	ResponseCodeCannot               ResponseCode = "CANNOT"
 	ResponseCodeClientBug            ResponseCode = "CLIENTBUG"
+	ResponseCodeCompressionActive    ResponseCode = "COMPRESSIONACTIVE"
 	ResponseCodeContactAdmin         ResponseCode = "CONTACTADMIN"
 	ResponseCodeCorruption           ResponseCode = "CORRUPTION"
 	ResponseCodeExpired              ResponseCode = "EXPIRED"
@@ -49,6 +50,18 @@ const (
 
 	// APPENDLIMIT
 	ResponseCodeTooBig ResponseCode = "TOOBIG"
+
+	// CONDSTORE
+	ResponseCodeHighestModSeq ResponseCode = "HIGHESTMODSEQ"
+	ResponseCodeNoModSeq      ResponseCode = "NOMODSEQ"
+	ResponseCodeModified      ResponseCode = "MODIFIED"
+
+	// CATENATE
+	ResponseCodeBadURL ResponseCode = "BADURL"
+
+	// NOTIFY
+	ResponseCodeBadEvent             ResponseCode = "BADEVENT"
+	ResponseCodeNotificationOverflow ResponseCode = "NOTIFICATIONOVERFLOW"
 )
 
 // StatusResponse is a generic status response.
@@ -13,6 +13,7 @@ const (
 	SearchReturnMax   SearchReturnOption = "MAX"
 	SearchReturnAll   SearchReturnOption = "ALL"
 	SearchReturnCount SearchReturnOption = "COUNT"
+	SearchReturnSave  SearchReturnOption = "SAVE" // requires IMAP4rev2 or SEARCHRES
 )
 
 // SearchOptions contains options for the SEARCH command.
@@ -27,6 +28,9 @@ type SearchOptions struct {
 type SearchCriteria struct {
 	SeqNum SeqSet
 	UID    SeqSet
+	// Match messages in the result of the last SEARCH command with the SAVE
+	// return option ("$"). Requires IMAP4rev2 or SEARCHRES.
+	SearchRes bool
 
 	// Only the date is used, the time and timezone are ignored
 	Since      time.Time
@@ -46,12 +50,35 @@ type SearchCriteria struct {
 
 	Not []SearchCriteria
 	Or  [][2]SearchCriteria
+
+	ModSeq *SearchCriteriaModSeq // requires CONDSTORE
 }
 
 type SearchCriteriaHeaderField struct {
 	Key, Value string
 }
 
+// SearchCriteriaModSeq matches messages whose mod-sequence is greater than or
+// equal to ModSeq.
+//
+// If MetadataName is non-empty, only the mod-sequence of this metadata item
+// is taken into account.
+type SearchCriteriaModSeq struct {
+	ModSeq       uint64
+	MetadataName string
+	MetadataType SearchCriteriaMetadataType
+}
+
+// SearchCriteriaMetadataType is the type of a metadata item used in a MODSEQ
+// search key.
+type SearchCriteriaMetadataType string
+
+const (
+	SearchCriteriaMetadataAll     SearchCriteriaMetadataType = "all"
+	SearchCriteriaMetadataPrivate SearchCriteriaMetadataType = "priv"
+	SearchCriteriaMetadataShared  SearchCriteriaMetadataType = "shared"
+)
+
 // SearchData is the data returned by a SEARCH command.
 type SearchData struct {
 	All SeqSet
@@ -61,6 +88,9 @@ type SearchData struct {
 	Min   uint32
 	Max   uint32
 	Count uint32
+
+	// requires CONDSTORE
+	ModSeq uint64
 }
 
 // AllNums returns All as a slice of numbers.
@@ -1,5 +1,12 @@
 package imap
 
+// SelectOptions contains options for the SELECT or EXAMINE command.
+type SelectOptions struct {
+	ReadOnly  bool
+	CondStore bool           // requires CONDSTORE
+	QResync   *QResyncParams // requires QRESYNC
+}
+
 // SelectData is the data returned by a SELECT command.
 //
 // In the old RFC 2060, PermanentFlags, UIDNext and UIDValidity are optional.
@@ -14,4 +21,22 @@ type SelectData struct {
 	UIDValidity uint32
 
 	List *ListData // requires IMAP4rev2
+
+	HighestModSeq uint64 // requires CONDSTORE
+}
+
+// QResyncParams contains the QRESYNC parameters for the SELECT and EXAMINE
+// commands.
+type QResyncParams struct {
+	UIDValidity uint32
+	ModSeq      uint64
+	KnownUIDs   SeqSet           // optional
+	SeqMatch    *QResyncSeqMatch // optional
+}
+
+// QResyncSeqMatch contains message sequence match data. Each message sequence
+// number in SeqNums corresponds to the UID at the same position in UIDs.
+type QResyncSeqMatch struct {
+	SeqNums SeqSet
+	UIDs    SeqSet
 }
@@ -722,3 +722,29 @@ func TestSeqSetAddNumRangeSet(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNumSet(t *testing.T) {
+	numSet, err := ParseNumSet("$")
+	if err != nil {
+		t.Fatalf("ParseNumSet(\"$\") = %v", err)
+	} else if _, ok := numSet.(SearchRes); !ok {
+		t.Errorf("ParseNumSet(\"$\") = %#v, want SearchRes", numSet)
+	} else if out := numSet.String(); out != "$" {
+		t.Errorf("SearchRes.String() = %q, want %q", out, "$")
+	} else if !numSet.Dynamic() {
+		t.Errorf("SearchRes.Dynamic() = false")
+	}
+
+	for _, in := range []string{"*", "1:*", "1,3"} {
+		numSet, err := ParseNumSet(in)
+		if err != nil {
+			t.Errorf("ParseNumSet(%q) = %v", in, err)
+		} else if seqSet, ok := numSet.(SeqSet); !ok || seqSet.String() != in {
+			t.Errorf("ParseNumSet(%q) = %#v", in, numSet)
+		}
+	}
+
+	if _, err := ParseSeqSet("$"); err == nil {
+		t.Errorf("ParseSeqSet(\"$\") succeeded")
+	}
+}
@@ -9,6 +9,13 @@ const (
 	StoreFlagsDel
 )
 
+// StoreOptions contains options for the STORE command.
+type StoreOptions struct {
+	// Only alter messages whose mod-sequence is lower than or equal to this
+	// value. Requires CONDSTORE.
+	UnchangedSince uint64
+}
+
 // StoreFlags alters message flags.
 type StoreFlags struct {
 	Op     StoreFlagsOp
@@ -7,3 +7,12 @@ const (
 	ThreadOrderedSubject ThreadAlgorithm = "ORDEREDSUBJECT"
 	ThreadReferences     ThreadAlgorithm = "REFERENCES"
 )
+
+// ThreadData is a thread returned by the THREAD command.
+//
+// Chain contains message numbers of messages following each other in the
+// thread. SubThreads contains the replies to the last message of Chain.
+type ThreadData struct {
+	Chain      []uint32
+	SubThreads []ThreadData
+}